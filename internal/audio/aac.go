@@ -0,0 +1,1169 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// errAACFrame marks a frame the decoder can't parse, the frames after it may
+// still decode.
+var errAACFrame = errors.New("malformed AAC frame")
+
+const aacFrameLength = 1024
+
+// Window sequences of ics_info.
+const (
+	windowOnlyLong = iota
+	windowLongStart
+	windowEightShort
+	windowLongStop
+)
+
+// Section codebooks, 1 to 11 are spectral Huffman codebooks.
+const (
+	bandZero       = 0
+	bandEscape     = 11
+	bandNoise      = 13
+	bandIntensity2 = 14
+	bandIntensity  = 15
+)
+
+// Syntactic elements of a raw_data_block.
+const (
+	elementSCE = iota
+	elementCPE
+	elementCCE
+	elementLFE
+	elementDSE
+	elementPCE
+	elementFIL
+	elementEND
+)
+
+var (
+	aacScalefactorTree = newHuffTree(aacScalefactorCodes)
+	aacSpectralTrees   = newSpectralTrees()
+
+	// Rising halves of the sine and KBD windows, by window_shape.
+	aacLongWindows  = [2][]float64{sineWindow(1024), kbdWindow(1024, 4)}
+	aacShortWindows = [2][]float64{sineWindow(128), kbdWindow(128, 6)}
+)
+
+// aacDecoder decodes the AAC-LC frames of one stream, the core of HE-AAC
+// streams included. SBR and PS data are skipped, so those play at the core
+// sample rate.
+type aacDecoder struct {
+	sampleRate int
+	rateIndex  int
+	channels   map[int]*aacChannel
+	ics        [2]aacICS
+	long       *imdct
+	short      *imdct
+	buf        []float64
+	shortBuf   []float64
+	seed       uint32
+}
+
+// aacChannel keeps what a channel carries over from one frame to the next.
+type aacChannel struct {
+	overlap     []float64
+	windowShape int
+	out         []float64
+}
+
+type aacICSInfo struct {
+	windowSequence int
+	windowShape    int
+	maxSFB         int
+	numGroups      int
+	groupLen       [8]int
+	swb            []uint16
+}
+
+// aacICS is an individual_channel_stream. Spectral data of the eight short
+// windows is stored one window after another, 128 coefficients each.
+type aacICS struct {
+	aacICSInfo
+	bandType [8][64]int
+	sf       [8][64]int
+	pulse    aacPulse
+	tns      aacTNS
+	quant    [aacFrameLength]int
+	spec     [aacFrameLength]float64
+}
+
+type aacPulse struct {
+	count    int
+	startSFB int
+	offset   [4]int
+	amp      [4]int
+}
+
+type aacTNS struct {
+	numFilters [8]int
+	filters    [8][3]aacTNSFilter
+}
+
+type aacTNSFilter struct {
+	length int
+	order  int
+	down   bool
+	lpc    [13]float64
+}
+
+func newAACDecoder(asc []byte) (*aacDecoder, error) {
+	b := &bitReader{data: asc}
+
+	objectType := b.read(5)
+	if objectType == 31 {
+		objectType = 32 + b.read(6)
+	}
+
+	rateIndex := int(b.read(4))
+	sampleRate := 0
+
+	if rateIndex == 0x0F {
+		sampleRate = int(b.read(24))
+		rateIndex = nearestRateIndex(sampleRate)
+	} else if rateIndex < len(aacSampleRates) {
+		sampleRate = aacSampleRates[rateIndex]
+	}
+
+	// The channels come from the elements of each frame.
+	b.read(4)
+
+	// HE-AAC signals the rate of the SBR layer and the object type of the
+	// core, which is decoded alone at its own rate.
+	if objectType == 5 || objectType == 29 {
+		if b.read(4) == 0x0F {
+			b.read(24)
+		}
+
+		objectType = b.read(5)
+	}
+
+	if objectType != 2 {
+		return nil, fmt.Errorf("%w: AAC object type %d", ErrUnsupported, objectType)
+	}
+
+	if sampleRate == 0 || b.overrun() {
+		return nil, fmt.Errorf("%w: invalid AAC config", ErrUnsupported)
+	}
+
+	if b.read(1) == 1 {
+		return nil, fmt.Errorf("%w: AAC with 960 sample frames", ErrUnsupported)
+	}
+
+	return &aacDecoder{
+		sampleRate: sampleRate,
+		rateIndex:  rateIndex,
+		channels:   map[int]*aacChannel{},
+		long:       newIMDCT(aacFrameLength),
+		short:      newIMDCT(aacFrameLength / 8),
+		buf:        make([]float64, 2*aacFrameLength),
+		shortBuf:   make([]float64, aacFrameLength/4),
+		seed:       1,
+	}, nil
+}
+
+// nearestRateIndex maps an explicit sample rate to the index whose tables
+// it uses.
+func nearestRateIndex(rate int) int {
+	for i, limit := range []int{92017, 75132, 55426, 46009, 37566, 27713, 23004, 18783, 13856, 11502, 9391} {
+		if rate >= limit {
+			return i
+		}
+	}
+
+	return 11
+}
+
+// decode decodes a raw_data_block into 1024 samples in the range -1..1 for
+// every channel but LFE. The slices are reused by the next call.
+func (d *aacDecoder) decode(frame []byte) ([][]float64, error) {
+	b := &bitReader{data: frame}
+
+	var out [][]float64
+
+	for {
+		id := b.read(3)
+
+		if b.overrun() {
+			return nil, errAACFrame
+		}
+
+		switch id {
+		case elementSCE, elementLFE:
+			tag := b.read(4)
+			ics := &d.ics[0]
+
+			if err := d.readICS(b, ics, false); err != nil {
+				return nil, err
+			}
+
+			ch := d.channel(id, tag, 0)
+			d.synthesize(ics, ch)
+
+			if id == elementSCE {
+				out = append(out, ch.out)
+			}
+		case elementCPE:
+			tag := b.read(4)
+			left, right := &d.ics[0], &d.ics[1]
+			common := b.read(1) == 1
+
+			var (
+				msPresent uint32
+				msMask    [8][64]bool
+			)
+
+			if common {
+				if err := d.readICSInfo(b, &left.aacICSInfo); err != nil {
+					return nil, err
+				}
+
+				right.aacICSInfo = left.aacICSInfo
+				msPresent = b.read(2)
+
+				for g := 0; g < left.numGroups; g++ {
+					for sfb := 0; sfb < left.maxSFB; sfb++ {
+						switch msPresent {
+						case 1:
+							msMask[g][sfb] = b.read(1) == 1
+						case 2:
+							msMask[g][sfb] = true
+						}
+					}
+				}
+
+				if msPresent == 3 {
+					return nil, errAACFrame
+				}
+			}
+
+			if err := d.readICS(b, left, common); err != nil {
+				return nil, err
+			}
+
+			if err := d.readICS(b, right, common); err != nil {
+				return nil, err
+			}
+
+			if common {
+				midSide(left, right, &msMask)
+				intensity(left, right, &msMask, msPresent != 0)
+			}
+
+			for i, ics := range []*aacICS{left, right} {
+				ch := d.channel(id, tag, i)
+				d.synthesize(ics, ch)
+				out = append(out, ch.out)
+			}
+		case elementDSE:
+			b.read(4)
+			align := b.read(1) == 1
+
+			count := int(b.read(8))
+			if count == 255 {
+				count += int(b.read(8))
+			}
+
+			if align {
+				b.align()
+			}
+
+			b.skip(count * 8)
+		case elementPCE:
+			skipPCE(b)
+		case elementFIL:
+			count := int(b.read(4))
+			if count == 15 {
+				count += int(b.read(8)) - 1
+			}
+
+			b.skip(count * 8)
+		case elementCCE:
+			return nil, fmt.Errorf("%w: AAC coupling channels", ErrUnsupported)
+		case elementEND:
+			return out, nil
+		}
+	}
+}
+
+func (d *aacDecoder) channel(id, tag uint32, pos int) *aacChannel {
+	key := int(id)<<5 | int(tag)<<1 | pos
+
+	ch, ok := d.channels[key]
+	if !ok {
+		ch = &aacChannel{
+			overlap: make([]float64, aacFrameLength),
+			out:     make([]float64, aacFrameLength),
+		}
+		d.channels[key] = ch
+	}
+
+	return ch
+}
+
+func skipPCE(b *bitReader) {
+	// element_instance_tag, object_type and sampling_frequency_index.
+	b.skip(10)
+
+	front, side, back := b.read(4), b.read(4), b.read(4)
+	lfe, assoc, cc := b.read(2), b.read(3), b.read(4)
+
+	if b.read(1) == 1 {
+		b.skip(4) // mono_mixdown_element_number
+	}
+
+	if b.read(1) == 1 {
+		b.skip(4) // stereo_mixdown_element_number
+	}
+
+	if b.read(1) == 1 {
+		b.skip(3) // matrix_mixdown_idx and pseudo_surround_enable
+	}
+
+	b.skip(int(front+side+back+cc)*5 + int(lfe+assoc)*4)
+	b.align()
+	b.skip(int(b.read(8)) * 8)
+}
+
+func (d *aacDecoder) readICSInfo(b *bitReader, info *aacICSInfo) error {
+	b.skip(1) // ics_reserved_bit
+	info.windowSequence = int(b.read(2))
+	info.windowShape = int(b.read(1))
+	info.numGroups = 1
+	info.groupLen[0] = 1
+
+	if info.windowSequence == windowEightShort {
+		info.maxSFB = int(b.read(4))
+		info.swb = aacSWBOffsetShort[d.rateIndex]
+
+		// A set bit of scale_factor_grouping puts the window into the group
+		// of the one before it.
+		grouping := b.read(7)
+
+		for w := 1; w < 8; w++ {
+			if grouping>>(7-w)&1 == 1 {
+				info.groupLen[info.numGroups-1]++
+			} else {
+				info.groupLen[info.numGroups] = 1
+				info.numGroups++
+			}
+		}
+	} else {
+		info.maxSFB = int(b.read(6))
+		info.swb = aacSWBOffsetLong[d.rateIndex]
+
+		if b.read(1) == 1 {
+			return fmt.Errorf("%w: AAC prediction", ErrUnsupported)
+		}
+	}
+
+	if info.maxSFB > len(info.swb)-1 {
+		return errAACFrame
+	}
+
+	return nil
+}
+
+func (d *aacDecoder) readICS(b *bitReader, ics *aacICS, common bool) error {
+	globalGain := int(b.read(8))
+
+	if !common {
+		if err := d.readICSInfo(b, &ics.aacICSInfo); err != nil {
+			return err
+		}
+	}
+
+	if err := readSections(b, ics); err != nil {
+		return err
+	}
+
+	if err := readScalefactors(b, ics, globalGain); err != nil {
+		return err
+	}
+
+	ics.pulse.count = 0
+
+	if b.read(1) == 1 {
+		if ics.windowSequence == windowEightShort {
+			return errAACFrame
+		}
+
+		ics.pulse.count = int(b.read(2)) + 1
+		ics.pulse.startSFB = int(b.read(6))
+
+		for i := 0; i < ics.pulse.count; i++ {
+			ics.pulse.offset[i] = int(b.read(5))
+			ics.pulse.amp[i] = int(b.read(4))
+		}
+	}
+
+	clear(ics.tns.numFilters[:])
+
+	if b.read(1) == 1 {
+		if err := readTNS(b, ics); err != nil {
+			return err
+		}
+	}
+
+	if b.read(1) == 1 {
+		return fmt.Errorf("%w: AAC gain control", ErrUnsupported)
+	}
+
+	if err := readSpectrum(b, ics); err != nil {
+		return err
+	}
+
+	if b.overrun() {
+		return errAACFrame
+	}
+
+	if err := applyPulse(ics); err != nil {
+		return err
+	}
+
+	d.dequantize(ics)
+
+	return nil
+}
+
+func readSections(b *bitReader, ics *aacICS) error {
+	bits, escape := 5, 31
+
+	if ics.windowSequence == windowEightShort {
+		bits, escape = 3, 7
+	}
+
+	for g := 0; g < ics.numGroups; g++ {
+		for sfb := 0; sfb < ics.maxSFB; {
+			if b.overrun() {
+				return errAACFrame
+			}
+
+			band := int(b.read(4))
+			if band == 12 {
+				return errAACFrame
+			}
+
+			end := sfb
+
+			for {
+				n := int(b.read(bits))
+				end += n
+
+				if n != escape {
+					break
+				}
+			}
+
+			if end > ics.maxSFB {
+				return errAACFrame
+			}
+
+			for ; sfb < end; sfb++ {
+				ics.bandType[g][sfb] = band
+			}
+		}
+	}
+
+	return nil
+}
+
+func readScalefactors(b *bitReader, ics *aacICS, globalGain int) error {
+	sf, position, noise := globalGain, 0, globalGain-90
+	noisePCM := true
+
+	for g := 0; g < ics.numGroups; g++ {
+		for sfb := 0; sfb < ics.maxSFB; sfb++ {
+			band := ics.bandType[g][sfb]
+
+			if band == bandZero {
+				ics.sf[g][sfb] = 0
+				continue
+			}
+
+			// The first noise energy is sent as is, everything else as
+			// Huffman coded differences.
+			if band == bandNoise && noisePCM {
+				noisePCM = false
+				noise += int(b.read(9)) - 256
+				ics.sf[g][sfb] = min(max(noise, -155), 100)
+
+				continue
+			}
+
+			delta, err := aacScalefactorTree.decode(b)
+
+			if err != nil {
+				return err
+			}
+
+			delta -= 60
+
+			// Positions and noise energies have no range of their own, the
+			// clamp keeps their gains finite.
+			switch band {
+			case bandIntensity, bandIntensity2:
+				position += delta
+				ics.sf[g][sfb] = min(max(position, -155), 100)
+			case bandNoise:
+				noise += delta
+				ics.sf[g][sfb] = min(max(noise, -155), 100)
+			default:
+				sf += delta
+
+				if sf < 0 || sf > 255 {
+					return errAACFrame
+				}
+
+				ics.sf[g][sfb] = sf
+			}
+		}
+	}
+
+	return nil
+}
+
+func readTNS(b *bitReader, ics *aacICS) error {
+	windows, filterBits, lengthBits, orderBits, maxOrder := 1, 2, 6, 5, 12
+
+	if ics.windowSequence == windowEightShort {
+		windows, filterBits, lengthBits, orderBits, maxOrder = 8, 1, 4, 3, 7
+	}
+
+	for w := 0; w < windows; w++ {
+		n := int(b.read(filterBits))
+		ics.tns.numFilters[w] = n
+
+		if n == 0 {
+			continue
+		}
+
+		resolution := int(b.read(1)) + 3
+
+		for f := 0; f < n; f++ {
+			filter := &ics.tns.filters[w][f]
+			filter.length = int(b.read(lengthBits))
+			filter.order = int(b.read(orderBits))
+
+			if filter.order > maxOrder {
+				return errAACFrame
+			}
+
+			if filter.order == 0 {
+				continue
+			}
+
+			filter.down = b.read(1) == 1
+			bits := resolution - int(b.read(1))
+
+			// Dequantize the reflection coefficients and step them up into
+			// the coefficients of the all-pole filter.
+			scale := float64(int(1)<<(resolution-1)) - 0.5
+			scaleNeg := float64(int(1)<<(resolution-1)) + 0.5
+
+			filter.lpc[0] = 1
+
+			for m := 1; m <= filter.order; m++ {
+				c := int(b.read(bits))
+				if c >= 1<<(bits-1) {
+					c -= 1 << bits
+				}
+
+				var parcor float64
+
+				if c >= 0 {
+					parcor = math.Sin(float64(c) * math.Pi / 2 / scale)
+				} else {
+					parcor = math.Sin(float64(c) * math.Pi / 2 / scaleNeg)
+				}
+
+				prev := filter.lpc
+
+				for i := 1; i < m; i++ {
+					filter.lpc[i] = prev[i] + parcor*prev[m-i]
+				}
+
+				filter.lpc[m] = parcor
+			}
+		}
+	}
+
+	return nil
+}
+
+func readSpectrum(b *bitReader, ics *aacICS) error {
+	clear(ics.quant[:])
+
+	window := 0
+
+	for g := 0; g < ics.numGroups; g++ {
+		for sfb := 0; sfb < ics.maxSFB; sfb++ {
+			band := ics.bandType[g][sfb]
+
+			if band == bandZero || band > bandEscape {
+				continue
+			}
+
+			start, end := int(ics.swb[sfb]), int(ics.swb[sfb+1])
+
+			for w := window; w < window+ics.groupLen[g]; w++ {
+				for k := w*128 + start; k < w*128+end; {
+					n, err := readCodeword(b, band, ics.quant[k:])
+
+					if err != nil {
+						return err
+					}
+
+					k += n
+				}
+			}
+		}
+
+		window += ics.groupLen[g]
+	}
+
+	return nil
+}
+
+// readCodeword reads the two or four quantized values of one spectral
+// codeword into dst and returns how many it read.
+func readCodeword(b *bitReader, band int, dst []int) (int, error) {
+	i, err := aacSpectralTrees[band-1].decode(b)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var values []int
+
+	switch band {
+	case 1, 2:
+		values = []int{i/27 - 1, i/9%3 - 1, i/3%3 - 1, i%3 - 1}
+	case 3, 4:
+		values = []int{i / 27, i / 9 % 3, i / 3 % 3, i % 3}
+	case 5, 6:
+		values = []int{i/9 - 4, i%9 - 4}
+	case 7, 8:
+		values = []int{i / 8, i % 8}
+	case 9, 10:
+		values = []int{i / 13, i % 13}
+	default:
+		values = []int{i / 17, i % 17}
+	}
+
+	// Unsigned codebooks send the signs of nonzero values after the codeword.
+	if band != 1 && band != 2 && band != 5 && band != 6 {
+		for j, v := range values {
+			if v != 0 && b.read(1) == 1 {
+				values[j] = -v
+			}
+		}
+	}
+
+	// 16 in the escape codebook is followed by an escape sequence: a run
+	// of N ones, a zero and the N+4 low bits of a value of 2^(N+4) or more.
+	if band == bandEscape {
+		for j, v := range values {
+			if v != 16 && v != -16 {
+				continue
+			}
+
+			bits := 4
+
+			for b.read(1) == 1 {
+				if bits++; bits > 12 {
+					return 0, errAACFrame
+				}
+			}
+
+			magnitude := 1<<bits + int(b.read(bits))
+
+			if v < 0 {
+				magnitude = -magnitude
+			}
+
+			values[j] = magnitude
+		}
+	}
+
+	return copy(dst, values), nil
+}
+
+func applyPulse(ics *aacICS) error {
+	if ics.pulse.count == 0 {
+		return nil
+	}
+
+	if ics.pulse.startSFB >= len(ics.swb)-1 {
+		return errAACFrame
+	}
+
+	k := int(ics.swb[ics.pulse.startSFB])
+
+	for i := 0; i < ics.pulse.count; i++ {
+		k += ics.pulse.offset[i]
+
+		if k >= aacFrameLength {
+			return errAACFrame
+		}
+
+		if ics.quant[k] > 0 {
+			ics.quant[k] += ics.pulse.amp[i]
+		} else {
+			ics.quant[k] -= ics.pulse.amp[i]
+		}
+	}
+
+	return nil
+}
+
+// dequantize scales the quantized values by their scalefactors and fills
+// noise bands with random values of the sent energy.
+func (d *aacDecoder) dequantize(ics *aacICS) {
+	clear(ics.spec[:])
+
+	window := 0
+
+	for g := 0; g < ics.numGroups; g++ {
+		for sfb := 0; sfb < ics.maxSFB; sfb++ {
+			band := ics.bandType[g][sfb]
+			start, end := int(ics.swb[sfb]), int(ics.swb[sfb+1])
+
+			switch {
+			case band == bandNoise:
+				scale := math.Exp2(0.25 * float64(ics.sf[g][sfb]))
+
+				for w := window; w < window+ics.groupLen[g]; w++ {
+					d.noise(ics.spec[w*128+start:w*128+end], scale)
+				}
+			case band > bandZero && band <= bandEscape:
+				gain := math.Exp2(0.25 * float64(ics.sf[g][sfb]-100))
+
+				for w := window; w < window+ics.groupLen[g]; w++ {
+					for k := w*128 + start; k < w*128+end; k++ {
+						q := float64(ics.quant[k])
+						ics.spec[k] = q * math.Cbrt(math.Abs(q)) * gain
+					}
+				}
+			}
+		}
+
+		window += ics.groupLen[g]
+	}
+}
+
+func (d *aacDecoder) noise(spec []float64, scale float64) {
+	var energy float64
+
+	for i := range spec {
+		d.seed = d.seed*1664525 + 1013904223
+		spec[i] = float64(int32(d.seed))
+		energy += spec[i] * spec[i]
+	}
+
+	if energy == 0 {
+		return
+	}
+
+	scale /= math.Sqrt(energy)
+
+	for i := range spec {
+		spec[i] *= scale
+	}
+}
+
+// midSide turns the mid and side bands of a channel pair into left and right.
+func midSide(left, right *aacICS, mask *[8][64]bool) {
+	window := 0
+
+	for g := 0; g < left.numGroups; g++ {
+		for sfb := 0; sfb < left.maxSFB; sfb++ {
+			if !mask[g][sfb] || left.bandType[g][sfb] >= bandNoise || right.bandType[g][sfb] >= bandNoise {
+				continue
+			}
+
+			for w := window; w < window+left.groupLen[g]; w++ {
+				for k := w*128 + int(left.swb[sfb]); k < w*128+int(left.swb[sfb+1]); k++ {
+					l, r := left.spec[k], right.spec[k]
+					left.spec[k], right.spec[k] = l+r, l-r
+				}
+			}
+		}
+
+		window += left.groupLen[g]
+	}
+}
+
+// intensity fills the intensity bands of the right channel with the scaled
+// left channel.
+func intensity(left, right *aacICS, mask *[8][64]bool, msPresent bool) {
+	window := 0
+
+	for g := 0; g < right.numGroups; g++ {
+		for sfb := 0; sfb < right.maxSFB; sfb++ {
+			band := right.bandType[g][sfb]
+
+			if band != bandIntensity && band != bandIntensity2 {
+				continue
+			}
+
+			scale := math.Exp2(-0.25 * float64(right.sf[g][sfb]))
+
+			if band == bandIntensity2 {
+				scale = -scale
+			}
+
+			if msPresent && mask[g][sfb] {
+				scale = -scale
+			}
+
+			for w := window; w < window+right.groupLen[g]; w++ {
+				for k := w*128 + int(right.swb[sfb]); k < w*128+int(right.swb[sfb+1]); k++ {
+					right.spec[k] = left.spec[k] * scale
+				}
+			}
+		}
+
+		window += right.groupLen[g]
+	}
+}
+
+func (d *aacDecoder) applyTNS(ics *aacICS) {
+	windows, maxBands, size := 1, aacTNSMaxBandsLong[d.rateIndex], aacFrameLength
+
+	if ics.windowSequence == windowEightShort {
+		windows, maxBands, size = 8, aacTNSMaxBandsShort[d.rateIndex], aacFrameLength/8
+	}
+
+	limit := min(maxBands, ics.maxSFB)
+
+	for w := 0; w < windows; w++ {
+		spec := ics.spec[w*size : (w+1)*size]
+		top := len(ics.swb) - 1
+
+		for f := 0; f < ics.tns.numFilters[w]; f++ {
+			filter := &ics.tns.filters[w][f]
+			bottom := max(top-filter.length, 0)
+			start, end := int(ics.swb[min(bottom, limit)]), int(ics.swb[min(top, limit)])
+			top = bottom
+
+			if filter.order == 0 || end <= start {
+				continue
+			}
+
+			k, step := start, 1
+
+			if filter.down {
+				k, step = end-1, -1
+			}
+
+			var state [12]float64
+
+			for n := start; n < end; n++ {
+				y := spec[k]
+
+				for i := 0; i < filter.order; i++ {
+					y -= filter.lpc[i+1] * state[i]
+				}
+
+				copy(state[1:filter.order], state[:filter.order-1])
+				state[0] = y
+				spec[k] = y
+				k += step
+			}
+		}
+	}
+}
+
+// synthesize runs TNS and the filterbank over the spectrum of a channel and
+// overlaps the result with the previous frame.
+func (d *aacDecoder) synthesize(ics *aacICS, ch *aacChannel) {
+	d.applyTNS(ics)
+
+	buf := d.buf
+	long, short := aacLongWindows[ics.windowShape], aacShortWindows[ics.windowShape]
+	prevLong, prevShort := aacLongWindows[ch.windowShape], aacShortWindows[ch.windowShape]
+
+	if ics.windowSequence == windowEightShort {
+		clear(buf)
+
+		for w := 0; w < 8; w++ {
+			d.short.transform(ics.spec[w*128:(w+1)*128], d.shortBuf)
+
+			rise := short
+			if w == 0 {
+				rise = prevShort
+			}
+
+			offset := 448 + w*128
+
+			for i := 0; i < 128; i++ {
+				buf[offset+i] += d.shortBuf[i] * rise[i]
+				buf[offset+128+i] += d.shortBuf[128+i] * short[127-i]
+			}
+		}
+	} else {
+		d.long.transform(ics.spec[:], buf)
+
+		if ics.windowSequence == windowLongStop {
+			clear(buf[:448])
+
+			for i := 0; i < 128; i++ {
+				buf[448+i] *= prevShort[i]
+			}
+		} else {
+			for i := 0; i < 1024; i++ {
+				buf[i] *= prevLong[i]
+			}
+		}
+
+		if ics.windowSequence == windowLongStart {
+			for i := 0; i < 128; i++ {
+				buf[1472+i] *= short[127-i]
+			}
+
+			clear(buf[1600:])
+		} else {
+			for i := 0; i < 1024; i++ {
+				buf[1024+i] *= long[1023-i]
+			}
+		}
+	}
+
+	for i := 0; i < aacFrameLength; i++ {
+		ch.out[i] = (buf[i] + ch.overlap[i]) / 32768
+		ch.overlap[i] = buf[aacFrameLength+i]
+	}
+
+	ch.windowShape = ics.windowShape
+}
+
+func sineWindow(n int) []float64 {
+	w := make([]float64, n)
+
+	for i := range w {
+		w[i] = math.Sin(math.Pi / float64(2*n) * (float64(i) + 0.5))
+	}
+
+	return w
+}
+
+// kbdWindow is the rising half of a Kaiser-Bessel derived window.
+func kbdWindow(n int, alpha float64) []float64 {
+	kaiser := make([]float64, n+1)
+
+	var sum float64
+
+	for i := range kaiser {
+		x := 2*float64(i)/float64(n) - 1
+		kaiser[i] = besselI0(math.Pi * alpha * math.Sqrt(1-x*x))
+		sum += kaiser[i]
+	}
+
+	w := make([]float64, n)
+
+	var acc float64
+
+	for i := range w {
+		acc += kaiser[i]
+		w[i] = math.Sqrt(acc / sum)
+	}
+
+	return w
+}
+
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+
+	for k := 1; k < 50; k++ {
+		term *= x / 2 / float64(k)
+		sum += term * term
+	}
+
+	return sum
+}
+
+// imdct computes the inverse MDCT of n coefficients into 2n samples scaled
+// by 1/n, as a DCT-IV done with an n/2 point complex FFT.
+type imdct struct {
+	n       int
+	twiddle []complex128
+	roots   []complex128
+	z       []complex128
+	u       []float64
+}
+
+func newIMDCT(n int) *imdct {
+	m := &imdct{
+		n:       n,
+		twiddle: make([]complex128, n/2),
+		roots:   make([]complex128, n/4),
+		z:       make([]complex128, n/2),
+		u:       make([]float64, n),
+	}
+
+	for k := range m.twiddle {
+		m.twiddle[k] = cmplx.Exp(complex(0, -math.Pi*(float64(k)+0.125)/float64(n)))
+	}
+
+	for k := range m.roots {
+		m.roots[k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n/2)))
+	}
+
+	return m
+}
+
+func (m *imdct) transform(in, out []float64) {
+	n, z, u := m.n, m.z, m.u
+
+	for k := range z {
+		z[k] = complex(in[2*k], in[n-1-2*k]) * m.twiddle[k]
+	}
+
+	m.fft(z)
+
+	scale := 1 / float64(n)
+
+	for k := range z {
+		c := z[k] * m.twiddle[k]
+		u[2*k] = real(c) * scale
+		u[n-1-2*k] = -imag(c) * scale
+	}
+
+	// The output is the DCT-IV extended by its odd and even symmetries.
+	for i := 0; i < n/2; i++ {
+		out[i] = u[n/2+i]
+	}
+
+	for i := n / 2; i < 3*n/2; i++ {
+		out[i] = -u[3*n/2-1-i]
+	}
+
+	for i := 3 * n / 2; i < 2*n; i++ {
+		out[i] = -u[i-3*n/2]
+	}
+}
+
+// fft is an in-place radix-2 forward FFT.
+func (m *imdct) fft(x []complex128) {
+	n := len(x)
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := n / size
+
+		for start := 0; start < n; start += size {
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*m.roots[k*step]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+			}
+		}
+	}
+}
+
+// huffTree is a codebook as a binary tree. A node holds its two children,
+// a leaf is stored in its parent as -1-index of the codeword.
+type huffTree [][2]int32
+
+func newHuffTree(codes []aacCode) huffTree {
+	tree := huffTree{{}}
+
+	for i, c := range codes {
+		node := 0
+
+		for bit := int(c.bits) - 1; bit > 0; bit-- {
+			side := c.code >> bit & 1
+
+			if tree[node][side] == 0 {
+				tree = append(tree, [2]int32{})
+				tree[node][side] = int32(len(tree) - 1)
+			}
+
+			node = int(tree[node][side])
+		}
+
+		tree[node][c.code&1] = int32(-1 - i)
+	}
+
+	return tree
+}
+
+func newSpectralTrees() [11]huffTree {
+	var trees [11]huffTree
+
+	for i, codes := range aacSpectralCodes {
+		trees[i] = newHuffTree(codes)
+	}
+
+	return trees
+}
+
+func (t huffTree) decode(b *bitReader) (int, error) {
+	node := int32(0)
+
+	for {
+		node = t[node][b.read(1)]
+
+		if node < 0 {
+			return int(-1 - node), nil
+		}
+
+		if node == 0 {
+			return 0, errAACFrame
+		}
+	}
+}
+
+// bitReader reads MSB first. Past the end of the data it reads zeros and
+// reports the overrun.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitReader) read(n int) uint32 {
+	var v uint32
+
+	for i := 0; i < n; i++ {
+		v <<= 1
+
+		if at := b.pos >> 3; at < len(b.data) {
+			v |= uint32(b.data[at]>>(7-b.pos&7)) & 1
+		}
+
+		b.pos++
+	}
+
+	return v
+}
+
+func (b *bitReader) skip(n int) {
+	b.pos += n
+}
+
+func (b *bitReader) align() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+func (b *bitReader) overrun() bool {
+	return b.pos > len(b.data)*8
+}
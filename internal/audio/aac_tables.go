@@ -0,0 +1,299 @@
+package audio
+
+// Tables of ISO/IEC 14496-3 used by the AAC decoder.
+
+// aacSampleRates are the sampling frequencies by samplingFrequencyIndex.
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+var (
+	swbOffsetLong96 = []uint16{
+		0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 64, 72, 80, 88, 96, 108,
+		120, 132, 144, 156, 172, 188, 212, 240, 276, 320, 384, 448, 512, 576, 640, 704,
+		768, 832, 896, 960, 1024,
+	}
+	swbOffsetLong64 = []uint16{
+		0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 64, 72, 80, 88, 100, 112,
+		124, 140, 156, 172, 192, 216, 240, 268, 304, 344, 384, 424, 464, 504, 544, 584,
+		624, 664, 704, 744, 784, 824, 864, 904, 944, 984, 1024,
+	}
+	swbOffsetLong48 = []uint16{
+		0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 48, 56, 64, 72, 80, 88, 96, 108, 120, 132,
+		144, 160, 176, 196, 216, 240, 264, 292, 320, 352, 384, 416, 448, 480, 512, 544,
+		576, 608, 640, 672, 704, 736, 768, 800, 832, 864, 896, 928, 1024,
+	}
+	swbOffsetLong32 = []uint16{
+		0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 48, 56, 64, 72, 80, 88, 96, 108, 120, 132,
+		144, 160, 176, 196, 216, 240, 264, 292, 320, 352, 384, 416, 448, 480, 512, 544,
+		576, 608, 640, 672, 704, 736, 768, 800, 832, 864, 896, 928, 960, 992, 1024,
+	}
+	swbOffsetLong24 = []uint16{
+		0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 52, 60, 68, 76, 84, 92, 100, 108, 116,
+		124, 136, 148, 160, 172, 188, 204, 220, 240, 260, 284, 308, 336, 364, 396, 432,
+		468, 508, 552, 600, 652, 704, 768, 832, 896, 960, 1024,
+	}
+	swbOffsetLong16 = []uint16{
+		0, 8, 16, 24, 32, 40, 48, 56, 64, 72, 80, 88, 100, 112, 124, 136, 148, 160, 172,
+		184, 196, 212, 228, 244, 260, 280, 300, 320, 344, 368, 396, 424, 456, 492, 532,
+		572, 616, 664, 716, 772, 832, 896, 960, 1024,
+	}
+	swbOffsetLong8 = []uint16{
+		0, 12, 24, 36, 48, 60, 72, 84, 96, 108, 120, 132, 144, 156, 172, 188, 204, 220,
+		236, 252, 268, 288, 308, 328, 348, 372, 396, 420, 448, 476, 508, 544, 580, 620,
+		664, 712, 764, 820, 880, 944, 1024,
+	}
+
+	swbOffsetShort96 = []uint16{0, 4, 8, 12, 16, 20, 24, 32, 40, 48, 64, 92, 128}
+	swbOffsetShort48 = []uint16{0, 4, 8, 12, 16, 20, 28, 36, 44, 56, 68, 80, 96, 112, 128}
+	swbOffsetShort24 = []uint16{0, 4, 8, 12, 16, 20, 24, 28, 36, 44, 52, 64, 76, 92, 108, 128}
+	swbOffsetShort16 = []uint16{0, 4, 8, 12, 16, 20, 24, 28, 32, 40, 48, 60, 72, 88, 108, 128}
+	swbOffsetShort8  = []uint16{0, 4, 8, 12, 16, 20, 24, 28, 36, 44, 52, 60, 72, 88, 108, 128}
+)
+
+// aacSWBOffsetLong and aacSWBOffsetShort are the scalefactor band edges of
+// long and short windows by samplingFrequencyIndex.
+var (
+	aacSWBOffsetLong = [][]uint16{
+		swbOffsetLong96, swbOffsetLong96, swbOffsetLong64, swbOffsetLong48, swbOffsetLong48, swbOffsetLong32,
+		swbOffsetLong24, swbOffsetLong24, swbOffsetLong16, swbOffsetLong16, swbOffsetLong16, swbOffsetLong8,
+		swbOffsetLong8,
+	}
+	aacSWBOffsetShort = [][]uint16{
+		swbOffsetShort96, swbOffsetShort96, swbOffsetShort96, swbOffsetShort48, swbOffsetShort48, swbOffsetShort48,
+		swbOffsetShort24, swbOffsetShort24, swbOffsetShort16, swbOffsetShort16, swbOffsetShort16, swbOffsetShort8,
+		swbOffsetShort8,
+	}
+)
+
+// aacTNSMaxBandsLong and aacTNSMaxBandsShort limit TNS filtering of the
+// Low Complexity profile by samplingFrequencyIndex.
+var (
+	aacTNSMaxBandsLong  = []int{31, 31, 34, 40, 42, 51, 46, 46, 42, 42, 42, 39, 39}
+	aacTNSMaxBandsShort = []int{9, 9, 10, 14, 14, 14, 14, 14, 14, 14, 14, 14, 14}
+)
+
+type aacCode struct {
+	bits uint8
+	code uint32
+}
+
+// aacSpectralCodes are the spectral Huffman codebooks 1 to 11 in the order
+// of their codeword index.
+var aacSpectralCodes = [11][]aacCode{
+	// 1
+	{
+		{11, 0x7f8}, {9, 0x1f1}, {11, 0x7fd}, {10, 0x3f5}, {7, 0x68}, {10, 0x3f0}, {11, 0x7f7}, {9, 0x1ec},
+		{11, 0x7f5}, {10, 0x3f1}, {7, 0x72}, {10, 0x3f4}, {7, 0x74}, {5, 0x11}, {7, 0x76}, {9, 0x1eb},
+		{7, 0x6c}, {10, 0x3f6}, {11, 0x7fc}, {9, 0x1e1}, {11, 0x7f1}, {9, 0x1f0}, {7, 0x61}, {9, 0x1f6},
+		{11, 0x7f2}, {9, 0x1ea}, {11, 0x7fb}, {9, 0x1f2}, {7, 0x69}, {9, 0x1ed}, {7, 0x77}, {5, 0x17},
+		{7, 0x6f}, {9, 0x1e6}, {7, 0x64}, {9, 0x1e5}, {7, 0x67}, {5, 0x15}, {7, 0x62}, {5, 0x12},
+		{1, 0x0}, {5, 0x14}, {7, 0x65}, {5, 0x16}, {7, 0x6d}, {9, 0x1e9}, {7, 0x63}, {9, 0x1e4},
+		{7, 0x6b}, {5, 0x13}, {7, 0x71}, {9, 0x1e3}, {7, 0x70}, {9, 0x1f3}, {11, 0x7fe}, {9, 0x1e7},
+		{11, 0x7f3}, {9, 0x1ef}, {7, 0x60}, {9, 0x1ee}, {11, 0x7f0}, {9, 0x1e2}, {11, 0x7fa}, {10, 0x3f3},
+		{7, 0x6a}, {9, 0x1e8}, {7, 0x75}, {5, 0x10}, {7, 0x73}, {9, 0x1f4}, {7, 0x6e}, {10, 0x3f7},
+		{11, 0x7f6}, {9, 0x1e0}, {11, 0x7f9}, {10, 0x3f2}, {7, 0x66}, {9, 0x1f5}, {11, 0x7ff}, {9, 0x1f7},
+		{11, 0x7f4},
+	},
+	// 2
+	{
+		{9, 0x1f3}, {7, 0x6f}, {9, 0x1fd}, {8, 0xeb}, {6, 0x23}, {8, 0xea}, {9, 0x1f7}, {8, 0xe8},
+		{9, 0x1fa}, {8, 0xf2}, {6, 0x2d}, {7, 0x70}, {6, 0x20}, {5, 0x6}, {6, 0x2b}, {7, 0x6e},
+		{6, 0x28}, {8, 0xe9}, {9, 0x1f9}, {7, 0x66}, {8, 0xf8}, {8, 0xe7}, {6, 0x1b}, {8, 0xf1},
+		{9, 0x1f4}, {7, 0x6b}, {9, 0x1f5}, {8, 0xec}, {6, 0x2a}, {7, 0x6c}, {6, 0x2c}, {5, 0xa},
+		{6, 0x27}, {7, 0x67}, {6, 0x1a}, {8, 0xf5}, {6, 0x24}, {5, 0x8}, {6, 0x1f}, {5, 0x9},
+		{3, 0x0}, {5, 0x7}, {6, 0x1d}, {5, 0xb}, {6, 0x30}, {8, 0xef}, {6, 0x1c}, {7, 0x64},
+		{6, 0x1e}, {5, 0xc}, {6, 0x29}, {8, 0xf3}, {6, 0x2f}, {8, 0xf0}, {9, 0x1fc}, {7, 0x71},
+		{9, 0x1f2}, {8, 0xf4}, {6, 0x21}, {8, 0xe6}, {8, 0xf7}, {7, 0x68}, {9, 0x1f8}, {8, 0xee},
+		{6, 0x22}, {7, 0x65}, {6, 0x31}, {4, 0x2}, {6, 0x26}, {8, 0xed}, {6, 0x25}, {7, 0x6a},
+		{9, 0x1fb}, {7, 0x72}, {9, 0x1fe}, {7, 0x69}, {6, 0x2e}, {8, 0xf6}, {9, 0x1ff}, {7, 0x6d},
+		{9, 0x1f6},
+	},
+	// 3
+	{
+		{1, 0x0}, {4, 0x9}, {8, 0xef}, {4, 0xb}, {5, 0x19}, {8, 0xf0}, {9, 0x1eb}, {9, 0x1e6},
+		{10, 0x3f2}, {4, 0xa}, {6, 0x35}, {9, 0x1ef}, {6, 0x34}, {6, 0x37}, {9, 0x1e9}, {9, 0x1ed},
+		{9, 0x1e7}, {10, 0x3f3}, {9, 0x1ee}, {10, 0x3ed}, {13, 0x1ffa}, {9, 0x1ec}, {9, 0x1f2}, {11, 0x7f9},
+		{11, 0x7f8}, {10, 0x3f8}, {12, 0xff8}, {4, 0x8}, {6, 0x38}, {10, 0x3f6}, {6, 0x36}, {7, 0x75},
+		{10, 0x3f1}, {10, 0x3eb}, {10, 0x3ec}, {12, 0xff4}, {5, 0x18}, {7, 0x76}, {11, 0x7f4}, {6, 0x39},
+		{7, 0x74}, {10, 0x3ef}, {9, 0x1f3}, {9, 0x1f4}, {11, 0x7f6}, {9, 0x1e8}, {10, 0x3ea}, {13, 0x1ffc},
+		{8, 0xf2}, {9, 0x1f1}, {12, 0xffb}, {10, 0x3f5}, {11, 0x7f3}, {12, 0xffc}, {8, 0xee}, {10, 0x3f7},
+		{15, 0x7ffe}, {9, 0x1f0}, {11, 0x7f5}, {15, 0x7ffd}, {13, 0x1ffb}, {14, 0x3ffa}, {16, 0xffff}, {8, 0xf1},
+		{10, 0x3f0}, {14, 0x3ffc}, {9, 0x1ea}, {10, 0x3ee}, {14, 0x3ffb}, {12, 0xff6}, {12, 0xffa}, {15, 0x7ffc},
+		{11, 0x7f2}, {12, 0xff5}, {16, 0xfffe}, {10, 0x3f4}, {11, 0x7f7}, {15, 0x7ffb}, {12, 0xff7}, {12, 0xff9},
+		{15, 0x7ffa},
+	},
+	// 4
+	{
+		{4, 0x7}, {5, 0x16}, {8, 0xf6}, {5, 0x18}, {4, 0x8}, {8, 0xef}, {9, 0x1ef}, {8, 0xf3},
+		{11, 0x7f8}, {5, 0x19}, {5, 0x17}, {8, 0xed}, {5, 0x15}, {4, 0x1}, {8, 0xe2}, {8, 0xf0},
+		{7, 0x70}, {10, 0x3f0}, {9, 0x1ee}, {8, 0xf1}, {11, 0x7fa}, {8, 0xee}, {8, 0xe4}, {10, 0x3f2},
+		{11, 0x7f6}, {10, 0x3ef}, {11, 0x7fd}, {4, 0x5}, {5, 0x14}, {8, 0xf2}, {4, 0x9}, {4, 0x4},
+		{8, 0xe5}, {8, 0xf4}, {8, 0xe8}, {10, 0x3f4}, {4, 0x6}, {4, 0x2}, {8, 0xe7}, {4, 0x3},
+		{4, 0x0}, {7, 0x6b}, {8, 0xe3}, {7, 0x69}, {9, 0x1f3}, {8, 0xeb}, {8, 0xe6}, {10, 0x3f6},
+		{7, 0x6e}, {7, 0x6a}, {9, 0x1f4}, {10, 0x3ec}, {9, 0x1f0}, {10, 0x3f9}, {8, 0xf5}, {8, 0xec},
+		{11, 0x7fb}, {8, 0xea}, {7, 0x6f}, {10, 0x3f7}, {11, 0x7f9}, {10, 0x3f3}, {12, 0xfff}, {8, 0xe9},
+		{7, 0x6d}, {10, 0x3f8}, {7, 0x6c}, {7, 0x68}, {9, 0x1f5}, {10, 0x3ee}, {9, 0x1f2}, {11, 0x7f4},
+		{11, 0x7f7}, {10, 0x3f1}, {12, 0xffe}, {10, 0x3ed}, {9, 0x1f1}, {11, 0x7f5}, {11, 0x7fe}, {10, 0x3f5},
+		{11, 0x7fc},
+	},
+	// 5
+	{
+		{13, 0x1fff}, {12, 0xff7}, {11, 0x7f4}, {11, 0x7e8}, {10, 0x3f1}, {11, 0x7ee}, {11, 0x7f9}, {12, 0xff8},
+		{13, 0x1ffd}, {12, 0xffd}, {11, 0x7f1}, {10, 0x3e8}, {9, 0x1e8}, {8, 0xf0}, {9, 0x1ec}, {10, 0x3ee},
+		{11, 0x7f2}, {12, 0xffa}, {12, 0xff4}, {10, 0x3ef}, {9, 0x1f2}, {8, 0xe8}, {7, 0x70}, {8, 0xec},
+		{9, 0x1f0}, {10, 0x3ea}, {11, 0x7f3}, {11, 0x7eb}, {9, 0x1eb}, {8, 0xea}, {5, 0x1a}, {4, 0x8},
+		{5, 0x19}, {8, 0xee}, {9, 0x1ef}, {11, 0x7ed}, {10, 0x3f0}, {8, 0xf2}, {7, 0x73}, {4, 0xb},
+		{1, 0x0}, {4, 0xa}, {7, 0x71}, {8, 0xf3}, {11, 0x7e9}, {11, 0x7ef}, {9, 0x1ee}, {8, 0xef},
+		{5, 0x18}, {4, 0x9}, {5, 0x1b}, {8, 0xeb}, {9, 0x1e9}, {11, 0x7ec}, {11, 0x7f6}, {10, 0x3eb},
+		{9, 0x1f3}, {8, 0xed}, {7, 0x72}, {8, 0xe9}, {9, 0x1f1}, {10, 0x3ed}, {11, 0x7f7}, {12, 0xff6},
+		{11, 0x7f0}, {10, 0x3e9}, {9, 0x1ed}, {8, 0xf1}, {9, 0x1ea}, {10, 0x3ec}, {11, 0x7f8}, {12, 0xff9},
+		{13, 0x1ffc}, {12, 0xffc}, {12, 0xff5}, {11, 0x7ea}, {10, 0x3f3}, {10, 0x3f2}, {11, 0x7f5}, {12, 0xffb},
+		{13, 0x1ffe},
+	},
+	// 6
+	{
+		{11, 0x7fe}, {10, 0x3fd}, {9, 0x1f1}, {9, 0x1eb}, {9, 0x1f4}, {9, 0x1ea}, {9, 0x1f0}, {10, 0x3fc},
+		{11, 0x7fd}, {10, 0x3f6}, {9, 0x1e5}, {8, 0xea}, {7, 0x6c}, {7, 0x71}, {7, 0x68}, {8, 0xf0},
+		{9, 0x1e6}, {10, 0x3f7}, {9, 0x1f3}, {8, 0xef}, {6, 0x32}, {6, 0x27}, {6, 0x28}, {6, 0x26},
+		{6, 0x31}, {8, 0xeb}, {9, 0x1f7}, {9, 0x1e8}, {7, 0x6f}, {6, 0x2e}, {4, 0x8}, {4, 0x4},
+		{4, 0x6}, {6, 0x29}, {7, 0x6b}, {9, 0x1ee}, {9, 0x1ef}, {7, 0x72}, {6, 0x2d}, {4, 0x2},
+		{4, 0x0}, {4, 0x3}, {6, 0x2f}, {7, 0x73}, {9, 0x1fa}, {9, 0x1e7}, {7, 0x6e}, {6, 0x2b},
+		{4, 0x7}, {4, 0x1}, {4, 0x5}, {6, 0x2c}, {7, 0x6d}, {9, 0x1ec}, {9, 0x1f9}, {8, 0xee},
+		{6, 0x30}, {6, 0x24}, {6, 0x2a}, {6, 0x25}, {6, 0x33}, {8, 0xec}, {9, 0x1f2}, {10, 0x3f8},
+		{9, 0x1e4}, {8, 0xed}, {7, 0x6a}, {7, 0x70}, {7, 0x69}, {7, 0x74}, {8, 0xf1}, {10, 0x3fa},
+		{11, 0x7ff}, {10, 0x3f9}, {9, 0x1f6}, {9, 0x1ed}, {9, 0x1f8}, {9, 0x1e9}, {9, 0x1f5}, {10, 0x3fb},
+		{11, 0x7fc},
+	},
+	// 7
+	{
+		{1, 0x0}, {3, 0x5}, {6, 0x37}, {7, 0x74}, {8, 0xf2}, {9, 0x1eb}, {10, 0x3ed}, {11, 0x7f7},
+		{3, 0x4}, {4, 0xc}, {6, 0x35}, {7, 0x71}, {8, 0xec}, {8, 0xee}, {9, 0x1ee}, {9, 0x1f5},
+		{6, 0x36}, {6, 0x34}, {7, 0x72}, {8, 0xea}, {8, 0xf1}, {9, 0x1e9}, {9, 0x1f3}, {10, 0x3f5},
+		{7, 0x73}, {7, 0x70}, {8, 0xeb}, {8, 0xf0}, {9, 0x1f1}, {9, 0x1f0}, {10, 0x3ec}, {10, 0x3fa},
+		{8, 0xf3}, {8, 0xed}, {9, 0x1e8}, {9, 0x1ef}, {10, 0x3ef}, {10, 0x3f1}, {10, 0x3f9}, {11, 0x7fb},
+		{9, 0x1ed}, {8, 0xef}, {9, 0x1ea}, {9, 0x1f2}, {10, 0x3f3}, {10, 0x3f8}, {11, 0x7f9}, {11, 0x7fc},
+		{10, 0x3ee}, {9, 0x1ec}, {9, 0x1f4}, {10, 0x3f4}, {10, 0x3f7}, {11, 0x7f8}, {12, 0xffd}, {12, 0xffe},
+		{11, 0x7f6}, {10, 0x3f0}, {10, 0x3f2}, {10, 0x3f6}, {11, 0x7fa}, {11, 0x7fd}, {12, 0xffc}, {12, 0xfff},
+	},
+	// 8
+	{
+		{5, 0xe}, {4, 0x5}, {5, 0x10}, {6, 0x30}, {7, 0x6f}, {8, 0xf1}, {9, 0x1fa}, {10, 0x3fe},
+		{4, 0x3}, {3, 0x0}, {4, 0x4}, {5, 0x12}, {6, 0x2c}, {7, 0x6a}, {7, 0x75}, {8, 0xf8},
+		{5, 0xf}, {4, 0x2}, {4, 0x6}, {5, 0x14}, {6, 0x2e}, {7, 0x69}, {7, 0x72}, {8, 0xf5},
+		{6, 0x2f}, {5, 0x11}, {5, 0x13}, {6, 0x2a}, {6, 0x32}, {7, 0x6c}, {8, 0xec}, {8, 0xfa},
+		{7, 0x71}, {6, 0x2b}, {6, 0x2d}, {6, 0x31}, {7, 0x6d}, {7, 0x70}, {8, 0xf2}, {9, 0x1f9},
+		{8, 0xef}, {7, 0x68}, {6, 0x33}, {7, 0x6b}, {7, 0x6e}, {8, 0xee}, {8, 0xf9}, {10, 0x3fc},
+		{9, 0x1f8}, {7, 0x74}, {7, 0x73}, {8, 0xed}, {8, 0xf0}, {8, 0xf6}, {9, 0x1f6}, {9, 0x1fd},
+		{10, 0x3fd}, {8, 0xf3}, {8, 0xf4}, {8, 0xf7}, {9, 0x1f7}, {9, 0x1fb}, {9, 0x1fc}, {10, 0x3ff},
+	},
+	// 9
+	{
+		{1, 0x0}, {3, 0x5}, {6, 0x37}, {8, 0xe7}, {9, 0x1de}, {10, 0x3ce}, {10, 0x3d9}, {11, 0x7c8},
+		{11, 0x7cd}, {12, 0xfc8}, {12, 0xfdd}, {13, 0x1fe4}, {13, 0x1fec}, {3, 0x4}, {4, 0xc}, {6, 0x35},
+		{7, 0x72}, {8, 0xea}, {8, 0xed}, {9, 0x1e2}, {10, 0x3d1}, {10, 0x3d3}, {10, 0x3e0}, {11, 0x7d8},
+		{12, 0xfcf}, {12, 0xfd5}, {6, 0x36}, {6, 0x34}, {7, 0x71}, {8, 0xe8}, {8, 0xec}, {9, 0x1e1},
+		{10, 0x3cf}, {10, 0x3dd}, {10, 0x3db}, {11, 0x7d0}, {12, 0xfc7}, {12, 0xfd4}, {12, 0xfe4}, {8, 0xe6},
+		{7, 0x70}, {8, 0xe9}, {9, 0x1dd}, {9, 0x1e3}, {10, 0x3d2}, {10, 0x3dc}, {11, 0x7cc}, {11, 0x7ca},
+		{11, 0x7de}, {12, 0xfd8}, {12, 0xfea}, {13, 0x1fdb}, {9, 0x1df}, {8, 0xeb}, {9, 0x1dc}, {9, 0x1e6},
+		{10, 0x3d5}, {10, 0x3de}, {11, 0x7cb}, {11, 0x7dd}, {11, 0x7dc}, {12, 0xfcd}, {12, 0xfe2}, {12, 0xfe7},
+		{13, 0x1fe1}, {10, 0x3d0}, {9, 0x1e0}, {9, 0x1e4}, {10, 0x3d6}, {11, 0x7c5}, {11, 0x7d1}, {11, 0x7db},
+		{12, 0xfd2}, {11, 0x7e0}, {12, 0xfd9}, {12, 0xfeb}, {13, 0x1fe3}, {13, 0x1fe9}, {11, 0x7c4}, {9, 0x1e5},
+		{10, 0x3d7}, {11, 0x7c6}, {11, 0x7cf}, {11, 0x7da}, {12, 0xfcb}, {12, 0xfda}, {12, 0xfe3}, {12, 0xfe9},
+		{13, 0x1fe6}, {13, 0x1ff3}, {13, 0x1ff7}, {11, 0x7d3}, {10, 0x3d8}, {10, 0x3e1}, {11, 0x7d4}, {11, 0x7d9},
+		{12, 0xfd3}, {12, 0xfde}, {13, 0x1fdd}, {13, 0x1fd9}, {13, 0x1fe2}, {13, 0x1fea}, {13, 0x1ff1}, {13, 0x1ff6},
+		{11, 0x7d2}, {10, 0x3d4}, {10, 0x3da}, {11, 0x7c7}, {11, 0x7d7}, {11, 0x7e2}, {12, 0xfce}, {12, 0xfdb},
+		{13, 0x1fd8}, {13, 0x1fee}, {14, 0x3ff0}, {13, 0x1ff4}, {14, 0x3ff2}, {11, 0x7e1}, {10, 0x3df}, {11, 0x7c9},
+		{11, 0x7d6}, {12, 0xfca}, {12, 0xfd0}, {12, 0xfe5}, {12, 0xfe6}, {13, 0x1feb}, {13, 0x1fef}, {14, 0x3ff3},
+		{14, 0x3ff4}, {14, 0x3ff5}, {12, 0xfe0}, {11, 0x7ce}, {11, 0x7d5}, {12, 0xfc6}, {12, 0xfd1}, {12, 0xfe1},
+		{13, 0x1fe0}, {13, 0x1fe8}, {13, 0x1ff0}, {14, 0x3ff1}, {14, 0x3ff8}, {14, 0x3ff6}, {15, 0x7ffc}, {12, 0xfe8},
+		{11, 0x7df}, {12, 0xfc9}, {12, 0xfd7}, {12, 0xfdc}, {13, 0x1fdc}, {13, 0x1fdf}, {13, 0x1fed}, {13, 0x1ff5},
+		{14, 0x3ff9}, {14, 0x3ffb}, {15, 0x7ffd}, {15, 0x7ffe}, {13, 0x1fe7}, {12, 0xfcc}, {12, 0xfd6}, {12, 0xfdf},
+		{13, 0x1fde}, {13, 0x1fda}, {13, 0x1fe5}, {13, 0x1ff2}, {14, 0x3ffa}, {14, 0x3ff7}, {14, 0x3ffc}, {14, 0x3ffd},
+		{15, 0x7fff},
+	},
+	// 10
+	{
+		{6, 0x22}, {5, 0x8}, {6, 0x1d}, {6, 0x26}, {7, 0x5f}, {8, 0xd3}, {9, 0x1cf}, {10, 0x3d0},
+		{10, 0x3d7}, {10, 0x3ed}, {11, 0x7f0}, {11, 0x7f6}, {12, 0xffd}, {5, 0x7}, {4, 0x0}, {4, 0x1},
+		{5, 0x9}, {6, 0x20}, {7, 0x54}, {7, 0x60}, {8, 0xd5}, {8, 0xdc}, {9, 0x1d4}, {10, 0x3cd},
+		{10, 0x3de}, {11, 0x7e7}, {6, 0x1c}, {4, 0x2}, {5, 0x6}, {5, 0xc}, {6, 0x1e}, {6, 0x28},
+		{7, 0x5b}, {8, 0xcd}, {8, 0xd9}, {9, 0x1ce}, {9, 0x1dc}, {10, 0x3d9}, {10, 0x3f1}, {6, 0x25},
+		{5, 0xb}, {5, 0xa}, {5, 0xd}, {6, 0x24}, {7, 0x57}, {7, 0x61}, {8, 0xcc}, {8, 0xdd},
+		{9, 0x1cc}, {9, 0x1de}, {10, 0x3d3}, {10, 0x3e7}, {7, 0x5d}, {6, 0x21}, {6, 0x1f}, {6, 0x23},
+		{6, 0x27}, {7, 0x59}, {7, 0x64}, {8, 0xd8}, {8, 0xdf}, {9, 0x1d2}, {9, 0x1e2}, {10, 0x3dd},
+		{10, 0x3ee}, {8, 0xd1}, {7, 0x55}, {6, 0x29}, {7, 0x56}, {7, 0x58}, {7, 0x62}, {8, 0xce},
+		{8, 0xe0}, {8, 0xe2}, {9, 0x1da}, {10, 0x3d4}, {10, 0x3e3}, {11, 0x7eb}, {9, 0x1c9}, {7, 0x5e},
+		{7, 0x5a}, {7, 0x5c}, {7, 0x63}, {8, 0xca}, {8, 0xda}, {9, 0x1c7}, {9, 0x1ca}, {9, 0x1e0},
+		{10, 0x3db}, {10, 0x3e8}, {11, 0x7ec}, {9, 0x1e3}, {8, 0xd2}, {8, 0xcb}, {8, 0xd0}, {8, 0xd7},
+		{8, 0xdb}, {9, 0x1c6}, {9, 0x1d5}, {9, 0x1d8}, {10, 0x3ca}, {10, 0x3da}, {11, 0x7ea}, {11, 0x7f1},
+		{9, 0x1e1}, {8, 0xd4}, {8, 0xcf}, {8, 0xd6}, {8, 0xde}, {8, 0xe1}, {9, 0x1d0}, {9, 0x1d6},
+		{10, 0x3d1}, {10, 0x3d5}, {10, 0x3f2}, {11, 0x7ee}, {11, 0x7fb}, {10, 0x3e9}, {9, 0x1cd}, {9, 0x1c8},
+		{9, 0x1cb}, {9, 0x1d1}, {9, 0x1d7}, {9, 0x1df}, {10, 0x3cf}, {10, 0x3e0}, {10, 0x3ef}, {11, 0x7e6},
+		{11, 0x7f8}, {12, 0xffa}, {10, 0x3eb}, {9, 0x1dd}, {9, 0x1d3}, {9, 0x1d9}, {9, 0x1db}, {10, 0x3d2},
+		{10, 0x3cc}, {10, 0x3dc}, {10, 0x3ea}, {11, 0x7ed}, {11, 0x7f3}, {11, 0x7f9}, {12, 0xff9}, {11, 0x7f2},
+		{10, 0x3ce}, {9, 0x1e4}, {10, 0x3cb}, {10, 0x3d8}, {10, 0x3d6}, {10, 0x3e2}, {10, 0x3e5}, {11, 0x7e8},
+		{11, 0x7f4}, {11, 0x7f5}, {11, 0x7f7}, {12, 0xffb}, {11, 0x7fa}, {10, 0x3ec}, {10, 0x3df}, {10, 0x3e1},
+		{10, 0x3e4}, {10, 0x3e6}, {10, 0x3f0}, {11, 0x7e9}, {11, 0x7ef}, {12, 0xff8}, {12, 0xffe}, {12, 0xffc},
+		{12, 0xfff},
+	},
+	// 11
+	{
+		{4, 0x0}, {5, 0x6}, {6, 0x19}, {7, 0x3d}, {8, 0x9c}, {8, 0xc6}, {9, 0x1a7}, {10, 0x390},
+		{10, 0x3c2}, {10, 0x3df}, {11, 0x7e6}, {11, 0x7f3}, {12, 0xffb}, {11, 0x7ec}, {12, 0xffa}, {12, 0xffe},
+		{10, 0x38e}, {5, 0x5}, {4, 0x1}, {5, 0x8}, {6, 0x14}, {7, 0x37}, {7, 0x42}, {8, 0x92},
+		{8, 0xaf}, {9, 0x191}, {9, 0x1a5}, {9, 0x1b5}, {10, 0x39e}, {10, 0x3c0}, {10, 0x3a2}, {10, 0x3cd},
+		{11, 0x7d6}, {8, 0xae}, {6, 0x17}, {5, 0x7}, {5, 0x9}, {6, 0x18}, {7, 0x39}, {7, 0x40},
+		{8, 0x8e}, {8, 0xa3}, {8, 0xb8}, {9, 0x199}, {9, 0x1ac}, {9, 0x1c1}, {10, 0x3b1}, {10, 0x396},
+		{10, 0x3be}, {10, 0x3ca}, {8, 0x9d}, {7, 0x3c}, {6, 0x15}, {6, 0x16}, {6, 0x1a}, {7, 0x3b},
+		{7, 0x44}, {8, 0x91}, {8, 0xa5}, {8, 0xbe}, {9, 0x196}, {9, 0x1ae}, {9, 0x1b9}, {10, 0x3a1},
+		{10, 0x391}, {10, 0x3a5}, {10, 0x3d5}, {8, 0x94}, {8, 0x9a}, {7, 0x36}, {7, 0x38}, {7, 0x3a},
+		{7, 0x41}, {8, 0x8c}, {8, 0x9b}, {8, 0xb0}, {8, 0xc3}, {9, 0x19e}, {9, 0x1ab}, {9, 0x1bc},
+		{10, 0x39f}, {10, 0x38f}, {10, 0x3a9}, {10, 0x3cf}, {8, 0x93}, {8, 0xbf}, {7, 0x3e}, {7, 0x3f},
+		{7, 0x43}, {7, 0x45}, {8, 0x9e}, {8, 0xa7}, {8, 0xb9}, {9, 0x194}, {9, 0x1a2}, {9, 0x1ba},
+		{9, 0x1c3}, {10, 0x3a6}, {10, 0x3a7}, {10, 0x3bb}, {10, 0x3d4}, {8, 0x9f}, {9, 0x1a0}, {8, 0x8f},
+		{8, 0x8d}, {8, 0x90}, {8, 0x98}, {8, 0xa6}, {8, 0xb6}, {8, 0xc4}, {9, 0x19f}, {9, 0x1af},
+		{9, 0x1bf}, {10, 0x399}, {10, 0x3bf}, {10, 0x3b4}, {10, 0x3c9}, {10, 0x3e7}, {8, 0xa8}, {9, 0x1b6},
+		{8, 0xab}, {8, 0xa4}, {8, 0xaa}, {8, 0xb2}, {8, 0xc2}, {8, 0xc5}, {9, 0x198}, {9, 0x1a4},
+		{9, 0x1b8}, {10, 0x38c}, {10, 0x3a4}, {10, 0x3c4}, {10, 0x3c6}, {10, 0x3dd}, {10, 0x3e8}, {8, 0xad},
+		{10, 0x3af}, {9, 0x192}, {8, 0xbd}, {8, 0xbc}, {9, 0x18e}, {9, 0x197}, {9, 0x19a}, {9, 0x1a3},
+		{9, 0x1b1}, {10, 0x38d}, {10, 0x398}, {10, 0x3b7}, {10, 0x3d3}, {10, 0x3d1}, {10, 0x3db}, {11, 0x7dd},
+		{8, 0xb4}, {10, 0x3de}, {9, 0x1a9}, {9, 0x19b}, {9, 0x19c}, {9, 0x1a1}, {9, 0x1aa}, {9, 0x1ad},
+		{9, 0x1b3}, {10, 0x38b}, {10, 0x3b2}, {10, 0x3b8}, {10, 0x3ce}, {10, 0x3e1}, {10, 0x3e0}, {11, 0x7d2},
+		{11, 0x7e5}, {8, 0xb7}, {11, 0x7e3}, {9, 0x1bb}, {9, 0x1a8}, {9, 0x1a6}, {9, 0x1b0}, {9, 0x1b2},
+		{9, 0x1b7}, {10, 0x39b}, {10, 0x39a}, {10, 0x3ba}, {10, 0x3b5}, {10, 0x3d6}, {11, 0x7d7}, {10, 0x3e4},
+		{11, 0x7d8}, {11, 0x7ea}, {8, 0xba}, {11, 0x7e8}, {10, 0x3a0}, {9, 0x1bd}, {9, 0x1b4}, {10, 0x38a},
+		{9, 0x1c4}, {10, 0x392}, {10, 0x3aa}, {10, 0x3b0}, {10, 0x3bc}, {10, 0x3d7}, {11, 0x7d4}, {11, 0x7dc},
+		{11, 0x7db}, {11, 0x7d5}, {11, 0x7f0}, {8, 0xc1}, {11, 0x7fb}, {10, 0x3c8}, {10, 0x3a3}, {10, 0x395},
+		{10, 0x39d}, {10, 0x3ac}, {10, 0x3ae}, {10, 0x3c5}, {10, 0x3d8}, {10, 0x3e2}, {10, 0x3e6}, {11, 0x7e4},
+		{11, 0x7e7}, {11, 0x7e0}, {11, 0x7e9}, {11, 0x7f7}, {9, 0x190}, {11, 0x7f2}, {10, 0x393}, {9, 0x1be},
+		{9, 0x1c0}, {10, 0x394}, {10, 0x397}, {10, 0x3ad}, {10, 0x3c3}, {10, 0x3c1}, {10, 0x3d2}, {11, 0x7da},
+		{11, 0x7d9}, {11, 0x7df}, {11, 0x7eb}, {11, 0x7f4}, {11, 0x7fa}, {9, 0x195}, {11, 0x7f8}, {10, 0x3bd},
+		{10, 0x39c}, {10, 0x3ab}, {10, 0x3a8}, {10, 0x3b3}, {10, 0x3b9}, {10, 0x3d0}, {10, 0x3e3}, {10, 0x3e5},
+		{11, 0x7e2}, {11, 0x7de}, {11, 0x7ed}, {11, 0x7f1}, {11, 0x7f9}, {11, 0x7fc}, {9, 0x193}, {12, 0xffd},
+		{10, 0x3dc}, {10, 0x3b6}, {10, 0x3c7}, {10, 0x3cc}, {10, 0x3cb}, {10, 0x3d9}, {10, 0x3da}, {11, 0x7d3},
+		{11, 0x7e1}, {11, 0x7ee}, {11, 0x7ef}, {11, 0x7f5}, {11, 0x7f6}, {12, 0xffc}, {12, 0xfff}, {9, 0x19d},
+		{9, 0x1c2}, {8, 0xb5}, {8, 0xa1}, {8, 0x96}, {8, 0x97}, {8, 0x95}, {8, 0x99}, {8, 0xa0},
+		{8, 0xa2}, {8, 0xac}, {8, 0xa9}, {8, 0xb1}, {8, 0xb3}, {8, 0xbb}, {8, 0xc0}, {9, 0x18f},
+		{5, 0x4},
+	},
+}
+
+// aacScalefactorCodes is the scalefactor Huffman codebook, index 60 codes a
+// difference of zero.
+var aacScalefactorCodes = []aacCode{
+	{18, 0x3ffe8}, {18, 0x3ffe6}, {18, 0x3ffe7}, {18, 0x3ffe5}, {19, 0x7fff5}, {19, 0x7fff1}, {19, 0x7ffed}, {19, 0x7fff6},
+	{19, 0x7ffee}, {19, 0x7ffef}, {19, 0x7fff0}, {19, 0x7fffc}, {19, 0x7fffd}, {19, 0x7ffff}, {19, 0x7fffe}, {19, 0x7fff7},
+	{19, 0x7fff8}, {19, 0x7fffb}, {19, 0x7fff9}, {18, 0x3ffe4}, {19, 0x7fffa}, {18, 0x3ffe3}, {17, 0x1ffef}, {17, 0x1fff0},
+	{16, 0xfff5}, {17, 0x1ffee}, {16, 0xfff2}, {16, 0xfff3}, {16, 0xfff4}, {16, 0xfff1}, {15, 0x7ff6}, {15, 0x7ff7},
+	{14, 0x3ff9}, {14, 0x3ff5}, {14, 0x3ff7}, {14, 0x3ff3}, {14, 0x3ff6}, {14, 0x3ff2}, {13, 0x1ff7}, {13, 0x1ff5},
+	{12, 0xff9}, {12, 0xff7}, {12, 0xff6}, {11, 0x7f9}, {12, 0xff4}, {11, 0x7f8}, {10, 0x3f9}, {10, 0x3f7},
+	{10, 0x3f5}, {9, 0x1f8}, {9, 0x1f7}, {8, 0xfa}, {8, 0xf8}, {8, 0xf6}, {7, 0x79}, {6, 0x3a},
+	{6, 0x38}, {5, 0x1a}, {4, 0xb}, {3, 0x4}, {1, 0x0}, {4, 0xa}, {4, 0xc}, {5, 0x1b},
+	{6, 0x39}, {6, 0x3b}, {7, 0x78}, {7, 0x7a}, {8, 0xf7}, {8, 0xf9}, {9, 0x1f6}, {9, 0x1f9},
+	{10, 0x3f4}, {10, 0x3f6}, {10, 0x3f8}, {11, 0x7f5}, {11, 0x7f4}, {11, 0x7f6}, {11, 0x7f7}, {12, 0xff5},
+	{12, 0xff8}, {13, 0x1ff4}, {13, 0x1ff6}, {13, 0x1ff8}, {14, 0x3ff8}, {14, 0x3ff4}, {16, 0xfff0}, {15, 0x7ff4},
+	{16, 0xfff6}, {15, 0x7ff5}, {18, 0x3ffe2}, {19, 0x7ffd9}, {19, 0x7ffda}, {19, 0x7ffdb}, {19, 0x7ffdc}, {19, 0x7ffdd},
+	{19, 0x7ffde}, {19, 0x7ffd8}, {19, 0x7ffd2}, {19, 0x7ffd3}, {19, 0x7ffd4}, {19, 0x7ffd5}, {19, 0x7ffd6}, {19, 0x7fff2},
+	{19, 0x7ffdf}, {19, 0x7ffe7}, {19, 0x7ffe8}, {19, 0x7ffe9}, {19, 0x7ffea}, {19, 0x7ffeb}, {19, 0x7ffe6}, {19, 0x7ffe0},
+	{19, 0x7ffe1}, {19, 0x7ffe2}, {19, 0x7ffe3}, {19, 0x7ffe4}, {19, 0x7ffe5}, {19, 0x7ffd7}, {19, 0x7ffec}, {19, 0x7fff4},
+	{19, 0x7fff3},
+}
@@ -0,0 +1,472 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// bitWriter is the MSB first counterpart of bitReader.
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos&7 == 0 {
+			w.data = append(w.data, 0)
+		}
+
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.pos&7)
+		w.pos++
+	}
+}
+
+func (w *bitWriter) code(c aacCode) {
+	w.write(uint32(c.code), int(c.bits))
+}
+
+func sineRise(n, i int) float64 {
+	return math.Sin(math.Pi / float64(2*n) * (float64(i) + 0.5))
+}
+
+// testWindow is the 2048 sample sine window of a long window sequence, per
+// ISO/IEC 14496-3 4.6.11.3.2.
+func testWindow(seq int) []float64 {
+	w := make([]float64, 2*aacFrameLength)
+
+	for i := 0; i < aacFrameLength; i++ {
+		w[i] = sineRise(aacFrameLength, i)
+		w[len(w)-1-i] = w[i]
+	}
+
+	if seq != windowLongStart && seq != windowLongStop {
+		return w
+	}
+
+	// The half next to the short windows of a start or stop window is flat,
+	// then falls like a short window and ends in zeros.
+	for i := 0; i < aacFrameLength; i++ {
+		var v float64
+
+		switch {
+		case i < 448:
+			v = 1
+		case i < 576:
+			v = sineRise(128, 575-i)
+		}
+
+		if seq == windowLongStart {
+			w[aacFrameLength+i] = v
+		} else {
+			w[aacFrameLength-1-i] = v
+		}
+	}
+
+	return w
+}
+
+// mdct is the forward transform of ISO/IEC 14496-3 4.6.11 of a windowed
+// block, computed the slow way.
+func mdct(block, window []float64) []float64 {
+	n := float64(len(block))
+	spec := make([]float64, len(block)/2)
+
+	for k := range spec {
+		var sum float64
+
+		for i, v := range block {
+			sum += window[i] * v * math.Cos(2*math.Pi/n*(float64(i)+(n/2+1)/2)*(float64(k)+0.5))
+		}
+
+		spec[k] = 2 * sum
+	}
+
+	return spec
+}
+
+// analyze transforms a block of 2048 samples into the spectrum of a frame
+// with the given window sequence.
+func analyze(seq int, block []float64) []float64 {
+	if seq != windowEightShort {
+		return mdct(block, testWindow(seq))
+	}
+
+	short := make([]float64, 256)
+
+	for i := 0; i < 128; i++ {
+		short[i] = sineRise(128, i)
+		short[255-i] = short[i]
+	}
+
+	var spec []float64
+
+	for w := 0; w < 8; w++ {
+		spec = append(spec, mdct(block[448+w*128:704+w*128], short)...)
+	}
+
+	return spec
+}
+
+// quantize picks the smallest global gain that keeps the quantized values
+// in the range of the escape codebook.
+func quantize(spec []float64) (int, []int) {
+	var peak float64
+
+	for _, v := range spec {
+		peak = math.Max(peak, math.Abs(v))
+	}
+
+	gain := 0
+
+	for peak > 0 && math.Pow(peak/math.Exp2(0.25*float64(gain-100)), 0.75) > 8191 {
+		gain++
+	}
+
+	quant := make([]int, len(spec))
+
+	for i, v := range spec {
+		q := int(math.Round(math.Pow(math.Abs(v)/math.Exp2(0.25*float64(gain-100)), 0.75)))
+		if v < 0 {
+			q = -q
+		}
+
+		quant[i] = q
+	}
+
+	return gain, quant
+}
+
+// writeICSInfo writes the ics_info of a 48 kHz frame with a sine window and
+// all scalefactor bands, every short window in a group of its own.
+func writeICSInfo(w *bitWriter, seq int) {
+	w.write(0, 1) // ics_reserved_bit
+	w.write(uint32(seq), 2)
+	w.write(0, 1)
+
+	if seq == windowEightShort {
+		w.write(uint32(len(aacSWBOffsetShort[3])-1), 4)
+		w.write(0, 7)
+	} else {
+		w.write(uint32(len(aacSWBOffsetLong[3])-1), 6)
+		w.write(0, 1) // predictor_data_present
+	}
+}
+
+// writeICS writes an individual_channel_stream with every band in the
+// escape codebook under one scalefactor.
+func writeICS(w *bitWriter, seq int, spec []float64, common bool) {
+	gain, quant := quantize(spec)
+
+	w.write(uint32(gain), 8)
+
+	if !common {
+		writeICSInfo(w, seq)
+	}
+
+	swb, windows, bits := aacSWBOffsetLong[3], 1, 5
+
+	if seq == windowEightShort {
+		swb, windows, bits = aacSWBOffsetShort[3], 8, 3
+	}
+
+	bands, escape := len(swb)-1, 1<<bits-1
+
+	for g := 0; g < windows; g++ {
+		w.write(bandEscape, 4)
+
+		for left := bands; ; left -= escape {
+			w.write(uint32(min(left, escape)), bits)
+
+			if left < escape {
+				break
+			}
+		}
+	}
+
+	for i := 0; i < windows*bands; i++ {
+		w.code(aacScalefactorCodes[60])
+	}
+
+	w.write(0, 3) // pulse, TNS and gain control
+
+	for g := 0; g < windows; g++ {
+		for k := g * 128; k < g*128+int(swb[bands]); k += 2 {
+			writePair(w, quant[k:k+2])
+		}
+	}
+}
+
+// writePair writes two quantized values with the escape codebook.
+func writePair(w *bitWriter, pair []int) {
+	y, z := min(abs(pair[0]), 16), min(abs(pair[1]), 16)
+
+	w.code(aacSpectralCodes[bandEscape-1][y*17+z])
+
+	for _, q := range pair {
+		if q < 0 {
+			w.write(1, 1)
+		} else if q > 0 {
+			w.write(0, 1)
+		}
+	}
+
+	for _, q := range pair {
+		if abs(q) < 16 {
+			continue
+		}
+
+		bits := 4
+		for abs(q) >= 1<<(bits+1) {
+			bits++
+		}
+
+		w.write(1<<(bits-4)-1, bits-4)
+		w.write(0, 1)
+		w.write(uint32(abs(q)-1<<bits), bits)
+	}
+}
+
+func abs(v int) int {
+	return max(v, -v)
+}
+
+// encodeSines encodes 48 kHz frames with the given window sequences of one
+// sine per channel, with amplitudes as a fraction of full scale. One channel
+// goes into an SCE and two into a CPE, which with ms set shares the window
+// and codes mid and side. Frame i is the block of output frames i-1 and i.
+func encodeSines(seqs []int, freqs, amps []float64, ms bool) [][]byte {
+	out := make([][]byte, len(seqs))
+
+	for i, seq := range seqs {
+		specs := make([][]float64, len(freqs))
+
+		for c, freq := range freqs {
+			block := make([]float64, 2*aacFrameLength)
+
+			for j := range block {
+				t := float64((i-1)*aacFrameLength + j)
+				block[j] = amps[c] * 32768 * math.Sin(2*math.Pi*freq*t/48000)
+			}
+
+			specs[c] = analyze(seq, block)
+		}
+
+		w := &bitWriter{}
+		w.write(uint32(len(freqs)-1), 3) // SCE or CPE
+		w.write(0, 4)
+
+		if len(freqs) == 2 {
+			if !ms {
+				w.write(0, 1) // common_window
+			} else {
+				w.write(1, 1)
+				writeICSInfo(w, seq)
+				w.write(2, 2) // ms_mask_present, all bands
+
+				for k := range specs[0] {
+					l, r := specs[0][k], specs[1][k]
+					specs[0][k], specs[1][k] = (l+r)/2, (l-r)/2
+				}
+			}
+		}
+
+		for _, spec := range specs {
+			writeICS(w, seq, spec, ms)
+		}
+
+		w.write(elementEND, 3)
+		out[i] = w.data
+	}
+
+	return out
+}
+
+// snr is the ratio in dB of the power of want to that of got-want.
+func snr(got, want []float64) float64 {
+	var signal, noise float64
+
+	for i := range want {
+		signal += want[i] * want[i]
+		noise += (got[i] - want[i]) * (got[i] - want[i])
+	}
+
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestNewAACDecoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		asc        []byte
+		sampleRate int
+	}{
+		{name: "LC", asc: []byte{0x12, 0x10}, sampleRate: 44100},
+		{name: "HE-AAC core", asc: []byte{0x2b, 0x92, 0x08, 0x00}, sampleRate: 22050},
+		{name: "explicit rate", asc: []byte{0x17, 0x80, 0x1f, 0x40, 0x08}, sampleRate: 16000},
+		{name: "main profile", asc: []byte{0x0a, 0x10}},
+		{name: "960 sample frames", asc: []byte{0x12, 0x14}},
+		{name: "reserved rate", asc: []byte{0x16, 0x90}},
+		{name: "empty", asc: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dec, err := newAACDecoder(test.asc)
+
+			if test.sampleRate == 0 {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("newAACDecoder() error = %v, want ErrUnsupported", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("newAACDecoder() error = %v", err)
+			}
+
+			if dec.sampleRate != test.sampleRate {
+				t.Fatalf("sampleRate = %d, want %d", dec.sampleRate, test.sampleRate)
+			}
+		})
+	}
+}
+
+func TestIMDCT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{aacFrameLength, aacFrameLength / 8} {
+		in := make([]float64, n)
+		for i := range in {
+			in[i] = r.NormFloat64()
+		}
+
+		out := make([]float64, 2*n)
+		newIMDCT(n).transform(in, out)
+
+		// x[i] = 2/N sum spec[k] cos(2pi/N (i + n0) (k + 1/2)) with the
+		// window length N = 2n and n0 = (n + 1) / 2.
+		for i := range out {
+			var want float64
+
+			for k, v := range in {
+				want += v * math.Cos(2*math.Pi/float64(2*n)*(float64(i)+float64(n+1)/2)*(float64(k)+0.5))
+			}
+
+			want /= float64(n)
+
+			if math.Abs(out[i]-want) > 1e-9 {
+				t.Fatalf("n = %d: sample %d = %v, want %v", n, i, out[i], want)
+			}
+		}
+	}
+}
+
+func TestAACDecodeSine(t *testing.T) {
+	long := []int{windowOnlyLong, windowOnlyLong, windowOnlyLong, windowOnlyLong}
+	switching := []int{windowOnlyLong, windowLongStart, windowEightShort, windowEightShort, windowLongStop, windowOnlyLong}
+
+	tests := []struct {
+		name  string
+		asc   []byte
+		seqs  []int
+		freqs []float64
+		amps  []float64
+		ms    bool
+	}{
+		{name: "mono", asc: []byte{0x11, 0x88}, seqs: long, freqs: []float64{440}, amps: []float64{0.5}},
+		{name: "mono short windows", asc: []byte{0x11, 0x88}, seqs: switching, freqs: []float64{440}, amps: []float64{0.5}},
+		{name: "stereo", asc: []byte{0x11, 0x90}, seqs: long, freqs: []float64{440, 1000}, amps: []float64{0.5, 0.25}},
+		{name: "mid side", asc: []byte{0x11, 0x90}, seqs: switching, freqs: []float64{440, 1000}, amps: []float64{0.5, 0.25}, ms: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dec, err := newAACDecoder(test.asc)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, frame := range encodeSines(test.seqs, test.freqs, test.amps, test.ms) {
+				out, err := dec.decode(frame)
+
+				if err != nil {
+					t.Fatalf("frame %d: decode() error = %v", i, err)
+				}
+
+				if len(out) != len(test.freqs) {
+					t.Fatalf("frame %d: decode() = %d channels, want %d", i, len(out), len(test.freqs))
+				}
+
+				// The first frame lacks the second half of the block before.
+				if i == 0 {
+					continue
+				}
+
+				for c, freq := range test.freqs {
+					want := make([]float64, aacFrameLength)
+					for j := range want {
+						t := float64((i-1)*aacFrameLength + j)
+						want[j] = test.amps[c] * math.Sin(2*math.Pi*freq*t/48000)
+					}
+
+					if got := snr(out[c], want); got < 60 {
+						t.Fatalf("frame %d channel %d: SNR = %.1f dB, want 60 dB or more", i, c, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAACDecodeSilence(t *testing.T) {
+	dec, err := newAACDecoder([]byte{0x12, 0x08})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A mono element with global_gain 100 and no scalefactor bands.
+	out, err := dec.decode([]byte{0x00, 0xc8, 0x00, 0x07})
+
+	if err != nil {
+		t.Fatalf("decode() error = %v", err)
+	}
+
+	if len(out) != 1 || len(out[0]) != aacFrameLength {
+		t.Fatalf("decode() = %d channels", len(out))
+	}
+
+	for i, v := range out[0] {
+		if v != 0 {
+			t.Fatalf("sample %d = %v, want 0", i, v)
+		}
+	}
+}
+
+func TestAACDecodeMalformed(t *testing.T) {
+	dec, err := newAACDecoder([]byte{0x12, 0x10})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+
+	// Random frames mostly fail, they must not panic or loop.
+	for i := 0; i < 10000; i++ {
+		frame := make([]byte, r.Intn(256))
+		r.Read(frame)
+
+		_, _ = dec.decode(frame)
+	}
+
+	for _, frame := range [][]byte{nil, {0x00}, {0x00, 0xc8}, {0xc0, 0xff, 0xff}} {
+		if _, err := dec.decode(frame); err == nil {
+			t.Fatalf("decode(%x) error = nil", frame)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// maxOggPage is the largest possible Ogg page, the last one is looked for in
+// this much of the file end.
+const maxOggPage = 65307
+
+// maxDuration is longer than any recording the bot gets, longer lengths come
+// from broken headers.
+const maxDuration = 100 * time.Hour
+
+func FileDuration(filename string) (time.Duration, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer f.Close()
+
+	return Duration(f)
+}
+
+// Duration returns the play time of audio Detect accepts. It is exact for
+// WAV, FLAC and Ogg Opus and estimated from the bitrate of the first frame
+// for MP3.
+func Duration(r io.ReadSeeker) (time.Duration, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file size: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	head := make([]byte, 4096)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return oggDuration(r, head, size)
+	case bytes.HasPrefix(head, []byte("RIFF")) && len(head) >= 12 && string(head[8:12]) == "WAVE":
+		return wavDuration(r, size)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return flacDuration(head)
+	case bytes.HasPrefix(head, []byte("ID3")), isMp3Frame(head):
+		return mp3Duration(r, head, size)
+	}
+
+	return 0, ErrUnsupported
+}
+
+func oggDuration(r io.ReadSeeker, head []byte, size int64) (time.Duration, error) {
+	if _, err := detectOgg(head); err != nil {
+		return 0, err
+	}
+
+	packet := head[27+int(head[26]):]
+	preSkip := int64(binary.LittleEndian.Uint16(packet[10:12]))
+
+	start := max(size-maxOggPage, 0)
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek: %w", err)
+	}
+
+	tail, err := io.ReadAll(r)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file end: %w", err)
+	}
+
+	// The granule position of the last page that ends a packet counts the
+	// samples at 48 kHz, -1 marks pages that end none.
+	for end := len(tail); ; {
+		i := bytes.LastIndex(tail[:end], []byte("OggS"))
+
+		if i < 0 {
+			return 0, fmt.Errorf("%w: no Ogg page with a granule position", ErrUnsupported)
+		}
+
+		if i+14 <= len(tail) {
+			granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+
+			if granule >= 0 {
+				return unitsDuration(max(granule-preSkip, 0), 48000)
+			}
+		}
+
+		end = i
+	}
+}
+
+func wavDuration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	var byteRate int64
+
+	header := make([]byte, 16)
+
+	for pos := int64(12); pos+8 <= size; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to seek: %w", err)
+		}
+
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return 0, fmt.Errorf("failed to read chunk: %w", err)
+		}
+
+		id := string(header[:4])
+		chunk := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			if _, err := io.ReadFull(r, header); err != nil {
+				return 0, fmt.Errorf("failed to read fmt chunk: %w", err)
+			}
+
+			byteRate = int64(binary.LittleEndian.Uint32(header[8:12]))
+		case "data":
+			if byteRate <= 0 {
+				return 0, fmt.Errorf("%w: WAV data before fmt chunk", ErrUnsupported)
+			}
+
+			// Streamed WAV files leave the size zero or at its maximum.
+			if rest := size - pos - 8; chunk == 0 || chunk > rest {
+				chunk = rest
+			}
+
+			return unitsDuration(chunk, byteRate)
+		}
+
+		pos += 8 + chunk + chunk%2
+	}
+
+	return 0, fmt.Errorf("%w: WAV without data chunk", ErrUnsupported)
+}
+
+func flacDuration(head []byte) (time.Duration, error) {
+	format, err := detectFlac(head)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// The total sample count ends 26 bytes in, past what detectFlac needs.
+	if len(head) < 26 {
+		return 0, fmt.Errorf("%w: FLAC with a short STREAMINFO", ErrUnsupported)
+	}
+
+	info := head[8:]
+	samples := int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:18]))
+
+	if samples == 0 {
+		return 0, fmt.Errorf("%w: FLAC of unknown length", ErrUnsupported)
+	}
+
+	return unitsDuration(samples, int64(format.SampleRate))
+}
+
+// mp3Bitrates are the bitrates in kbit/s by MPEG version, layer and index.
+var mp3Bitrates = map[[2]byte][15]int{
+	{3, 3}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{3, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{3, 1}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 3}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 1}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mp3Duration divides the size by the bitrate of the first frame, which is
+// exact for constant bitrate files and close enough to bill the others.
+func mp3Duration(r io.ReadSeeker, head []byte, size int64) (time.Duration, error) {
+	var start int64
+
+	if bytes.HasPrefix(head, []byte("ID3")) {
+		skip, err := id3Size(head)
+
+		if err != nil {
+			return 0, err
+		}
+
+		start = skip
+
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to seek: %w", err)
+		}
+
+		head = make([]byte, 4096)
+
+		n, err := io.ReadFull(r, head)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("failed to read header: %w", err)
+		}
+
+		head = head[:n]
+	}
+
+	for i := 0; i+4 <= len(head); i++ {
+		b := head[i:]
+
+		if !isMp3Frame(b) {
+			continue
+		}
+
+		version := b[1] >> 3 & 0x03
+		if version == 0 {
+			version = 2 // MPEG-2.5 shares the MPEG-2 bitrates
+		}
+
+		kbps := mp3Bitrates[[2]byte{version, b[1] >> 1 & 0x03}][b[2]>>4]
+
+		if kbps == 0 {
+			return 0, fmt.Errorf("%w: free format MP3", ErrUnsupported)
+		}
+
+		return unitsDuration((size-start-int64(i))*8, int64(kbps)*1000)
+	}
+
+	return 0, fmt.Errorf("%w: no MP3 frame found", ErrUnsupported)
+}
+
+// unitsDuration converts a count of samples, bytes or bits to time given
+// their number per second.
+func unitsDuration(units, perSecond int64) (time.Duration, error) {
+	if units < 0 || perSecond <= 0 || units/perSecond > int64(maxDuration/time.Second) {
+		return 0, fmt.Errorf("%w: implausible length", ErrUnsupported)
+	}
+
+	return time.Duration(units/perSecond)*time.Second + time.Duration(units%perSecond)*time.Second/time.Duration(perSecond), nil
+}
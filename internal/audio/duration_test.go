@@ -0,0 +1,58 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flacHead returns the start of a FLAC file with a STREAMINFO block of the
+// sample rate and total sample count.
+func flacHead(sampleRate int, samples int64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | 1<<1 // two channels
+	info[13] = 0x70 | byte(samples>>32)   // 16 bits per sample
+	info[14] = byte(samples >> 24)
+	info[15] = byte(samples >> 16)
+	info[16] = byte(samples >> 8)
+	info[17] = byte(samples)
+
+	return append([]byte{'f', 'L', 'a', 'C', 0x80, 0, 0, 34}, info...)
+}
+
+func TestDurationFLAC(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		err      bool
+	}{
+		{name: "STREAMINFO", data: flacHead(44100, 44100*90+22050), duration: 90*time.Second + 500*time.Millisecond},
+		{name: "unknown length", data: flacHead(44100, 0), err: true},
+		{name: "too long", data: flacHead(8000, 8000*3600*200), err: true},
+		{name: "cut before the sample count", data: flacHead(44100, 44100)[:25], err: true},
+		{name: "fuzzed", data: []byte("fLaC\x000000000000000000"), err: true},
+		{name: "cut before the sample rate", data: flacHead(44100, 44100)[:20], err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := Duration(bytes.NewReader(test.data))
+
+			if test.err {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("Duration() = %v, %v, want ErrUnsupported", d, err)
+				}
+
+				return
+			}
+
+			if err != nil || d != test.duration {
+				t.Fatalf("Duration() = %v, %v, want %v", d, err, test.duration)
+			}
+		})
+	}
+}
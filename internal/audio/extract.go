@@ -0,0 +1,170 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// maxBrokenAACFrames is the share of broken AAC frames, in percent, past
+// which the gaps would make the transcript useless.
+const maxBrokenAACFrames = 10
+
+func IsMP4File(filename string) (bool, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer f.Close()
+
+	head := make([]byte, 8)
+
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false, nil
+	}
+
+	return IsMP4(head), nil
+}
+
+// ExtractFile writes the audio track of the MP4/MOV file src to dst in a
+// format SaluteSpeech accepts: Opus is remuxed into Ogg as is, AAC is decoded
+// into a mono 16 bit PCM WAV file.
+func ExtractFile(src, dst string) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer in.Close()
+
+	track, err := DemuxMP4(in)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer out.Close()
+
+	switch track.Codec {
+	case CodecOpus:
+		err = writeOggOpus(out, in, track)
+	case CodecAAC:
+		err = writeWavFromAAC(out, in, track)
+	default:
+		err = fmt.Errorf("%w: audio codec %s", ErrUnsupported, track.Codec)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+func writeWavFromAAC(w io.WriteSeeker, r io.ReaderAt, track *Track) error {
+	dec, err := newAACDecoder(track.Config)
+
+	if err != nil {
+		return err
+	}
+
+	sampleRate := dec.sampleRate
+
+	if _, err := w.Write(make([]byte, wavHeaderSize)); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	var (
+		dataSize int
+		broken   int
+		pcm      []byte
+	)
+
+	for _, s := range track.Samples {
+		frame := make([]byte, s.Size)
+
+		if _, err := r.ReadAt(frame, s.Offset); err != nil {
+			return fmt.Errorf("failed to read AAC frame: %w", err)
+		}
+
+		channels, err := dec.decode(frame)
+
+		// A broken frame only costs a few milliseconds of audio, keep going.
+		// A tool the decoder lacks is used all over the stream, give up.
+		if errors.Is(err, errAACFrame) {
+			broken++
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(channels) == 0 {
+			continue
+		}
+
+		pcm = pcm[:0]
+
+		for i := 0; i < aacFrameLength; i++ {
+			var sum float64
+			for _, ch := range channels {
+				sum += ch[i]
+			}
+
+			v := math.Max(-1, math.Min(1, sum/float64(len(channels))))
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(v*math.MaxInt16)))
+		}
+
+		if _, err := w.Write(pcm); err != nil {
+			return fmt.Errorf("failed to write WAV data: %w", err)
+		}
+
+		dataSize += len(pcm)
+	}
+
+	if broken == len(track.Samples) || broken*100 > len(track.Samples)*maxBrokenAACFrames {
+		return fmt.Errorf("%w: %d of %d AAC frames are broken", ErrUnsupported, broken, len(track.Samples))
+	}
+
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, uint32(36+dataSize))
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate*2))
+	header = binary.LittleEndian.AppendUint16(header, 2)
+	header = binary.LittleEndian.AppendUint16(header, 16)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(dataSize))
+
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	return nil
+}
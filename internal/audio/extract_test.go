@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readWav returns the samples of a mono 16 bit WAV file written by
+// writeWavFromAAC in the range -1..1.
+func readWav(t *testing.T, name string, sampleRate int) []float64 {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) < wavHeaderSize || string(data[:4]) != "RIFF" || string(data[36:40]) != "data" {
+		t.Fatalf("%s is not a WAV file", name)
+	}
+
+	if channels := binary.LittleEndian.Uint16(data[22:24]); channels != 1 {
+		t.Fatalf("channels = %d, want 1", channels)
+	}
+
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != uint32(sampleRate) {
+		t.Fatalf("sample rate = %d, want %d", rate, sampleRate)
+	}
+
+	pcm := data[wavHeaderSize:]
+
+	if size := binary.LittleEndian.Uint32(data[40:44]); int(size) != len(pcm) {
+		t.Fatalf("data size = %d, want %d", size, len(pcm))
+	}
+
+	out := make([]float64, len(pcm)/2)
+
+	for i := range out {
+		out[i] = float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / math.MaxInt16
+	}
+
+	return out
+}
+
+func extractTestdata(t *testing.T, name string, sampleRate int) []float64 {
+	t.Helper()
+
+	dst := filepath.Join(t.TempDir(), "out.wav")
+
+	if err := ExtractFile(filepath.Join("testdata", name), dst); err != nil {
+		t.Fatalf("ExtractFile(%s) error = %v", name, err)
+	}
+
+	return readWav(t, dst, sampleRate)
+}
+
+// The two speech files hold the same 1.7 seconds of a recording, encoded to
+// AAC-LC by libfaac and by the FFmpeg encoder. The FFmpeg track starts one
+// frame earlier, it has an extra frame of encoder delay.
+func TestExtractFileAACEncoders(t *testing.T) {
+	faac := extractTestdata(t, "speech-faac.m4a", 48000)
+	ffmpeg := extractTestdata(t, "speech-ffmpeg.m4a", 48000)
+
+	if len(faac) != 80*aacFrameLength || len(ffmpeg) != 81*aacFrameLength {
+		t.Fatalf("decoded %d and %d samples, want 80 and 81 frames", len(faac), len(ffmpeg))
+	}
+
+	// Both first frames lack the block before them.
+	faac, ffmpeg = faac[aacFrameLength:], ffmpeg[2*aacFrameLength:]
+
+	var power float64
+	for _, v := range faac {
+		power += v * v
+	}
+
+	if rms := math.Sqrt(power / float64(len(faac))); rms < 0.01 {
+		t.Fatalf("RMS = %.4f, want speech", rms)
+	}
+
+	// The encoders are lossy in different ways, a decoder bug in any tool
+	// either of them uses drops the match far below this.
+	if got := snr(ffmpeg, faac); got < 12 {
+		t.Fatalf("SNR between the encoders = %.1f dB, want 12 dB or more", got)
+	}
+}
+
+func TestExtractFileAACStereo(t *testing.T) {
+	got := extractTestdata(t, "stereo-ffmpeg.m4a", 48000)
+
+	in, err := os.Open(filepath.Join("testdata", "stereo-ffmpeg.m4a"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer in.Close()
+
+	track, err := DemuxMP4(in)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := newAACDecoder(track.Config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var left, right []float64
+
+	for i, s := range track.Samples {
+		frame := make([]byte, s.Size)
+
+		if _, err := in.ReadAt(frame, s.Offset); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := dec.decode(frame)
+
+		if err != nil {
+			t.Fatalf("frame %d: decode() error = %v", i, err)
+		}
+
+		if len(out) != 2 {
+			t.Fatalf("frame %d: decode() = %d channels, want 2", i, len(out))
+		}
+
+		left, right = append(left, out[0]...), append(right, out[1]...)
+	}
+
+	if len(got) != len(left) {
+		t.Fatalf("WAV has %d samples, want %d", len(got), len(left))
+	}
+
+	mid := make([]float64, len(left))
+	for i := range mid {
+		mid[i] = (left[i] + right[i]) / 2
+	}
+
+	// The channels differ enough for a wrong downmix to show.
+	if snr(left, mid) > 20 {
+		t.Fatalf("SNR of left against the mix = %.1f dB, want different channels", snr(left, mid))
+	}
+
+	for i := range got {
+		if math.Abs(got[i]-mid[i]) > 1.0/math.MaxInt16 {
+			t.Fatalf("sample %d = %v, want %v", i, got[i], mid[i])
+		}
+	}
+}
+
+func TestWriteWavFromAACErrors(t *testing.T) {
+	sine := encodeSines(make([]int, 20), []float64{440}, []float64{0.5}, false)
+
+	// An SCE cut off in its global_gain.
+	broken := []byte{0x00}
+
+	// A coupling channel element, which the decoder does not support.
+	coupling := []byte{elementCCE << 5}
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		err    bool
+	}{
+		{name: "one broken frame", frames: append([][]byte{broken}, sine[1:]...)},
+		{name: "many broken frames", frames: append([][]byte{broken, broken, broken}, sine[3:]...), err: true},
+		{name: "all broken", frames: [][]byte{broken, broken}, err: true},
+		{name: "coupling channel", frames: append([][]byte{sine[0], coupling}, sine[2:]...), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			track := &Track{Codec: CodecAAC, Config: []byte{0x11, 0x88}}
+
+			var data []byte
+
+			for _, frame := range test.frames {
+				track.Samples = append(track.Samples, Sample{Offset: int64(len(data)), Size: uint32(len(frame))})
+				data = append(data, frame...)
+			}
+
+			out, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer out.Close()
+
+			err = writeWavFromAAC(out, bytes.NewReader(data), track)
+
+			if !test.err {
+				if err != nil {
+					t.Fatalf("writeWavFromAAC() error = %v", err)
+				}
+
+				if got := readWav(t, out.Name(), 48000); len(got) != (len(test.frames)-1)*aacFrameLength {
+					t.Fatalf("WAV has %d samples, want %d frames", len(got), len(test.frames)-1)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("writeWavFromAAC() error = %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
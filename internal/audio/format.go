@@ -0,0 +1,214 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	EncodingPCM   = "PCM_S16LE"
+	EncodingOpus  = "OPUS"
+	EncodingMP3   = "MP3"
+	EncodingFLAC  = "FLAC"
+	EncodingALAW  = "ALAW"
+	EncodingMULAW = "MULAW"
+)
+
+var ErrUnsupported = errors.New("unsupported audio format")
+
+type Format struct {
+	Encoding   string
+	SampleRate int
+	Channels   int
+}
+
+func DetectFile(filename string) (Format, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return Format{}, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer f.Close()
+
+	return Detect(f)
+}
+
+// Detect reads the container header and returns the encoding parameters
+// SaluteSpeech needs to recognize the stream.
+func Detect(r io.ReadSeeker) (Format, error) {
+	head := make([]byte, 4096)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Format{}, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return detectOgg(head)
+	case bytes.HasPrefix(head, []byte("RIFF")) && len(head) >= 12 && string(head[8:12]) == "WAVE":
+		return detectWav(head)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return detectFlac(head)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return detectMp3(r, head)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return Format{}, fmt.Errorf("%w: MP4/M4A container", ErrUnsupported)
+	case isMp3Frame(head):
+		return detectMp3(r, head)
+	}
+
+	return Format{}, ErrUnsupported
+}
+
+func detectOgg(head []byte) (Format, error) {
+	if len(head) < 27 || len(head) < 27+int(head[26]) {
+		return Format{}, fmt.Errorf("%w: truncated Ogg page", ErrUnsupported)
+	}
+
+	packet := head[27+int(head[26]):]
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 19:
+		// Opus always decodes at 48 kHz, the header only keeps the original rate.
+		return Format{Encoding: EncodingOpus, SampleRate: 48000, Channels: int(packet[9])}, nil
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return Format{}, fmt.Errorf("%w: Ogg Vorbis", ErrUnsupported)
+	}
+
+	return Format{}, fmt.Errorf("%w: unknown Ogg codec", ErrUnsupported)
+}
+
+func detectWav(head []byte) (Format, error) {
+	for pos := 12; pos+8 <= len(head); {
+		id := string(head[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(head[pos+4 : pos+8]))
+		data := head[pos+8:]
+
+		if id != "fmt " {
+			pos += 8 + size + size%2
+			continue
+		}
+
+		if size < 16 || len(data) < 16 {
+			break
+		}
+
+		code := binary.LittleEndian.Uint16(data[0:2])
+		channels := int(binary.LittleEndian.Uint16(data[2:4]))
+		sampleRate := int(binary.LittleEndian.Uint32(data[4:8]))
+		bits := binary.LittleEndian.Uint16(data[14:16])
+
+		// WAVE_FORMAT_EXTENSIBLE keeps the real format code in the sub-format GUID.
+		if code == 0xFFFE && size >= 26 && len(data) >= 26 {
+			code = binary.LittleEndian.Uint16(data[24:26])
+		}
+
+		format := Format{SampleRate: sampleRate, Channels: channels}
+
+		switch {
+		case code == 1 && bits == 16:
+			format.Encoding = EncodingPCM
+		case code == 6:
+			format.Encoding = EncodingALAW
+		case code == 7:
+			format.Encoding = EncodingMULAW
+		default:
+			return Format{}, fmt.Errorf("%w: WAV format %d with %d bits per sample", ErrUnsupported, code, bits)
+		}
+
+		return format, nil
+	}
+
+	return Format{}, fmt.Errorf("%w: WAV without fmt chunk", ErrUnsupported)
+}
+
+func detectFlac(head []byte) (Format, error) {
+	// "fLaC", the metadata block header and the STREAMINFO block up to the channel count.
+	if len(head) < 21 || head[4]&0x7F != 0 {
+		return Format{}, fmt.Errorf("%w: FLAC without STREAMINFO", ErrUnsupported)
+	}
+
+	info := head[8:]
+	sampleRate := int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	channels := int(info[12]>>1&0x07) + 1
+
+	return Format{Encoding: EncodingFLAC, SampleRate: sampleRate, Channels: channels}, nil
+}
+
+var mp3SampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG-1
+	2: {22050, 24000, 16000}, // MPEG-2
+	0: {11025, 12000, 8000},  // MPEG-2.5
+}
+
+// id3Size returns the size of the ID3v2 tag the head starts with. The tag
+// may carry cover art far bigger than the header buffer.
+func id3Size(head []byte) (int64, error) {
+	if len(head) < 10 {
+		return 0, fmt.Errorf("%w: truncated ID3 tag", ErrUnsupported)
+	}
+
+	// The size is a 28 bit synchsafe integer without the header and footer.
+	size := 10 + (int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9]))
+	if head[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return size, nil
+}
+
+func isMp3Frame(b []byte) bool {
+	return len(b) >= 4 && b[0] == 0xFF && b[1]&0xE0 == 0xE0 && b[1]>>3&0x03 != 1 && b[1]>>1&0x03 != 0 && b[2]>>2&0x03 != 3 && b[2]>>4 != 0x0F
+}
+
+func detectMp3(r io.ReadSeeker, head []byte) (Format, error) {
+	if bytes.HasPrefix(head, []byte("ID3")) {
+		skip, err := id3Size(head)
+
+		if err != nil {
+			return Format{}, err
+		}
+
+		if _, err := r.Seek(skip, io.SeekStart); err != nil {
+			return Format{}, fmt.Errorf("failed to skip ID3 tag: %w", err)
+		}
+
+		head = make([]byte, 4096)
+
+		n, err := io.ReadFull(r, head)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return Format{}, fmt.Errorf("failed to read header: %w", err)
+		}
+
+		head = head[:n]
+	}
+
+	for i := 0; i+4 <= len(head); i++ {
+		b := head[i:]
+
+		if !isMp3Frame(b) {
+			continue
+		}
+
+		channels := 2
+		if b[3]>>6 == 3 {
+			channels = 1
+		}
+
+		return Format{
+			Encoding:   EncodingMP3,
+			SampleRate: mp3SampleRates[b[1]>>3&0x03][b[2]>>2&0x03],
+			Channels:   channels,
+		}, nil
+	}
+
+	return Format{}, fmt.Errorf("%w: no MP3 frame found", ErrUnsupported)
+}
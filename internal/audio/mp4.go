@@ -0,0 +1,532 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	CodecAAC  = "aac"
+	CodecOpus = "opus"
+)
+
+var errShortBox = fmt.Errorf("%w: truncated MP4 box", ErrUnsupported)
+
+// Track is the audio track of an MP4/ISO-BMFF file. Samples point into the
+// original file, the payload is read lazily when the track is extracted.
+type Track struct {
+	Codec      string
+	SampleRate int
+	Channels   int
+	Timescale  uint32
+	// Config is the AudioSpecificConfig for AAC or the dOps box body for Opus.
+	Config  []byte
+	Samples []Sample
+}
+
+type Sample struct {
+	Offset   int64
+	Size     uint32
+	Duration uint32
+}
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+// IsMP4 reports whether the header looks like an ISO-BMFF (MP4, M4A, MOV) file.
+func IsMP4(head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+
+	switch string(head[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+
+	return false
+}
+
+// DemuxMP4 finds the first audio track and builds its sample table. Counts
+// and sizes in the file are checked against the boxes holding them and the
+// file size, so a broken file fails instead of allocating or reading past it.
+func DemuxMP4(r io.ReadSeeker) (*Track, error) {
+	fileSize, err := r.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file size: %w", err)
+	}
+
+	moov, err := readTopLevelBox(r, "moov", fileSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trak := range childBoxes(moov, "trak") {
+		mdia := firstBox(trak, "mdia")
+
+		if mdia == nil || handlerType(firstBox(mdia, "hdlr")) != "soun" {
+			continue
+		}
+
+		return parseAudioTrack(mdia, fileSize)
+	}
+
+	return nil, fmt.Errorf("%w: no audio track in MP4", ErrUnsupported)
+}
+
+func readTopLevelBox(r io.ReadSeeker, typ string, fileSize int64) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var offset int64
+	header := make([]byte, 16)
+
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: no %s box in MP4", ErrUnsupported, typ)
+			}
+
+			return nil, fmt.Errorf("failed to read MP4 box: %w", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		name := string(header[4:8])
+		headerSize := int64(8)
+
+		if size == 1 {
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, fmt.Errorf("failed to read MP4 box: %w", err)
+			}
+
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if size == 0 && name != typ {
+			return nil, fmt.Errorf("%w: no %s box in MP4", ErrUnsupported, typ)
+		}
+
+		if size != 0 && (size < headerSize || size > fileSize-offset) {
+			return nil, errShortBox
+		}
+
+		if name == typ {
+			if size == 0 {
+				return io.ReadAll(r)
+			}
+
+			data := make([]byte, size-headerSize)
+
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, fmt.Errorf("failed to read %s box: %w", typ, err)
+			}
+
+			return data, nil
+		}
+
+		offset += size
+
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek MP4 box: %w", err)
+		}
+	}
+}
+
+func parseBoxes(data []byte) []box {
+	var boxes []box
+
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(data)) {
+			return boxes
+		}
+
+		boxes = append(boxes, box{typ: typ, data: data[headerSize:size]})
+		data = data[size:]
+	}
+
+	return boxes
+}
+
+func childBoxes(data []byte, typ string) [][]byte {
+	var res [][]byte
+
+	for _, b := range parseBoxes(data) {
+		if b.typ == typ {
+			res = append(res, b.data)
+		}
+	}
+
+	return res
+}
+
+func firstBox(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		found := childBoxes(data, typ)
+
+		if len(found) == 0 {
+			return nil
+		}
+
+		data = found[0]
+	}
+
+	return data
+}
+
+func handlerType(hdlr []byte) string {
+	if len(hdlr) < 12 {
+		return ""
+	}
+
+	return string(hdlr[8:12])
+}
+
+func parseAudioTrack(mdia []byte, fileSize int64) (*Track, error) {
+	track := &Track{}
+
+	if mdhd := firstBox(mdia, "mdhd"); len(mdhd) >= 24 {
+		if mdhd[0] == 1 {
+			track.Timescale = binary.BigEndian.Uint32(mdhd[20:24])
+		} else {
+			track.Timescale = binary.BigEndian.Uint32(mdhd[12:16])
+		}
+	}
+
+	stbl := firstBox(mdia, "minf", "stbl")
+
+	if stbl == nil {
+		return nil, fmt.Errorf("%w: audio track without sample table", ErrUnsupported)
+	}
+
+	if err := parseSampleEntry(track, firstBox(stbl, "stsd")); err != nil {
+		return nil, err
+	}
+
+	samples, err := buildSamples(stbl, fileSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%w: empty or fragmented MP4 audio track", ErrUnsupported)
+	}
+
+	track.Samples = samples
+
+	return track, nil
+}
+
+func parseSampleEntry(track *Track, stsd []byte) error {
+	if len(stsd) < 8 {
+		return fmt.Errorf("%w: audio track without sample description", ErrUnsupported)
+	}
+
+	entries := parseBoxes(stsd[8:])
+
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: audio track without sample description", ErrUnsupported)
+	}
+
+	entry := entries[0]
+
+	// AudioSampleEntry: reserved, data reference index, the QuickTime version,
+	// channel count, sample size and a 16.16 sample rate.
+	if len(entry.data) < 28 {
+		return errShortBox
+	}
+
+	track.Channels = int(binary.BigEndian.Uint16(entry.data[16:18]))
+	track.SampleRate = int(binary.BigEndian.Uint32(entry.data[24:28]) >> 16)
+
+	children := entry.data[28:]
+
+	switch binary.BigEndian.Uint16(entry.data[8:10]) {
+	case 1:
+		children = entry.data[min(len(entry.data), 28+16):]
+	case 2:
+		children = entry.data[min(len(entry.data), 28+36):]
+	}
+
+	switch entry.typ {
+	case "mp4a":
+		esds := firstBox(children, "esds")
+
+		if esds == nil {
+			esds = firstBox(children, "wave", "esds")
+		}
+
+		config, err := parseEsds(esds)
+
+		if err != nil {
+			return err
+		}
+
+		track.Codec = CodecAAC
+		track.Config = config
+	case "Opus":
+		dops := firstBox(children, "dOps")
+
+		if len(dops) < 11 {
+			return fmt.Errorf("%w: Opus track without dOps box", ErrUnsupported)
+		}
+
+		track.Codec = CodecOpus
+		track.Config = dops
+		track.Channels = int(dops[1])
+		track.SampleRate = 48000
+	default:
+		return fmt.Errorf("%w: audio codec %q in MP4", ErrUnsupported, entry.typ)
+	}
+
+	return nil
+}
+
+// parseEsds walks the MPEG-4 descriptors of an esds box down to the
+// DecoderSpecificInfo, which holds the AudioSpecificConfig.
+func parseEsds(esds []byte) ([]byte, error) {
+	if len(esds) < 4 {
+		return nil, fmt.Errorf("%w: AAC track without esds box", ErrUnsupported)
+	}
+
+	data := esds[4:]
+
+	for len(data) > 0 {
+		tag := data[0]
+		size, n := descriptorSize(data[1:])
+		data = data[1+n:]
+
+		if size > len(data) {
+			break
+		}
+
+		switch tag {
+		case 0x03:
+			// ES_Descriptor: ES_ID and flags, followed by optional fields.
+			if size < 3 {
+				return nil, errShortBox
+			}
+
+			flags := data[2]
+			skip := 3
+
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+
+			if flags&0x40 != 0 && len(data) > skip {
+				skip += 1 + int(data[skip])
+			}
+
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+
+			if skip > size {
+				return nil, errShortBox
+			}
+
+			data = data[skip:size]
+		case 0x04:
+			// DecoderConfigDescriptor: object type, stream type, buffer size and bitrates.
+			if size < 13 {
+				return nil, errShortBox
+			}
+
+			if data[0] != 0x40 && data[0] != 0x66 && data[0] != 0x67 && data[0] != 0x68 {
+				return nil, fmt.Errorf("%w: MP4 audio object type 0x%02x", ErrUnsupported, data[0])
+			}
+
+			data = data[13:size]
+		case 0x05:
+			return append([]byte(nil), data[:size]...), nil
+		default:
+			data = data[size:]
+		}
+	}
+
+	return nil, fmt.Errorf("%w: AAC track without decoder config", ErrUnsupported)
+}
+
+func descriptorSize(data []byte) (int, int) {
+	size := 0
+
+	for i := 0; i < 4 && i < len(data); i++ {
+		size = size<<7 | int(data[i]&0x7F)
+
+		if data[i]&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+
+	return size, min(4, len(data))
+}
+
+func buildSamples(stbl []byte, fileSize int64) ([]Sample, error) {
+	sizes, err := sampleSizes(firstBox(stbl, "stsz"), fileSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := chunkOffsets(stbl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stsc := firstBox(stbl, "stsc")
+
+	if len(stsc) < 8 {
+		return nil, fmt.Errorf("%w: MP4 track without stsc box", ErrUnsupported)
+	}
+
+	count := int(binary.BigEndian.Uint32(stsc[4:8]))
+
+	if count > (len(stsc)-8)/12 {
+		return nil, errShortBox
+	}
+
+	samples := make([]Sample, 0, len(sizes))
+
+	for i := 0; i < count && len(samples) < len(sizes); i++ {
+		entry := stsc[8+i*12:]
+		first := int(binary.BigEndian.Uint32(entry[0:4]))
+		perChunk := int(binary.BigEndian.Uint32(entry[4:8]))
+		last := len(offsets)
+
+		// Chunks are numbered from 1.
+		if first < 1 {
+			return nil, fmt.Errorf("%w: MP4 sample-to-chunk entry for chunk %d", ErrUnsupported, first)
+		}
+
+		if i+1 < count {
+			last = int(binary.BigEndian.Uint32(stsc[8+(i+1)*12:])) - 1
+		}
+
+		for chunk := first; chunk <= last && chunk <= len(offsets); chunk++ {
+			offset := offsets[chunk-1]
+
+			for j := 0; j < perChunk && len(samples) < len(sizes); j++ {
+				size := sizes[len(samples)]
+
+				if offset < 0 || int64(size) > fileSize-offset {
+					return nil, fmt.Errorf("%w: MP4 sample past the end of the file", ErrUnsupported)
+				}
+
+				samples = append(samples, Sample{Offset: offset, Size: size})
+				offset += int64(size)
+			}
+		}
+	}
+
+	if stts := firstBox(stbl, "stts"); len(stts) >= 8 {
+		count := int(binary.BigEndian.Uint32(stts[4:8]))
+		n := 0
+
+		for i := 0; i < count && len(stts) >= 16+i*8; i++ {
+			entry := stts[8+i*8:]
+			repeat := int(binary.BigEndian.Uint32(entry[0:4]))
+			delta := binary.BigEndian.Uint32(entry[4:8])
+
+			for j := 0; j < repeat && n < len(samples); j++ {
+				samples[n].Duration = delta
+				n++
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+func sampleSizes(stsz []byte, fileSize int64) ([]uint32, error) {
+	if len(stsz) < 12 {
+		return nil, fmt.Errorf("%w: MP4 track without stsz box", ErrUnsupported)
+	}
+
+	size := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+
+	if size != 0 {
+		// Samples of the same size have no table, the file must hold them.
+		if int64(count) > fileSize/int64(size) {
+			return nil, errShortBox
+		}
+
+		sizes := make([]uint32, count)
+		for i := range sizes {
+			sizes[i] = size
+		}
+
+		return sizes, nil
+	}
+
+	if count > (len(stsz)-12)/4 {
+		return nil, errShortBox
+	}
+
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		sizes[i] = binary.BigEndian.Uint32(stsz[12+i*4:])
+	}
+
+	return sizes, nil
+}
+
+func chunkOffsets(stbl []byte) ([]int64, error) {
+	if stco := firstBox(stbl, "stco"); len(stco) >= 8 {
+		count := int(binary.BigEndian.Uint32(stco[4:8]))
+
+		if count > (len(stco)-8)/4 {
+			return nil, errShortBox
+		}
+
+		offsets := make([]int64, count)
+		for i := range offsets {
+			offsets[i] = int64(binary.BigEndian.Uint32(stco[8+i*4:]))
+		}
+
+		return offsets, nil
+	}
+
+	if co64 := firstBox(stbl, "co64"); len(co64) >= 8 {
+		count := int(binary.BigEndian.Uint32(co64[4:8]))
+
+		if count > (len(co64)-8)/8 {
+			return nil, errShortBox
+		}
+
+		offsets := make([]int64, count)
+		for i := range offsets {
+			offsets[i] = int64(binary.BigEndian.Uint64(co64[8+i*8:]))
+		}
+
+		return offsets, nil
+	}
+
+	return nil, fmt.Errorf("%w: MP4 track without chunk offsets", ErrUnsupported)
+}
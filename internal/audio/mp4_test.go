@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+
+	return append(append(out, typ...), body...)
+}
+
+func be32(values ...uint32) []byte {
+	var out []byte
+
+	for _, v := range values {
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+
+	return out
+}
+
+// testMP4 is an ftyp and an mdat with four 10 byte samples at offset 24,
+// followed by a moov with an Opus track whose sample tables are given.
+func testMP4(stsc, stsz, stco []byte) []byte {
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[16:18], 1)
+	binary.BigEndian.PutUint32(entry[24:28], 48000<<16)
+
+	stbl := mp4Box("stbl",
+		mp4Box("stsd", be32(0, 1), mp4Box("Opus", entry, mp4Box("dOps", make([]byte, 11)))),
+		mp4Box("stts", be32(0, 1, 4, 960)),
+		mp4Box("stsc", stsc),
+		mp4Box("stsz", stsz),
+		mp4Box("stco", stco),
+	)
+
+	moov := mp4Box("moov", mp4Box("trak", mp4Box("mdia",
+		mp4Box("mdhd", make([]byte, 24)),
+		mp4Box("hdlr", be32(0, 0), []byte("soun")),
+		mp4Box("minf", stbl),
+	)))
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("M4A "), be32(0)),
+		mp4Box("mdat", make([]byte, 40)),
+		moov,
+	}, nil)
+}
+
+func TestDemuxMP4(t *testing.T) {
+	var (
+		stsc = be32(0, 1, 1, 2, 1)
+		stsz = be32(0, 0, 4, 10, 10, 10, 10)
+		stco = be32(0, 2, 24, 44)
+	)
+
+	hugeMoov := append(mp4Box("ftyp", []byte("M4A "), be32(0)), be32(0xFFFFFFF0)...)
+	hugeMoov = append(hugeMoov, "moov"...)
+
+	largeMoov := append(mp4Box("ftyp", []byte("M4A "), be32(0)), be32(1)...)
+	largeMoov = append(append(largeMoov, "moov"...), 0xFF, 0, 0, 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		samples int
+	}{
+		{name: "valid", data: testMP4(stsc, stsz, stco), samples: 4},
+		{name: "first chunk zero", data: testMP4(be32(0, 1, 0, 2, 1), stsz, stco)},
+		{name: "stsc count past box", data: testMP4(be32(0, 0xFFFFFFFF, 1, 2, 1), stsz, stco)},
+		{name: "stsz count past box", data: testMP4(stsc, be32(0, 0, 0x40000000, 10), stco)},
+		{name: "constant size past file", data: testMP4(stsc, be32(0, 10, 0xFFFFFFFF), stco)},
+		{name: "stco count past box", data: testMP4(stsc, stsz, be32(0, 0x7FFFFFFF, 24))},
+		{name: "sample past file", data: testMP4(stsc, be32(0, 0, 4, 10, 10, 10, 0xFFFFFFFF), stco)},
+		{name: "chunk offset past file", data: testMP4(stsc, stsz, be32(0, 2, 24, 0xFFFFFF00))},
+		{name: "moov past file", data: hugeMoov},
+		{name: "negative 64-bit moov size", data: largeMoov},
+		{name: "truncated", data: testMP4(stsc, stsz, stco)[:60]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			track, err := DemuxMP4(bytes.NewReader(test.data))
+
+			if test.samples == 0 {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("DemuxMP4() error = %v, want ErrUnsupported", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DemuxMP4() error = %v", err)
+			}
+
+			if len(track.Samples) != test.samples {
+				t.Fatalf("DemuxMP4() samples = %d, want %d", len(track.Samples), test.samples)
+			}
+		})
+	}
+}
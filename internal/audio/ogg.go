@@ -0,0 +1,164 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const oggMaxSegments = 255
+
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+
+	for i := range table {
+		crc := uint32(i) << 24
+
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+
+		table[i] = crc
+	}
+
+	return table
+}()
+
+type oggWriter struct {
+	w        io.Writer
+	serial   uint32
+	sequence uint32
+	segments []byte
+	body     []byte
+	granule  int64
+	started  bool
+}
+
+// writeOggOpus remuxes the Opus packets of an MP4 track into an Ogg Opus
+// stream as described in RFC 7845.
+func writeOggOpus(w io.Writer, r io.ReaderAt, track *Track) error {
+	dops := track.Config
+	ow := &oggWriter{w: w, serial: 0x5342}
+
+	// dOps keeps the OpusHead fields big-endian, Ogg wants them little-endian.
+	head := []byte("OpusHead")
+	head = append(head, 1, dops[1])
+	head = binary.LittleEndian.AppendUint16(head, binary.BigEndian.Uint16(dops[2:4]))
+	head = binary.LittleEndian.AppendUint32(head, binary.BigEndian.Uint32(dops[4:8]))
+	head = binary.LittleEndian.AppendUint16(head, binary.BigEndian.Uint16(dops[8:10]))
+	head = append(head, dops[10:]...)
+
+	if err := ow.writePacket(head, 0); err != nil {
+		return err
+	}
+
+	if err := ow.flush(false); err != nil {
+		return err
+	}
+
+	vendor := "gosberbot"
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+
+	if err := ow.writePacket(tags, 0); err != nil {
+		return err
+	}
+
+	if err := ow.flush(false); err != nil {
+		return err
+	}
+
+	timescale := int64(track.Timescale)
+	if timescale == 0 {
+		timescale = 48000
+	}
+
+	var granule int64
+
+	for _, s := range track.Samples {
+		packet := make([]byte, s.Size)
+
+		if _, err := r.ReadAt(packet, s.Offset); err != nil {
+			return fmt.Errorf("failed to read Opus packet: %w", err)
+		}
+
+		granule += int64(s.Duration) * 48000 / timescale
+
+		if err := ow.writePacket(packet, granule); err != nil {
+			return err
+		}
+	}
+
+	return ow.flush(true)
+}
+
+// writePacket adds the packet to the current page, the page is flushed first
+// when the packet does not fit into it.
+func (o *oggWriter) writePacket(packet []byte, granule int64) error {
+	lacing := len(packet)/255 + 1
+
+	if len(o.segments)+lacing > oggMaxSegments {
+		if err := o.flush(false); err != nil {
+			return err
+		}
+	}
+
+	for n := len(packet); n >= 255; n -= 255 {
+		o.segments = append(o.segments, 255)
+	}
+
+	o.segments = append(o.segments, byte(len(packet)%255))
+	o.body = append(o.body, packet...)
+	o.granule = granule
+
+	return nil
+}
+
+func (o *oggWriter) flush(last bool) error {
+	if len(o.segments) == 0 {
+		return nil
+	}
+
+	var flags byte
+	if !o.started {
+		flags |= 0x02
+		o.started = true
+	}
+
+	if last {
+		flags |= 0x04
+	}
+
+	page := []byte("OggS")
+	page = append(page, 0, flags)
+	page = binary.LittleEndian.AppendUint64(page, uint64(o.granule))
+	page = binary.LittleEndian.AppendUint32(page, o.serial)
+	page = binary.LittleEndian.AppendUint32(page, o.sequence)
+	page = binary.LittleEndian.AppendUint32(page, 0)
+	page = append(page, byte(len(o.segments)))
+	page = append(page, o.segments...)
+	page = append(page, o.body...)
+
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+
+	if _, err := o.w.Write(page); err != nil {
+		return fmt.Errorf("failed to write Ogg page: %w", err)
+	}
+
+	o.sequence++
+	o.segments = o.segments[:0]
+	o.body = o.body[:0]
+
+	return nil
+}
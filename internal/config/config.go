@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gosberbot/internal/logging"
+	"gosberbot/internal/provider/gigachat"
+	"gosberbot/internal/provider/oauth"
+	"gosberbot/internal/provider/salutespeech"
+	"gosberbot/internal/provider/telegram"
+	"gosberbot/internal/queue"
+	"gosberbot/internal/ratelimit"
+	"gosberbot/internal/service"
+	"gosberbot/internal/tools"
+	"log/slog"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const masked = "****"
+
+type Config struct {
+	Telegram     telegram.Config     `yaml:"telegram"`
+	GigaChat     gigachat.Config     `yaml:"gigachat"`
+	SaluteSpeech salutespeech.Config `yaml:"salutespeech"`
+	OAuth        OAuthConfig         `yaml:"oauth"`
+	Queue        QueueConfig         `yaml:"queue"`
+	RateLimit    ratelimit.Config    `yaml:"ratelimit"`
+	HTTP         HTTPConfig          `yaml:"http"`
+	Service      service.Config      `yaml:"service"`
+	Tools        tools.Config        `yaml:"tools"`
+	Log          LogConfig           `yaml:"log"`
+}
+
+type OAuthConfig struct {
+	Url string `yaml:"url"`
+}
+
+type QueueConfig struct {
+	Dir         string `yaml:"dir"`
+	MaxAttempts int    `yaml:"max_attempts"`
+	// MaxPending is the queue length above which the bot reports not ready.
+	MaxPending int `yaml:"max_pending"`
+}
+
+type HTTPConfig struct {
+	// Addr is where the metrics and health endpoints listen, empty disables them.
+	Addr string `yaml:"addr"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+func Default() Config {
+	return Config{
+		Telegram:     telegram.DefaultConfig(),
+		GigaChat:     gigachat.DefaultConfig(),
+		SaluteSpeech: salutespeech.DefaultConfig(),
+		OAuth:        OAuthConfig{Url: oauth.DefaultUrl},
+		Queue:        QueueConfig{Dir: "data/queue", MaxAttempts: queue.DefaultMaxAttempts, MaxPending: 100},
+		RateLimit:    ratelimit.DefaultConfig(),
+		HTTP:         HTTPConfig{Addr: ":9090"},
+		Service:      service.DefaultConfig(),
+		Tools:        tools.DefaultConfig(),
+		Log:          LogConfig{Level: "info", Format: logging.FormatJSON},
+	}
+}
+
+// Validate checks every section and reports all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	check := func(section string, err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				errs = append(errs, fmt.Errorf("%s: %w", section, err))
+			}
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+
+	check("telegram", c.Telegram.Validate())
+	check("gigachat", c.GigaChat.Validate())
+	check("salutespeech", c.SaluteSpeech.Validate())
+
+	if c.OAuth.Url == "" {
+		errs = append(errs, errors.New("oauth: url is required"))
+	}
+
+	if c.Queue.Dir == "" {
+		errs = append(errs, errors.New("queue: dir is required"))
+	}
+
+	if c.Queue.MaxAttempts < 1 {
+		errs = append(errs, errors.New("queue: max_attempts must be positive"))
+	}
+
+	if c.Queue.MaxPending < 1 {
+		errs = append(errs, errors.New("queue: max_pending must be positive"))
+	}
+
+	check("ratelimit", c.RateLimit.Validate())
+	check("service", c.Service.Validate())
+	check("tools", c.Tools.Validate())
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log: unknown level %q", c.Log.Level))
+	}
+
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		errs = append(errs, fmt.Errorf("log: format must be %s or %s", logging.FormatJSON, logging.FormatText))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Secrets lists the values of fields tagged secret, for log redaction.
+func (c Config) Secrets() []string {
+	var secrets []string
+
+	walk(reflect.ValueOf(&c).Elem(), nil, func(f field) {
+		if f.secret && f.value.String() != "" {
+			secrets = append(secrets, f.value.String())
+		}
+	})
+
+	return secrets
+}
+
+// Masked returns the effective config as YAML with secrets replaced.
+func (c Config) Masked() string {
+	walk(reflect.ValueOf(&c).Elem(), nil, func(f field) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString(masked)
+		}
+	})
+
+	out, err := yaml.Marshal(c)
+
+	if err != nil {
+		return fmt.Sprintf("failed to marshal config: %v", err)
+	}
+
+	return string(out)
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMasked(t *testing.T) {
+	cfg := Default()
+	cfg.Telegram.Token = "123456:bot-token"
+	cfg.GigaChat.AuthKey = "gigachat-key"
+	cfg.GigaChat.Model = "GigaChat-Pro"
+
+	out := cfg.Masked()
+
+	for _, secret := range []string{"123456:bot-token", "gigachat-key"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("Masked() shows %q:\n%s", secret, out)
+		}
+	}
+
+	// Set secrets are masked, empty ones stay empty, the rest is shown.
+	for _, want := range []string{"token: '****'", "auth_key: '****'", "auth_key: \"\"", "model: GigaChat-Pro"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("Masked() lacks %q:\n%s", want, out)
+		}
+	}
+
+	if cfg.Telegram.Token != "123456:bot-token" {
+		t.Fatalf("Masked() changed the config, token = %q", cfg.Telegram.Token)
+	}
+
+	if secrets := cfg.Secrets(); !slices.Equal(secrets, []string{"123456:bot-token", "gigachat-key"}) {
+		t.Fatalf("Secrets() = %q, want the token and the GigaChat key", secrets)
+	}
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a settable leaf of the config tree.
+type field struct {
+	// key is the dotted YAML path, also used as the flag name.
+	key    string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// Load builds the config from the defaults, then the YAML file given by
+// -config or CONFIG_FILE, then the environment and finally the command line
+// flags, each overriding the previous. The result is validated.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("gosberbot", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file (env CONFIG_FILE)")
+
+	type override struct {
+		f     field
+		value string
+	}
+
+	var overrides []override
+
+	walk(reflect.ValueOf(&cfg).Elem(), nil, func(f field) {
+		fs.Func(f.key, "sets "+f.key+" (env "+f.env+")", func(s string) error {
+			overrides = append(overrides, override{f, s})
+			return nil
+		})
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *path != "" {
+		if err := loadFile(*path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+
+	walk(reflect.ValueOf(&cfg).Elem(), nil, func(f field) {
+		v, ok := os.LookupEnv(f.env)
+
+		if !ok || v == "" {
+			return
+		}
+
+		if err := set(f.value, v); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", f.env, err))
+		}
+	})
+
+	for _, o := range overrides {
+		if err := set(o.f.value, o.value); err != nil {
+			errs = append(errs, fmt.Errorf("flag -%s: %w", o.f.key, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// walk calls fn for every leaf field of the struct v. Env names default to
+// the upper-cased path, e.g. GIGACHAT_MODEL, unless an env tag is set.
+func walk(v reflect.Value, path []string, fn func(field)) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		p := append(append([]string(nil), path...), name)
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			walk(v.Field(i), p, fn)
+			continue
+		}
+
+		env := sf.Tag.Get("env")
+		if env == "" {
+			env = strings.ToUpper(strings.Join(p, "_"))
+		}
+
+		fn(field{
+			key:    strings.Join(p, "."),
+			env:    env,
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+}
+
+// set parses s into v. Slices take comma separated values.
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+
+		v.SetBool(b)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+
+		for _, item := range strings.Split(s, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			elem := reflect.New(v.Type().Elem()).Elem()
+
+			if err := set(elem, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+
+			list = reflect.Append(list, elem)
+		}
+
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
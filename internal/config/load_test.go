@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// secrets lets a config pass validation.
+const secrets = `
+telegram:
+  token: file-bot-token
+gigachat:
+  auth_key: file-gigachat-key
+salutespeech:
+  auth_key: file-speech-key
+service:
+  access:
+    open: true
+`
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// clearEnv hides the variables Load reads that the host may have set.
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{"CONFIG_FILE", "BOT_TOKEN", "GIGACHAT_AUTH_KEY", "SALUTESPEECH_AUTH_KEY", "GIGACHAT_MODEL", "QUEUE_MAX_ATTEMPTS", "SERVICE_ACCESS_OPEN"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := strings.Replace(secrets, "gigachat:\n", "gigachat:\n  model: File\n", 1)
+
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		model string
+		token string
+	}{
+		{name: "default", file: secrets, model: Default().GigaChat.Model, token: "file-bot-token"},
+		{name: "file", file: file, model: "File", token: "file-bot-token"},
+		{name: "env over file", file: file, env: map[string]string{"GIGACHAT_MODEL": "Env", "BOT_TOKEN": "env-bot-token"}, model: "Env", token: "env-bot-token"},
+		{name: "empty env", file: secrets, env: map[string]string{"BOT_TOKEN": ""}, model: Default().GigaChat.Model, token: "file-bot-token"},
+		{name: "flag over env", file: secrets, env: map[string]string{"GIGACHAT_MODEL": "Env"}, args: []string{"-gigachat.model", "Flag", "-telegram.token", "flag-bot-token"}, model: "Flag", token: "flag-bot-token"},
+		{name: "last flag wins", file: secrets, args: []string{"-gigachat.model=One", "-gigachat.model=Two"}, model: "Two", token: "file-bot-token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load(append([]string{"-config", writeConfig(t, test.file)}, test.args...))
+
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.GigaChat.Model != test.model || cfg.Telegram.Token != test.token {
+				t.Fatalf("model, token = %q, %q, want %q, %q", cfg.GigaChat.Model, cfg.Telegram.Token, test.model, test.token)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeConfig(t, secrets+"queue:\n  max_attempts: 7\n"))
+
+	cfg, err := Load(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Queue.MaxAttempts != 7 {
+		t.Fatalf("queue.max_attempts = %d, want 7 from CONFIG_FILE", cfg.Queue.MaxAttempts)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		wants []string
+	}{
+		{name: "missing secrets", file: "service:\n  access:\n    open: true\n", wants: []string{"telegram: token is required", "gigachat: auth_key is required", "salutespeech: auth_key is required"}},
+		{name: "unknown field", file: secrets + "unknown: 1\n", wants: []string{"field unknown not found"}},
+		{name: "bad env", file: secrets, env: map[string]string{"QUEUE_MAX_ATTEMPTS": "many"}, wants: []string{"env QUEUE_MAX_ATTEMPTS", `invalid number "many"`}},
+		{name: "bad flag", file: secrets, args: []string{"-queue.max_attempts", "many"}, wants: []string{"flag -queue.max_attempts"}},
+		{name: "invalid values", file: secrets + "queue:\n  max_attempts: 0\nlog:\n  level: loud\n  format: xml\n", wants: []string{"queue: max_attempts must be positive", `log: unknown level "loud"`, "log: format must be"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := Load(append([]string{"-config", writeConfig(t, test.file)}, test.args...))
+
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+
+			for _, want := range test.wants {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("Load() error = %v, want %q in it", err, want)
+				}
+			}
+		})
+	}
+
+	clearEnv(t)
+
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Fatal("Load() of a missing file error = nil")
+	}
+}
@@ -0,0 +1,94 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrUnsupported = errors.New("unsupported document format")
+
+// ExtractFile returns the text of a plain text, Markdown, DOCX or PDF file.
+// The format is detected from the content, name is only used for messages.
+func ExtractFile(filename, name string) (string, error) {
+	data, err := os.ReadFile(filename)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return Extract(data, name)
+}
+
+func Extract(data []byte, name string) (string, error) {
+	var (
+		text string
+		err  error
+	)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		text, err = extractPDF(data)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		text, err = extractDOCX(data)
+	case bytes.HasPrefix(data, []byte("\xD0\xCF\x11\xE0")):
+		err = fmt.Errorf("%w: legacy Office file, save it as DOCX or PDF", ErrUnsupported)
+	case utf8.Valid(data):
+		text = string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")))
+	default:
+		err = fmt.Errorf("%w: %s is not UTF-8 text", ErrUnsupported, formatName(name))
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return clean(text), nil
+}
+
+func formatName(name string) string {
+	if ext := strings.TrimPrefix(filepath.Ext(name), "."); ext != "" {
+		return strings.ToUpper(ext)
+	}
+
+	return "the file"
+}
+
+// clean drops control characters and trailing spaces and squeezes runs of
+// blank lines, extractors leave plenty of both.
+func clean(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var b strings.Builder
+
+	blank := 0
+
+	for line := range strings.Lines(text) {
+		line = strings.TrimRightFunc(strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || !unicode.IsControl(r) && r != utf8.RuneError {
+				return r
+			}
+
+			return -1
+		}, line), unicode.IsSpace)
+
+		if line == "" {
+			blank++
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString(strings.Repeat("\n", min(blank, 1)+1))
+		}
+
+		b.WriteString(line)
+		blank = 0
+	}
+
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxPartSize bounds the uncompressed size of a DOCX part or a PDF stream.
+const maxPartSize = 64 << 20
+
+// extractDOCX reads the paragraphs of the main document part. Headers,
+// footnotes and comments live in other parts and are left out.
+func extractDOCX(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		return "", fmt.Errorf("%w: broken ZIP archive: %v", ErrUnsupported, err)
+	}
+
+	f, err := archive.Open("word/document.xml")
+
+	if err != nil {
+		return "", fmt.Errorf("%w: ZIP archive without word/document.xml", ErrUnsupported)
+	}
+
+	defer f.Close()
+
+	var b strings.Builder
+
+	dec := xml.NewDecoder(io.LimitReader(f, maxPartSize))
+	inText := false
+
+	for {
+		tok, err := dec.Token()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("%w: broken document.xml: %v", ErrUnsupported, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,63 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testDOCX(files map[string]string) []byte {
+	var b bytes.Buffer
+
+	w := zip.NewWriter(&b)
+
+	for name, content := range files {
+		f, _ := w.Create(name)
+		f.Write([]byte(content))
+	}
+
+	w.Close()
+
+	return b.Bytes()
+}
+
+func TestExtractDOCX(t *testing.T) {
+	body := `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Hello</w:t><w:tab/><w:t>world</w:t></w:r></w:p><w:p><w:r><w:t>Bye</w:t></w:r></w:p></w:body></w:document>`
+
+	tests := []struct {
+		name string
+		data []byte
+		text string
+	}{
+		{name: "valid", data: testDOCX(map[string]string{"word/document.xml": body}), text: "Hello\tworld\nBye\n"},
+		{name: "not a zip", data: []byte("PK\x03\x04 broken")},
+		{name: "no document part", data: testDOCX(map[string]string{"word/other.xml": body})},
+		{name: "broken XML", data: testDOCX(map[string]string{"word/document.xml": "<w:document><w:t>text"})},
+		{name: "truncated", data: testDOCX(map[string]string{"word/document.xml": body})[:60]},
+		{name: "deep nesting", data: testDOCX(map[string]string{"word/document.xml": strings.Repeat("<a>", 100000)})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := extractDOCX(test.data)
+
+			if test.text == "" {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("extractDOCX() error = %v, want ErrUnsupported", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extractDOCX() error = %v", err)
+			}
+
+			if text != test.text {
+				t.Fatalf("extractDOCX() = %q, want %q", text, test.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// minPDFLetters is how many letters a PDF needs to count as having text,
+// scans have none or a few from stamps and page numbers.
+const minPDFLetters = 20
+
+// maxPDFInflated bounds the data inflated from all the streams of a PDF,
+// pages and forms may refer to the same compressed stream many times.
+const maxPDFInflated = 256 << 20
+
+var (
+	objectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	reference    = regexp.MustCompile(`^(\d+)\s+\d+\s+R\b`)
+	references   = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	namedRef     = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s*(\d+)\s+\d+\s+R\b`)
+	pageType     = regexp.MustCompile(`/Type\s*/Page\b`)
+	catalogType  = regexp.MustCompile(`/Type\s*/Catalog\b`)
+	objStmType   = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	formType     = regexp.MustCompile(`/Subtype\s*/Form\b`)
+	type0Font    = regexp.MustCompile(`/Subtype\s*/Type0\b`)
+)
+
+// pdfObject is an indirect object: a dictionary or another value and the
+// raw data of its stream, if any.
+type pdfObject struct {
+	value  []byte
+	stream []byte
+}
+
+// pdfFile is a forgiving PDF reader. It doesn't use the cross-reference
+// table and finds the objects by scanning the file, so damaged files and
+// incremental updates still read, the last definition of an object wins.
+type pdfFile struct {
+	objects map[int]*pdfObject
+	fonts   map[int]*cmap
+	// inflated counts the bytes decode inflated so far.
+	inflated int
+}
+
+// resources are the fonts and form XObjects a content stream refers to.
+type resources struct {
+	fonts map[string]*cmap
+	forms map[string]int
+}
+
+// extractPDF reads the text drawn by the content streams of the pages, in
+// page order. Fonts with a ToUnicode map decode exactly, simple fonts
+// without one are read as Windows-1252.
+func extractPDF(data []byte) (string, error) {
+	f := parsePDF(data)
+
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", fmt.Errorf("%w: encrypted PDF", ErrUnsupported)
+	}
+
+	pages := f.pages()
+
+	if len(pages) == 0 {
+		return "", fmt.Errorf("%w: no pages in the PDF", ErrUnsupported)
+	}
+
+	var b strings.Builder
+
+	for _, page := range pages {
+		res := f.resources(page)
+
+		for _, num := range references.FindAllSubmatch(dictValue(page.value, "/Contents"), -1) {
+			if content, ok := f.decode(f.objects[atoi(num[1])]); ok {
+				f.showText(&b, content, res, 0)
+			}
+		}
+
+		b.WriteString("\n\n")
+	}
+
+	text := b.String()
+
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+
+	if letters < minPDFLetters {
+		return "", fmt.Errorf("%w: the PDF has no text layer, it may be a scan", ErrUnsupported)
+	}
+
+	return text, nil
+}
+
+func parsePDF(data []byte) *pdfFile {
+	f := &pdfFile{objects: make(map[int]*pdfObject), fonts: make(map[int]*cmap)}
+
+	end := 0
+
+	for _, m := range objectHeader.FindAllSubmatchIndex(data, -1) {
+		// Skip matches inside the stream of the previous object.
+		if m[0] < end {
+			continue
+		}
+
+		obj, size := readObject(data[m[1]:])
+		f.objects[atoi(data[m[2]:m[3]])] = obj
+		end = m[1] + size
+	}
+
+	// Since PDF 1.5 most objects may sit compressed in object streams.
+	for _, num := range slices.Sorted(maps.Keys(f.objects)) {
+		if obj := f.objects[num]; objStmType.Match(obj.value) {
+			f.unpack(obj)
+		}
+	}
+
+	return f
+}
+
+// readObject reads the object body after "N G obj" and returns it with the
+// number of bytes it takes.
+func readObject(data []byte) (*pdfObject, int) {
+	end := bytes.Index(data, []byte("endobj"))
+	if end < 0 {
+		end = len(data)
+	}
+
+	start := bytes.Index(data[:end], []byte("stream"))
+
+	if start < 0 {
+		return &pdfObject{value: bytes.TrimSpace(data[:end])}, end
+	}
+
+	obj := &pdfObject{value: bytes.TrimSpace(data[:start])}
+
+	start += len("stream")
+	if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+
+	// Trust a direct /Length that ends at endstream, binary data may hold
+	// the word itself.
+	if n, err := strconv.Atoi(string(dictValue(obj.value, "/Length"))); err == nil && n >= 0 && n <= len(data)-start {
+		if bytes.HasPrefix(bytes.TrimLeft(data[start+n:], "\r\n "), []byte("endstream")) {
+			obj.stream = data[start : start+n]
+			return obj, start + n
+		}
+	}
+
+	stop := bytes.Index(data[start:], []byte("endstream"))
+	if stop < 0 {
+		return obj, end
+	}
+
+	obj.stream = bytes.TrimRight(data[start:start+stop], "\r\n")
+
+	return obj, start + stop
+}
+
+// unpack adds the objects of an object stream that were not defined
+// directly.
+func (f *pdfFile) unpack(stm *pdfObject) {
+	data, ok := f.decode(stm)
+
+	if !ok {
+		return
+	}
+
+	n, _ := strconv.Atoi(string(dictValue(stm.value, "/N")))
+	first, err := strconv.Atoi(string(dictValue(stm.value, "/First")))
+
+	if err != nil || first < 0 || first > len(data) {
+		return
+	}
+
+	header := strings.Fields(string(data[:first]))
+
+	for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+		num, _ := strconv.Atoi(header[i])
+		start, _ := strconv.Atoi(header[i+1])
+		end := len(data) - first
+
+		if i+3 < len(header) {
+			end, _ = strconv.Atoi(header[i+3])
+		}
+
+		if start < 0 || start > end || first+end > len(data) {
+			return
+		}
+
+		if _, ok := f.objects[num]; !ok {
+			f.objects[num] = &pdfObject{value: bytes.TrimSpace(data[first+start : first+end])}
+		}
+	}
+}
+
+// decode returns the stream data of the object. Only unfiltered and Flate
+// streams can be read, which covers text content. Once the document used up
+// maxPDFInflated no more streams are inflated.
+func (f *pdfFile) decode(obj *pdfObject) ([]byte, bool) {
+	if obj == nil || obj.stream == nil {
+		return nil, false
+	}
+
+	switch string(bytes.Trim(f.resolve(dictValue(obj.value, "/Filter")), "[] \r\n")) {
+	case "":
+		return obj.stream, true
+	case "/FlateDecode":
+	default:
+		return nil, false
+	}
+
+	budget := min(maxPartSize, maxPDFInflated-f.inflated)
+
+	if budget <= 0 {
+		return nil, false
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(obj.stream))
+
+	if err != nil {
+		return nil, false
+	}
+
+	// Keep what was inflated before a corrupted tail.
+	data, _ := io.ReadAll(io.LimitReader(r, int64(budget)))
+	f.inflated += len(data)
+
+	return data, len(data) > 0
+}
+
+// resolve returns the value of the referenced object or the value itself.
+func (f *pdfFile) resolve(value []byte) []byte {
+	m := reference.FindSubmatch(value)
+
+	if m == nil {
+		return value
+	}
+
+	if obj := f.objects[atoi(m[1])]; obj != nil {
+		return obj.value
+	}
+
+	return nil
+}
+
+// pages walks the page tree from the catalog, falling back to all page
+// objects by number when the tree is broken.
+func (f *pdfFile) pages() []*pdfObject {
+	var pages []*pdfObject
+
+	seen := make(map[int]bool)
+
+	var walk func(num int)
+	walk = func(num int) {
+		obj := f.objects[num]
+
+		if obj == nil || seen[num] {
+			return
+		}
+
+		seen[num] = true
+
+		if kids := dictValue(obj.value, "/Kids"); kids != nil {
+			for _, kid := range references.FindAllSubmatch(kids, -1) {
+				walk(atoi(kid[1]))
+			}
+		} else if pageType.Match(obj.value) {
+			pages = append(pages, obj)
+		}
+	}
+
+	nums := slices.Sorted(maps.Keys(f.objects))
+
+	for _, num := range nums {
+		if obj := f.objects[num]; catalogType.Match(obj.value) {
+			if m := reference.FindSubmatch(dictValue(obj.value, "/Pages")); m != nil {
+				walk(atoi(m[1]))
+			}
+		}
+	}
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range nums {
+		if obj := f.objects[num]; pageType.Match(obj.value) && dictValue(obj.value, "/Kids") == nil {
+			pages = append(pages, obj)
+		}
+	}
+
+	return pages
+}
+
+// resources returns the resources of the page or form, pages inherit them
+// from their parents.
+func (f *pdfFile) resources(obj *pdfObject) resources {
+	res := resources{fonts: make(map[string]*cmap), forms: make(map[string]int)}
+
+	for depth := 0; obj != nil && depth < 32; depth++ {
+		if value := dictValue(obj.value, "/Resources"); value != nil {
+			dict := f.resolve(value)
+
+			for _, m := range namedRef.FindAllSubmatch(f.resolve(dictValue(dict, "/Font")), -1) {
+				res.fonts[string(m[1])] = f.font(atoi(m[2]))
+			}
+
+			for _, m := range namedRef.FindAllSubmatch(f.resolve(dictValue(dict, "/XObject")), -1) {
+				res.forms[string(m[1])] = atoi(m[2])
+			}
+
+			break
+		}
+
+		m := reference.FindSubmatch(dictValue(obj.value, "/Parent"))
+
+		if m == nil {
+			break
+		}
+
+		obj = f.objects[atoi(m[1])]
+	}
+
+	return res
+}
+
+// font returns the map from character codes to text of the font, nil for
+// a simple font without a ToUnicode map.
+func (f *pdfFile) font(num int) *cmap {
+	if c, ok := f.fonts[num]; ok {
+		return c
+	}
+
+	var c *cmap
+
+	if obj := f.objects[num]; obj != nil {
+		if m := reference.FindSubmatch(dictValue(obj.value, "/ToUnicode")); m != nil {
+			if data, ok := f.decode(f.objects[atoi(m[1])]); ok {
+				c = parseCMap(data)
+			}
+		}
+
+		// Composite fonts use two byte glyph IDs that mean nothing without a
+		// ToUnicode map, showing nothing beats showing garbage.
+		if c == nil && type0Font.Match(obj.value) {
+			c = &cmap{width: 2}
+		}
+	}
+
+	f.fonts[num] = c
+
+	return c
+}
+
+// dictValue returns the raw value of the key in the dictionary: a nested
+// dictionary or array, a reference or a single token. Nested dictionaries
+// are searched too, which is what resource lookups need.
+func dictValue(dict []byte, key string) []byte {
+	for pos := 0; ; {
+		i := bytes.Index(dict[pos:], []byte(key))
+
+		if i < 0 {
+			return nil
+		}
+
+		pos += i + len(key)
+
+		if pos < len(dict) && !isDelimiter(dict[pos]) && !isSpace(dict[pos]) {
+			continue
+		}
+
+		rest := bytes.TrimLeft(dict[pos:], " \t\r\n\f\x00")
+
+		switch {
+		case bytes.HasPrefix(rest, []byte("<<")):
+			return balanced(rest, "<<", ">>")
+		case bytes.HasPrefix(rest, []byte("[")):
+			return balanced(rest, "[", "]")
+		}
+
+		if m := reference.Find(rest); m != nil {
+			return m
+		}
+
+		end := 1
+		for end < len(rest) && !isDelimiter(rest[end]) && !isSpace(rest[end]) {
+			end++
+		}
+
+		return rest[:min(end, len(rest))]
+	}
+}
+
+// balanced returns the prefix of data up to the close matching its open.
+func balanced(data []byte, open, close string) []byte {
+	depth := 0
+
+	for i := 0; i < len(data); {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte(open)):
+			depth++
+			i += len(open)
+		case bytes.HasPrefix(data[i:], []byte(close)):
+			depth--
+			i += len(close)
+
+			if depth == 0 {
+				return data[:i]
+			}
+		default:
+			i++
+		}
+	}
+
+	return data
+}
+
+func atoi(b []byte) int {
+	n, _ := strconv.Atoi(string(b))
+	return n
+}
@@ -0,0 +1,129 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const testText = "The quick brown fox jumps over the lazy dog"
+
+// testPDF numbers the objects from 1, the first is the catalog.
+func testPDF(objects ...string) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("%PDF-1.7\n")
+
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	b.WriteString("%%EOF\n")
+
+	return b.Bytes()
+}
+
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+
+	return b.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	content := []byte("BT /F1 12 Tf (" + testText + ") Tj ET")
+
+	catalog := "<< /Type /Catalog /Pages 2 0 R >>"
+	pages := "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+	page := "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>"
+
+	tests := []struct {
+		name string
+		data []byte
+		text string
+	}{
+		{name: "plain", data: testPDF(catalog, pages, page, stream("", content)), text: testText},
+		{name: "flate", data: testPDF(catalog, pages, page, stream("/Filter /FlateDecode", deflate(content))), text: testText},
+		{name: "length overflow", data: testPDF(catalog, pages, page, strings.Replace(stream("", content), fmt.Sprint(len(content)), "9223372036854775807", 1)), text: testText},
+		{name: "negative length", data: testPDF(catalog, pages, page, strings.Replace(stream("", content), fmt.Sprint(len(content)), "-5", 1)), text: testText},
+		{name: "page tree loop", data: testPDF(catalog, "<< /Type /Pages /Kids [2 0 R 3 0 R] >>", page, stream("", content)), text: testText},
+		{name: "no pages", data: testPDF(catalog)},
+		{name: "no text", data: testPDF(catalog, pages, page, stream("", []byte("0 0 m 10 10 l S")))},
+		{name: "encrypted", data: testPDF(catalog, pages, page, stream("", content), "<< /Encrypt 6 0 R >>")},
+		{name: "truncated", data: testPDF(catalog, pages, page, stream("", content))[:120]},
+		{name: "broken object stream", data: testPDF(catalog, pages, page, stream("/Type /ObjStm /N 3 /First 9999", []byte("5 0 6 -4 7 99999")))},
+		{name: "object stream offsets", data: testPDF(catalog, pages, page, stream("/Type /ObjStm /N 3 /First 10", []byte("5 7 6 2 7 -1 (text)")))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := extractPDF(test.data)
+
+			if test.text == "" {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("extractPDF() error = %v, want ErrUnsupported", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extractPDF() error = %v", err)
+			}
+
+			if !strings.Contains(text, test.text) {
+				t.Fatalf("extractPDF() = %q, want %q", text, test.text)
+			}
+		})
+	}
+}
+
+func TestPDFInflateBudget(t *testing.T) {
+	f := &pdfFile{inflated: maxPDFInflated - 10}
+	obj := &pdfObject{value: []byte("<< /Filter /FlateDecode >>"), stream: deflate(make([]byte, 100))}
+
+	data, ok := f.decode(obj)
+
+	if !ok || len(data) != 10 {
+		t.Fatalf("decode() = %d bytes, want the 10 left in the budget", len(data))
+	}
+
+	if _, ok := f.decode(obj); ok {
+		t.Fatal("decode() succeeded after the budget was used up")
+	}
+}
+
+func TestExtractPDFMalformed(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	valid := testPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> /XObject << /X1 3 0 R >> >> /Contents 4 0 R >>",
+		stream("/Filter /FlateDecode", deflate([]byte("BT /F1 12 Tf [(Hello) 10 (world)] TJ ET /X1 Do"))),
+		"<< /Type /Font /Subtype /Type0 /ToUnicode 6 0 R >>",
+		stream("", []byte("begincodespacerange <0000> <FFFF> endcodespacerange beginbfrange <0000> <FFFF> <0041> endbfrange")),
+	)
+
+	// Damaged copies of a valid file mostly fail, they must not panic.
+	for i := 0; i < 2000; i++ {
+		data := bytes.Clone(valid)
+
+		for j := r.Intn(8); j >= 0; j-- {
+			data[r.Intn(len(data))] = byte(r.Intn(256))
+		}
+
+		_, _ = extractPDF(data[:r.Intn(len(data)+1)])
+	}
+}
@@ -0,0 +1,521 @@
+package document
+
+import (
+	"bytes"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxFormDepth bounds forms drawing forms.
+const maxFormDepth = 8
+
+// maxCMapRange bounds one bfrange of a ToUnicode map.
+const maxCMapRange = 1 << 16
+
+type tokenKind int
+
+const (
+	tokenOperator tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenName
+	tokenArrayStart
+	tokenArrayEnd
+	tokenOther
+)
+
+type token struct {
+	kind tokenKind
+	text []byte
+	num  float64
+}
+
+// operand is a content stream operand, arrays keep their elements.
+type operand struct {
+	token
+	array []token
+}
+
+// showText writes the text the content stream draws. Line breaks come from
+// text positioning: moving to another line starts a new line, a big gap in
+// a TJ array becomes a space.
+func (f *pdfFile) showText(b *strings.Builder, content []byte, res resources, depth int) {
+	lex := &lexer{data: content}
+
+	var (
+		operands []operand
+		font     *cmap
+		array    []token
+		inArray  bool
+		lastY    float64
+	)
+
+	for {
+		tok, ok := lex.next()
+
+		if !ok {
+			return
+		}
+
+		switch {
+		case tok.kind == tokenArrayStart:
+			inArray, array = true, nil
+			continue
+		case tok.kind == tokenArrayEnd:
+			inArray = false
+			operands = append(operands, operand{token: tok, array: array})
+			continue
+		case inArray:
+			array = append(array, tok)
+			continue
+		case tok.kind != tokenOperator:
+			operands = append(operands, operand{token: tok})
+			continue
+		}
+
+		switch op := string(tok.text); op {
+		case "Tf":
+			if len(operands) >= 2 {
+				font = res.fonts[string(operands[len(operands)-2].text)]
+			}
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				newline(b)
+			}
+
+			if len(operands) > 0 {
+				b.WriteString(font.decode(operands[len(operands)-1].text))
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+
+			for _, el := range operands[len(operands)-1].array {
+				switch {
+				case el.kind == tokenString:
+					b.WriteString(font.decode(el.text))
+				case el.kind == tokenNumber && el.num < -200:
+					space(b)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 && operands[len(operands)-1].num != 0 {
+				newline(b)
+			} else {
+				space(b)
+			}
+		case "T*":
+			newline(b)
+		case "Tm":
+			if len(operands) >= 6 {
+				if y := operands[len(operands)-1].num; y != lastY {
+					newline(b)
+					lastY = y
+				} else {
+					space(b)
+				}
+			}
+		case "BT", "ET":
+			space(b)
+		case "Do":
+			if len(operands) == 0 || depth >= maxFormDepth {
+				break
+			}
+
+			num, ok := res.forms[string(operands[len(operands)-1].text)]
+			obj := f.objects[num]
+
+			if !ok || obj == nil || !formType.Match(obj.value) {
+				break
+			}
+
+			if data, ok := f.decode(obj); ok {
+				formRes := f.resources(obj)
+				if len(formRes.fonts) == 0 {
+					formRes = res
+				}
+
+				f.showText(b, data, formRes, depth+1)
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+
+		operands = operands[:0]
+	}
+}
+
+func newline(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		b.WriteByte('\n')
+	}
+}
+
+func space(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		b.WriteByte(' ')
+	}
+}
+
+// lexer splits a content stream into tokens. Dictionaries and procedures
+// are returned as tokenOther, the text extraction doesn't need them.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *lexer) next() (token, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return token{kind: tokenString, text: l.literal()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<', c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return token{kind: tokenOther}, true
+		case c == '<':
+			return token{kind: tokenString, text: l.hexString()}, true
+		case c == '[':
+			l.pos++
+			return token{kind: tokenArrayStart}, true
+		case c == ']':
+			l.pos++
+			return token{kind: tokenArrayEnd}, true
+		case c == '/':
+			l.pos++
+			return token{kind: tokenName, text: l.word()}, true
+		case isDelimiter(c):
+			l.pos++
+			return token{kind: tokenOther}, true
+		default:
+			word := l.word()
+
+			if num, err := strconv.ParseFloat(string(word), 64); err == nil {
+				return token{kind: tokenNumber, text: word, num: num}, true
+			}
+
+			return token{kind: tokenOperator, text: word}, true
+		}
+	}
+
+	return token{}, false
+}
+
+func (l *lexer) word() []byte {
+	start := l.pos
+
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+
+	// A stray delimiter must not stop the lexer.
+	if l.pos == start {
+		l.pos++
+	}
+
+	return l.data[start:l.pos]
+}
+
+// literal reads a (string) with its escapes, parentheses may nest.
+func (l *lexer) literal() []byte {
+	var out []byte
+
+	depth := 0
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+
+			depth++
+		case ')':
+			depth--
+
+			if depth == 0 {
+				return out
+			}
+
+			out = append(out, c)
+		case '\\':
+			if l.pos == len(l.data) {
+				return out
+			}
+
+			e := l.data[l.pos]
+			l.pos++
+
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e < '0' || e > '7' {
+					out = append(out, e)
+					break
+				}
+
+				n := int(e - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					n = n*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+
+				out = append(out, byte(n))
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+func (l *lexer) hexString() []byte {
+	l.pos++
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+
+	raw := l.data[l.pos : l.pos+end]
+	l.pos += min(end+1, len(l.data)-l.pos)
+
+	return decodeHex(raw)
+}
+
+// skipInlineImage moves past the data of an inline image to its EI.
+func (l *lexer) skipInlineImage() {
+	for i := l.pos + 1; i+2 <= len(l.data); i++ {
+		if isSpace(l.data[i-1]) && l.data[i] == 'E' && l.data[i+1] == 'I' && (i+2 == len(l.data) || isSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+
+	l.pos = len(l.data)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// decodeHex reads hex digits ignoring spaces, an odd last digit is padded
+// with zero as the PDF spec says.
+func decodeHex(raw []byte) []byte {
+	digits := make([]byte, 0, len(raw)+1)
+
+	for _, c := range raw {
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(out, digits)
+
+	return out[:n]
+}
+
+// cmap maps the character codes of a font to text.
+type cmap struct {
+	width int
+	chars map[uint32]string
+}
+
+var (
+	cmapSection = regexp.MustCompile(`(?s)begin(codespacerange|bfchar|bfrange)(.*?)end(?:codespacerange|bfchar|bfrange)`)
+	cmapToken   = regexp.MustCompile(`<[0-9A-Fa-f\s]*>|\[|\]`)
+)
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap. All
+// codes are taken to be as wide as the first code space range.
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: make(map[uint32]string)}
+
+	for _, section := range cmapSection.FindAllSubmatch(data, -1) {
+		tokens := cmapToken.FindAll(section[2], -1)
+
+		switch string(section[1]) {
+		case "codespacerange":
+			if c.width == 0 && len(tokens) > 0 {
+				c.width = len(hexToken(tokens[0]))
+			}
+		case "bfchar":
+			for i := 0; i+1 < len(tokens); i += 2 {
+				if n, ok := code(tokens[i]); ok {
+					c.chars[n] = utf16Text(hexToken(tokens[i+1]))
+				}
+			}
+		case "bfrange":
+			for i := 0; i+2 < len(tokens); {
+				lo, loOK := code(tokens[i])
+				hi, hiOK := code(tokens[i+1])
+				ok := loOK && hiOK
+				i += 2
+
+				if string(tokens[i]) == "[" {
+					n := uint64(lo)
+					for i++; i < len(tokens) && string(tokens[i]) != "]"; i++ {
+						if ok && n <= uint64(hi) {
+							c.chars[uint32(n)] = utf16Text(hexToken(tokens[i]))
+							n++
+						}
+					}
+
+					i++
+					continue
+				}
+
+				dst := hexToken(tokens[i])
+				i++
+
+				if !ok || hi < lo || hi-lo >= maxCMapRange {
+					continue
+				}
+
+				// n is wider than a code, so the loop ends after the largest one.
+				for n := uint64(lo); n <= uint64(hi) && len(dst) >= 2; n++ {
+					c.chars[uint32(n)] = utf16Text(dst)
+					dst = increment(dst)
+				}
+			}
+		}
+	}
+
+	if c.width == 0 {
+		c.width = 2
+	}
+
+	return c
+}
+
+func hexToken(tok []byte) []byte {
+	if len(tok) < 2 || tok[0] != '<' {
+		return nil
+	}
+
+	return decodeHex(tok[1 : len(tok)-1])
+}
+
+// code reads a character code of one to four bytes.
+func code(tok []byte) (uint32, bool) {
+	data := hexToken(tok)
+
+	if len(data) == 0 || len(data) > 4 {
+		return 0, false
+	}
+
+	var n uint32
+	for _, c := range data {
+		n = n<<8 | uint32(c)
+	}
+
+	return n, true
+}
+
+// increment returns a copy of the UTF-16 text with its last unit plus one,
+// which is how a bfrange maps consecutive codes.
+func increment(dst []byte) []byte {
+	out := bytes.Clone(dst)
+
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+
+		if out[i] != 0 {
+			break
+		}
+	}
+
+	return out
+}
+
+func utf16Text(data []byte) string {
+	units := make([]uint16, len(data)/2)
+
+	for i := range units {
+		units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// decode turns the bytes of a shown string into text.
+func (c *cmap) decode(s []byte) string {
+	if c == nil {
+		return winAnsi(s)
+	}
+
+	var b strings.Builder
+
+	for i := 0; i+c.width <= len(s); i += c.width {
+		var n uint32
+		for _, x := range s[i : i+c.width] {
+			n = n<<8 | uint32(x)
+		}
+
+		b.WriteString(c.chars[n])
+	}
+
+	return b.String()
+}
+
+// winAnsiHigh are the Windows-1252 characters that differ from Latin-1.
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+func winAnsi(s []byte) string {
+	if bytes.HasPrefix(s, []byte{0xFE, 0xFF}) {
+		return utf16Text(s[2:])
+	}
+
+	runes := make([]rune, 0, len(s))
+
+	for _, c := range s {
+		if r, ok := winAnsiHigh[c]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, rune(c))
+		}
+	}
+
+	return string(runes)
+}
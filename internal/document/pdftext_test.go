@@ -0,0 +1,94 @@
+package document
+
+import "testing"
+
+func TestParseCMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		width int
+		chars map[uint32]string
+	}{
+		{
+			name:  "bfchar and bfrange",
+			data:  "begincodespacerange <00> <FF> endcodespacerange beginbfchar <01> <0041> endbfchar beginbfrange <02> <03> <0062> <04> <05> [<0078> <0079>] endbfrange",
+			width: 1,
+			chars: map[uint32]string{1: "A", 2: "b", 3: "c", 4: "x", 5: "y"},
+		},
+		{
+			name:  "array in codespacerange",
+			data:  "begincodespacerange [ <0000> <FFFF> endcodespacerange",
+			width: 2,
+		},
+		{
+			name:  "empty code",
+			data:  "begincodespacerange <> endcodespacerange",
+			width: 2,
+		},
+		{
+			name:  "range too large",
+			data:  "beginbfrange <00000000> <FFFFFFFF> <0041> endbfrange",
+			width: 2,
+			chars: map[uint32]string{},
+		},
+		{
+			name:  "range at the largest code",
+			data:  "beginbfrange <FFFFFFFF> <FFFFFFFF> <0041> <FFFFFFFE> <FFFFFFFF> [<0042> <0043> <0044>] endbfrange",
+			width: 2,
+			chars: map[uint32]string{0xFFFFFFFE: "B", 0xFFFFFFFF: "C"},
+		},
+		{
+			name:  "codes longer than four bytes",
+			data:  "beginbfchar <0100000041> <0041> endbfchar beginbfrange <0000000001> <0000000002> <0041> <01> <0100000002> [<0041>] endbfrange",
+			width: 2,
+			chars: map[uint32]string{},
+		},
+		{
+			name:  "array longer than the range",
+			data:  "beginbfrange <01> <02> [<0041> <0042> <0043>] endbfrange",
+			width: 2,
+			chars: map[uint32]string{1: "A", 2: "B"},
+		},
+		{
+			name:  "reversed range",
+			data:  "beginbfrange <0010> <0001> <0041> endbfrange",
+			width: 2,
+			chars: map[uint32]string{},
+		},
+		{
+			name:  "unterminated array",
+			data:  "beginbfrange <0001> <0002> [<0041> endbfrange",
+			width: 2,
+			chars: map[uint32]string{1: "A"},
+		},
+		{
+			name:  "odd tokens",
+			data:  "beginbfchar <01> endbfchar beginbfrange [ ] <0041> endbfrange",
+			width: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := parseCMap([]byte(test.data))
+
+			if c.width != test.width {
+				t.Fatalf("width = %d, want %d", c.width, test.width)
+			}
+
+			if test.chars == nil {
+				return
+			}
+
+			if len(c.chars) != len(test.chars) {
+				t.Fatalf("chars = %v, want %v", c.chars, test.chars)
+			}
+
+			for code, text := range test.chars {
+				if c.chars[code] != text {
+					t.Fatalf("chars[%d] = %q, want %q", code, c.chars[code], text)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,80 @@
 package domain
 
+import (
+	"log/slog"
+	"time"
+)
+
+type MessageKind string
+
+const (
+	KindText    MessageKind = "text"
+	KindCommand MessageKind = "command"
+	KindVoice   MessageKind = "voice"
+	KindAudio   MessageKind = "audio"
+	KindVideo   MessageKind = "video"
+	// KindDocument is a file sent as a document that is not audio or an
+	// image.
+	KindDocument MessageKind = "document"
+	// KindPhoto is a photo or an image sent as a document, Text holds the
+	// caption.
+	KindPhoto MessageKind = "photo"
+	// KindCallback is a press on an inline button, Text holds its data and
+	// ID the message carrying the buttons.
+	KindCallback MessageKind = "callback"
+)
+
+const PlatformTelegram = "telegram"
+
+// ChatRef identifies where a message came from and where the answer goes.
+type ChatRef struct {
+	Platform string `json:"platform"`
+	ChatID   int64  `json:"chat_id"`
+	UserID   int64  `json:"user_id,omitempty"`
+	UserName string `json:"user_name,omitempty"`
+	ThreadID int    `json:"thread_id,omitempty"`
+}
+
+// Attachment points to a file kept by the messenger, it is downloaded
+// through Messenger.Download when the message is processed.
+type Attachment struct {
+	FileID   string        `json:"file_id"`
+	FileName string        `json:"file_name,omitempty"`
+	MIME     string        `json:"mime,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
 type Message struct {
-	Type    string
-	Payload string
-	User    any
+	Kind          MessageKind  `json:"kind"`
+	Chat          ChatRef      `json:"chat"`
+	ID            int          `json:"id,omitempty"`
+	ReplyToID     int          `json:"reply_to_id,omitempty"`
+	Text          string       `json:"text,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	Timestamp     time.Time    `json:"timestamp"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+}
+
+// LogValue logs the message metadata only, leaving out the text users sent.
+func (m Message) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("kind", string(m.Kind)),
+		slog.Int64("chat_id", m.Chat.ChatID),
+		slog.Int64("user_id", m.Chat.UserID),
+		slog.Int("message_id", m.ID),
+		slog.String("correlation_id", m.CorrelationID),
+		slog.Int("text_length", len(m.Text)),
+	}
+
+	if len(m.Attachments) > 0 {
+		a := m.Attachments[0]
+		attrs = append(attrs, slog.Group("attachment",
+			slog.String("mime", a.MIME),
+			slog.Int64("size", a.Size),
+			slog.Duration("duration", a.Duration),
+		))
+	}
+
+	return slog.GroupValue(attrs...)
 }
@@ -0,0 +1,178 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleFunction marks the result of a function call, Name is the function.
+	RoleFunction = "function"
+)
+
+type ChatMessage struct {
+	Role         string        `json:"role"`
+	Content      string        `json:"content"`
+	Name         string        `json:"name,omitempty"`
+	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+	// Attachments are IDs of images uploaded through VisionModel.Upload.
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// Function describes a function the chat model may ask to call. Parameters
+// is the JSON schema of the arguments object.
+type Function struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// FunctionCall is the model asking to call a function. StateID is opaque
+// model state that goes back with the call in the next request.
+type FunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	StateID   string          `json:"state_id,omitempty"`
+}
+
+// Command is an entry of the messenger's command menu.
+type Command struct {
+	Name        string
+	Description string
+}
+
+// Button is an inline button, pressing it sends a KindCallback message with
+// Data as the text.
+type Button struct {
+	Text string
+	Data string
+}
+
+type Messenger interface {
+	Send(to ChatRef, text string) error
+	// Reply answers the message, quoting it where the platform allows.
+	Reply(to Message, text string) error
+	// SendButtons sends the text with rows of inline buttons under it.
+	SendButtons(to ChatRef, text string, buttons [][]Button) error
+	// Edit replaces the text of a message sent earlier and drops its buttons.
+	Edit(to ChatRef, messageID int, text string) error
+	// SendVoice sends Ogg Opus audio as a voice message.
+	SendVoice(to ChatRef, audio []byte) error
+	// SendPhoto sends an image with the text as its caption. A text too long
+	// for a caption follows the image in its own message.
+	SendPhoto(to ChatRef, photo Image, caption string) error
+	// Download saves the attachment to a local file.
+	Download(file Attachment, filename string) error
+	// SetCommands publishes the command menu shown by the client.
+	SetCommands(commands []Command) error
+	// Live replies to the message with a placeholder that is then edited
+	// while the answer is produced. It carries a button to stop the answer.
+	Live(to Message, placeholder string) (LiveMessage, error)
+}
+
+// LiveMessage is a message whose text grows while it is produced.
+type LiveMessage interface {
+	// Context is canceled when the user presses the stop button.
+	Context() context.Context
+	// Update shows the text so far. Edits are throttled, so only some
+	// updates reach the chat.
+	Update(text string)
+	// Finish shows the final text and removes the stop button.
+	Finish(text string) error
+	// Discard deletes the message, for answers sent in another form.
+	Discard() error
+}
+
+// TokenUsage is what a completion cost, as reported by the model API.
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u TokenUsage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Completion is the model answer, either text or a function call. Images
+// the model generated come along with the text.
+type Completion struct {
+	Text         string
+	FunctionCall *FunctionCall
+	Images       []Image
+	// Model is the model that answered, as reported by the API.
+	Model string
+	Usage TokenUsage
+}
+
+type Image struct {
+	Data []byte
+	MIME string
+}
+
+type ChatModel interface {
+	// Complete answers the conversation, the model may call the functions.
+	Complete(messages []ChatMessage, functions ...Function) (Completion, error)
+}
+
+// ChatStreamer is implemented by chat models that can send the answer in
+// parts while it is generated.
+type ChatStreamer interface {
+	// Stream calls onDelta with every new piece of the answer and returns the
+	// whole completion. Canceling ctx stops the generation.
+	Stream(ctx context.Context, messages []ChatMessage, functions []Function, onDelta func(text string)) (Completion, error)
+}
+
+// Embedder is implemented by chat models that can turn texts into vectors
+// for semantic search. Vectors come in the order of the texts.
+type Embedder interface {
+	Embed(texts []string) ([][]float32, TokenUsage, error)
+	// EmbeddingsModel names the model the embedding tokens are spent on.
+	EmbeddingsModel() string
+}
+
+// ImageGenerator is implemented by chat models that can draw pictures.
+type ImageGenerator interface {
+	// Draw makes the model generate an image for the prompt. A completion
+	// without images is a refusal explained in the text.
+	Draw(prompt string) (Completion, error)
+}
+
+// VisionModel is implemented by chat models that can look at images.
+type VisionModel interface {
+	// Upload stores the image with the model API and returns the ID to put
+	// in ChatMessage.Attachments.
+	Upload(image Image) (string, error)
+	// ImageTypes lists the MIME types of the images the model reads.
+	ImageTypes() []string
+}
+
+// ModelCatalog is implemented by chat models that can list the models the
+// API offers and answer with any of them.
+type ModelCatalog interface {
+	// Model is the model answering by default.
+	Model() string
+	Models() ([]string, error)
+	// WithModel returns the chat model answering with the given model.
+	WithModel(model string) ChatModel
+}
+
+// SpeechRecognizer turns an audio file on disk into text.
+type SpeechRecognizer interface {
+	Recognize(filename string) (string, error)
+}
+
+type SynthesisOptions struct {
+	Voice  string
+	Format string
+	// SSML marks the text as SSML markup instead of plain text.
+	SSML bool
+}
+
+// SpeechSynthesizer turns text into audio data.
+type SpeechSynthesizer interface {
+	Synthesize(text string, opts SynthesisOptions) ([]byte, error)
+	Voices() []string
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Check reports a problem with one dependency, nil means healthy.
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs a list of checks for a /healthz or /readyz endpoint.
+type Checker struct {
+	checks []namedCheck
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run returns one line per check and whether all of them passed.
+func (c *Checker) Run() (string, bool) {
+	var b strings.Builder
+	ok := true
+
+	for _, nc := range c.checks {
+		if err := nc.check(); err != nil {
+			ok = false
+			fmt.Fprintf(&b, "%s: %v\n", nc.name, err)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s: ok\n", nc.name)
+	}
+
+	return b.String(), ok
+}
+
+// ServeHTTP answers 200 when every check passes and 503 otherwise, with the
+// check results as plain text.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, ok := c.Run()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	fmt.Fprint(w, report)
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	Redacted = "[REDACTED]"
+
+	minSecretLength = 8
+)
+
+// sensitiveKeys are attribute keys, alone or as a suffix like "bot_token",
+// whose values are never logged.
+var sensitiveKeys = []string{"token", "secret", "password", "authorization", "auth_key", "api_key"}
+
+var patterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Telegram file URLs embed the bot token in the path.
+	{regexp.MustCompile(`api\.telegram\.org/file/bot[^\s"']*`), "api.telegram.org/file/" + Redacted},
+	// Telegram bot tokens: "<bot id>:<secret>".
+	{regexp.MustCompile(`\b\d{6,}:[A-Za-z0-9_-]{30,}`), Redacted},
+	{regexp.MustCompile(`\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + Redacted},
+}
+
+// Redactor masks tokens, auth keys and file URLs in log output.
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a redactor that also masks the given secret values
+// wherever they appear. Values shorter than minSecretLength are ignored, they
+// would mask random bits of unrelated text.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+
+	for _, s := range secrets {
+		if len(s) >= minSecretLength {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+
+	return r
+}
+
+func (r *Redactor) Redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+
+	return s
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr hook hiding the values of
+// sensitive keys and redacting strings and errors. Other values are left to
+// the handler, so structs and LogValuers keep their structure.
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.SourceKey) {
+		return a
+	}
+
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	var s string
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		s = a.Value.String()
+	case slog.KindAny:
+		err, ok := a.Value.Any().(error)
+
+		if !ok {
+			return a
+		}
+
+		s = err.Error()
+	default:
+		return a
+	}
+
+	if redacted := r.Redact(s); redacted != s {
+		return slog.String(a.Key, redacted)
+	}
+
+	return a
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, k := range sensitiveKeys {
+		if key == k || strings.HasSuffix(key, "_"+k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New creates a logger writing JSON or text records of the given level and
+// above, with secrets redacted.
+func New(w io.Writer, level slog.Level, format string, secrets ...string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: NewRedactor(secrets...).ReplaceAttr,
+	}
+
+	if format == FormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// ParseLevel understands debug, info, warn and error, defaulting to info.
+func ParseLevel(s string) slog.Level {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
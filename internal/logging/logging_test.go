@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const (
+	authKey = "Zm9vYmFyOmJhei1zZWNyZXQta2V5"
+	bearer  = "eyJhbGciOiJIUzI1NiJ9.payload.signature"
+)
+
+type chat struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// user logs as a group of its ID alone.
+type user struct {
+	ID   int64
+	Name string
+}
+
+func (u user) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int64("id", u.ID))
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		attrs []any
+	}{
+		{name: "sensitive key", msg: "oauth", attrs: []any{"auth_key", authKey}},
+		{name: "sensitive key in a group", msg: "oauth", attrs: []any{slog.Group("gigachat", "auth_key", authKey)}},
+		{name: "known secret", msg: "calling with " + authKey},
+		{name: "bearer token", msg: "request", attrs: []any{"header", "Authorization: Bearer " + bearer}},
+		{name: "bearer token in an error", msg: "request", attrs: []any{"error", errors.New("rejected Bearer " + bearer)}},
+		{name: "bot token", msg: "telegram", attrs: []any{"url", "https://api.telegram.org/file/bot123456:" + strings.Repeat("x", 35) + "/voice.ogg"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			New(&out, slog.LevelInfo, FormatJSON, authKey).Info(test.msg, test.attrs...)
+
+			for _, secret := range []string{authKey, bearer, strings.Repeat("x", 35)} {
+				if strings.Contains(out.String(), secret) {
+					t.Fatalf("output has %q: %s", secret, out.String())
+				}
+			}
+
+			if !strings.Contains(out.String(), Redacted) {
+				t.Fatalf("output = %s, want %s in it", out.String(), Redacted)
+			}
+		})
+	}
+}
+
+func TestStructuredValues(t *testing.T) {
+	var out bytes.Buffer
+
+	New(&out, slog.LevelInfo, FormatJSON).Info("message",
+		"chat", chat{ID: 1, Title: "Team"},
+		"user", user{ID: 2, Name: "Secret name"},
+		"ids", []int{1, 2},
+	)
+
+	var record struct {
+		Chat chat           `json:"chat"`
+		User map[string]any `json:"user"`
+		IDs  []int          `json:"ids"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("output %s: %v", out.String(), err)
+	}
+
+	if record.Chat != (chat{ID: 1, Title: "Team"}) {
+		t.Fatalf("chat = %+v, want the struct as JSON", record.Chat)
+	}
+
+	if len(record.User) != 1 || record.User["id"] != float64(2) {
+		t.Fatalf("user = %v, want the LogValue group", record.User)
+	}
+
+	if len(record.IDs) != 2 {
+		t.Fatalf("ids = %v, want the slice as JSON", record.IDs)
+	}
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gosberbot"
+
+// Registry holds the bot metrics together with the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	MessageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "message_duration_seconds",
+		Help:      "Time spent processing a queued message, by message kind and result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"kind", "result"})
+
+	ProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Requests sent to external APIs.",
+	}, []string{"provider", "endpoint"})
+
+	ProviderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "Requests to external APIs that failed or got a non-200 answer.",
+	}, []string{"provider", "endpoint"})
+
+	ProviderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of requests to external APIs.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "endpoint"})
+
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_token_refreshes_total",
+		Help:      "OAuth access token refreshes, by scope and result.",
+	}, []string{"scope", "result"})
+
+	TelegramSendFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_send_failures_total",
+		Help:      "Messages the bot failed to deliver to Telegram.",
+	}, []string{"method"})
+
+	Throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_messages_total",
+		Help:      "Messages rejected by rate limits, by class and the limit hit.",
+	}, []string{"class", "scope"})
+
+	GigaChatTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gigachat_tokens_total",
+		Help:      "GigaChat tokens reported in completion usage, by model and type.",
+	}, []string{"model", "type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		MessageDuration,
+		ProviderRequests,
+		ProviderErrors,
+		ProviderDuration,
+		TokenRefreshes,
+		TelegramSendFailures,
+		Throttled,
+		GigaChatTokens,
+	)
+}
+
+// ObserveRequest records one external API call that started at start.
+func ObserveRequest(provider, endpoint string, start time.Time, ok bool) {
+	ProviderRequests.WithLabelValues(provider, endpoint).Inc()
+	ProviderDuration.WithLabelValues(provider, endpoint).Observe(time.Since(start).Seconds())
+
+	if !ok {
+		ProviderErrors.WithLabelValues(provider, endpoint).Inc()
+	}
+}
+
+// Result is the "result" label value for an error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
+
+// RegisterQueueDepth exports the current queue length read by depth.
+func RegisterQueueDepth(depth func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Jobs waiting in the queue or being processed.",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
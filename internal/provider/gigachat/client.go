@@ -3,155 +3,434 @@ package gigachat
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/metrics"
+	"gosberbot/internal/provider/oauth"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 )
 
 const (
-	OAuthUrl           = "https://ngw.devices.sberbank.ru:9443/api/v2/oauth"
-	ModelsUrl          = "https://gigachat.devices.sberbank.ru/api/v1/models"
-	GetCompletionstUrl = "https://gigachat.devices.sberbank.ru/api/v1/chat/completions"
+	DefaultBaseUrl = "https://gigachat.devices.sberbank.ru/api/v1"
+
+	ModelsPath      = "/models"
+	CompletionsPath = "/chat/completions"
+	EmbeddingsPath  = "/embeddings"
+	FilesPath       = "/files"
+
+	DefaultModel           = "GigaChat"
+	DefaultVisionModel     = "GigaChat-Max"
+	DefaultEmbeddingsModel = "Embeddings"
 )
 
-type Token struct {
-	AccessToken string `json:"access_token"`
-	ExpiresAt   int64  `json:"expires_at"`
+var (
+	_ domain.ChatModel      = (*Client)(nil)
+	_ domain.ModelCatalog   = (*Client)(nil)
+	_ domain.ChatStreamer   = (*Client)(nil)
+	_ domain.Embedder       = (*Client)(nil)
+	_ domain.ImageGenerator = (*Client)(nil)
+	_ domain.VisionModel    = (*Client)(nil)
+)
+
+type Config struct {
+	AuthKey           string        `yaml:"auth_key" env:"GIGACHAT_AUTH_KEY" secret:"true"`
+	Scope             string        `yaml:"scope"`
+	BaseUrl           string        `yaml:"base_url"`
+	Model             string        `yaml:"model"`
+	Temperature       float64       `yaml:"temperature"`
+	TopP              float64       `yaml:"top_p"`
+	MaxTokens         int           `yaml:"max_tokens"`
+	RepetitionPenalty float64       `yaml:"repetition_penalty"`
+	Timeout           time.Duration `yaml:"timeout"`
+	// StreamTimeout limits a whole streamed answer, not just its start.
+	StreamTimeout   time.Duration `yaml:"stream_timeout"`
+	EmbeddingsModel string        `yaml:"embeddings_model"`
+	// VisionModel answers the requests with images attached.
+	VisionModel string `yaml:"vision_model"`
+	// ModelsTTL is how long the model list is cached.
+	ModelsTTL time.Duration `yaml:"models_ttl"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Scope:             oauth.ScopeGigaChat,
+		BaseUrl:           DefaultBaseUrl,
+		Model:             DefaultModel,
+		Temperature:       1,
+		TopP:              0.1,
+		MaxTokens:         512,
+		RepetitionPenalty: 1,
+		Timeout:           10 * time.Second,
+		StreamTimeout:     5 * time.Minute,
+		EmbeddingsModel:   DefaultEmbeddingsModel,
+		VisionModel:       DefaultVisionModel,
+		ModelsTTL:         time.Hour,
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.AuthKey == "" {
+		errs = append(errs, errors.New("auth_key is required"))
+	}
+
+	if c.BaseUrl == "" {
+		errs = append(errs, errors.New("base_url is required"))
+	}
+
+	if c.Model == "" || c.EmbeddingsModel == "" || c.VisionModel == "" {
+		errs = append(errs, errors.New("model, embeddings_model and vision_model are required"))
+	}
+
+	if c.Temperature < 0 || c.Temperature > 2 {
+		errs = append(errs, fmt.Errorf("temperature must be between 0 and 2, got %v", c.Temperature))
+	}
+
+	if c.TopP < 0 || c.TopP > 1 {
+		errs = append(errs, fmt.Errorf("top_p must be between 0 and 1, got %v", c.TopP))
+	}
+
+	if c.MaxTokens < 1 {
+		errs = append(errs, fmt.Errorf("max_tokens must be positive, got %d", c.MaxTokens))
+	}
+
+	if c.RepetitionPenalty <= 0 {
+		errs = append(errs, fmt.Errorf("repetition_penalty must be positive, got %v", c.RepetitionPenalty))
+	}
+
+	if c.Timeout <= 0 || c.StreamTimeout <= 0 {
+		errs = append(errs, errors.New("timeout and stream_timeout must be positive"))
+	}
+
+	if c.ModelsTTL < 0 {
+		errs = append(errs, fmt.Errorf("models_ttl must not be negative, got %v", c.ModelsTTL))
+	}
+
+	return errors.Join(errs...)
 }
 
 type Client struct {
-	cli     *fasthttp.Client
-	authKey string
-	token   string
-	expire  time.Time
+	cli    *fasthttp.Client
+	conns  *connSet
+	tokens *oauth.TokenSource
+	cfg    Config
+	models *modelCache
+	log    *slog.Logger
+}
+
+type Message struct {
+	Role         string        `json:"role"`
+	Content      string        `json:"content"`
+	Name         string        `json:"name,omitempty"`
+	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+	// FunctionsStateID comes with a function call and goes back with it.
+	FunctionsStateID string `json:"functions_state_id,omitempty"`
+	// Attachments are IDs of uploaded files the message shows the model.
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+type FunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type Function struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// FinishFunctionCall is the finish reason of an answer that is a function call.
+const FinishFunctionCall = "function_call"
+
+// ModelTypeEmbedder is the type of the models that make embeddings, the
+// others are chat models.
+const ModelTypeEmbedder = "embedder"
+
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+	Type    string `json:"type"`
+}
+
+type ModelsResponse struct {
+	Data []Model `json:"data"`
+}
+
+// modelCache keeps the model list, it rarely changes.
+type modelCache struct {
+	mu      sync.Mutex
+	list    []Model
+	expires time.Time
 }
 
 type CompletionResponse struct {
 	Choices []struct {
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		Index        int    `json:"index"`
-		FinishReason string `json:"finish_reason"`
+		Message      Message `json:"message"`
+		Index        int     `json:"index"`
+		FinishReason string  `json:"finish_reason"`
 	} `json:"choices"`
 	Created int    `json:"created"`
 	Model   string `json:"model"`
-	Usage   struct {
-		PromtTokens      int `json:"promt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	}
-	Object string `json:"object"`
+	Usage   Usage  `json:"usage"`
+	Object  string `json:"object"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
-func NewClient(authKey string) *Client {
+func NewClient(cfg Config, tokens *oauth.TokenSource, log *slog.Logger) *Client {
+	conns := &connSet{}
+
 	cli := &fasthttp.Client{
-		Dial: func(addr string) (net.Conn, error) {
-			return fasthttp.DialTimeout(addr, time.Duration(30)*time.Second)
-		},
+		Dial:      conns.dial,
 		TLSConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
-	return &Client{cli: cli, authKey: authKey}
+	return &Client{cli: cli, conns: conns, tokens: tokens, cfg: cfg, models: &modelCache{}, log: log}
 }
 
-func (c *Client) GetToken() error {
-	if !c.expire.IsZero() && c.expire.After(time.Now()) {
-		return nil
+// GetModels returns the models the API offers. The list is cached for
+// models_ttl.
+func (c *Client) GetModels() ([]Model, error) {
+	c.models.mu.Lock()
+	defer c.models.mu.Unlock()
+
+	if c.models.list != nil && time.Now().Before(c.models.expires) {
+		return slices.Clone(c.models.list), nil
 	}
 
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(OAuthUrl)
-	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI(c.cfg.BaseUrl + ModelsPath)
+	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.Add("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Basic "+c.authKey)
-	req.Header.Set("RqUID", uuid.New().String())
-	req.SetBodyString("scope=GIGACHAT_API_PERS")
 
 	defer fasthttp.ReleaseRequest(req)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return fmt.Errorf("timeout: %w", err)
+	if err := c.do("models", req, resp, c.cfg.Timeout); err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
-		return fmt.Errorf("status code: %v %v", resp.StatusCode(), resp.Body())
+		return nil, fmt.Errorf("status code: %v", resp.StatusCode())
 	}
 
-	var token Token
-	if err := json.Unmarshal(resp.Body(), &token); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w %v", err, resp.Body())
+	var res ModelsResponse
+
+	if err := json.Unmarshal(resp.Body(), &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	c.token = token.AccessToken
-	c.expire = time.Unix(token.ExpiresAt, 0)
+	c.models.list = res.Data
+	c.models.expires = time.Now().Add(c.cfg.ModelsTTL)
 
-	return nil
+	return slices.Clone(res.Data), nil
 }
 
-func (c *Client) GetModels() string {
-	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(ModelsUrl)
-	req.Header.SetMethod(fasthttp.MethodGet)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
+func (c *Client) Model() string {
+	return c.cfg.Model
+}
 
-	defer fasthttp.ReleaseRequest(req)
+// Models implements domain.ModelCatalog, it lists the chat models only.
+func (c *Client) Models() ([]string, error) {
+	list, err := c.GetModels()
 
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list))
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		fmt.Printf("Timeout, error: %v\n", err)
-		return ""
+	for _, m := range list {
+		if m.Type != ModelTypeEmbedder && m.ID != c.cfg.EmbeddingsModel {
+			models = append(models, m.ID)
+		}
 	}
 
-	if resp.StatusCode() != fasthttp.StatusOK {
-		fmt.Printf("Status code: %v\n", resp.StatusCode())
-		return ""
+	return models, nil
+}
+
+// modelName drops the version the API adds to the model in answers, as in
+// GigaChat-Pro:1.0.26.20.
+func modelName(reported string) string {
+	name, _, _ := strings.Cut(reported, ":")
+	return name
+}
+
+// WithModel implements domain.ModelCatalog. The copy shares the connection,
+// the token and the model list with c.
+func (c *Client) WithModel(model string) domain.ChatModel {
+	cp := *c
+	cp.cfg.Model = model
+
+	return &cp
+}
+
+func (c *Client) Complete(messages []domain.ChatMessage, functions ...domain.Function) (domain.Completion, error) {
+	res, err := c.GetCompletions(toMessages(messages), toFunctions(functions)...)
+
+	if err != nil {
+		return domain.Completion{}, err
 	}
 
-	return string(resp.Body())
+	choice := res.Choices[0]
+
+	completion := domain.Completion{
+		Text:  choice.Message.Content,
+		Model: modelName(res.Model),
+		Usage: domain.TokenUsage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+		},
+	}
+
+	if choice.FinishReason == FinishFunctionCall {
+		if completion.FunctionCall = fromFunctionCall(choice.Message); completion.FunctionCall == nil {
+			return domain.Completion{}, errors.New("function_call finish without a function call")
+		}
+	}
+
+	// The tokens are spent even if the picture can't be fetched.
+	if err := c.attachImages(&completion); err != nil {
+		return completion, err
+	}
+
+	return completion, nil
 }
 
-func (c *Client) GetCompletions(text string) (string, error) {
+// payload builds a completions request. A question with images goes to the
+// vision model, the questions after it to the chosen model again. That model
+// gets the earlier answers about the images but not the images themselves.
+func (c *Client) payload(messages []Message, functions []Function, stream bool) map[string]any {
+	model := c.cfg.Model
+
+	if hasImages(messages) {
+		model = c.cfg.VisionModel
+	}
+
+	if model != c.cfg.VisionModel {
+		messages = withoutImages(messages)
+	}
+
 	payload := map[string]any{
-		"model": "GigaChat",
-		"messages": []map[string]string{
-			{
-				"role":    "user",
-				"content": text,
-			},
-		},
-		"temperature":        1,
-		"top_p":              0.1,
+		"model":              model,
+		"messages":           messages,
+		"temperature":        c.cfg.Temperature,
+		"top_p":              c.cfg.TopP,
 		"n":                  1,
-		"stream":             false,
-		"max_tokens":         512,
-		"repetition_penalty": 1,
+		"stream":             stream,
+		"max_tokens":         c.cfg.MaxTokens,
+		"repetition_penalty": c.cfg.RepetitionPenalty,
 		"update_interval":    0,
 	}
 
+	if len(functions) > 0 {
+		payload["functions"] = functions
+		payload["function_call"] = "auto"
+	}
+
+	return payload
+}
+
+// hasImages reports whether the last user message has attachments.
+func hasImages(messages []Message) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == domain.RoleUser {
+			return len(messages[i].Attachments) > 0
+		}
+	}
+
+	return false
+}
+
+// withoutImages returns the messages without their attachments.
+func withoutImages(messages []Message) []Message {
+	if !slices.ContainsFunc(messages, func(m Message) bool { return len(m.Attachments) > 0 }) {
+		return messages
+	}
+
+	res := slices.Clone(messages)
+
+	for i := range res {
+		res[i].Attachments = nil
+	}
+
+	return res
+}
+
+func toMessages(messages []domain.ChatMessage) []Message {
+	res := make([]Message, 0, len(messages))
+
+	for _, m := range messages {
+		msg := Message{Role: m.Role, Content: m.Content, Name: m.Name, Attachments: m.Attachments}
+
+		if m.FunctionCall != nil {
+			msg.FunctionCall = &FunctionCall{Name: m.FunctionCall.Name, Arguments: m.FunctionCall.Arguments}
+			msg.FunctionsStateID = m.FunctionCall.StateID
+		}
+
+		res = append(res, msg)
+	}
+
+	return res
+}
+
+func toFunctions(functions []domain.Function) []Function {
+	res := make([]Function, 0, len(functions))
+
+	for _, f := range functions {
+		res = append(res, Function{Name: f.Name, Description: f.Description, Parameters: f.Parameters})
+	}
+
+	return res
+}
+
+// fromFunctionCall returns the function call of the message, if it has one.
+func fromFunctionCall(msg Message) *domain.FunctionCall {
+	if msg.FunctionCall == nil {
+		return nil
+	}
+
+	return &domain.FunctionCall{
+		Name:      msg.FunctionCall.Name,
+		Arguments: msg.FunctionCall.Arguments,
+		StateID:   msg.FunctionsStateID,
+	}
+}
+
+// GetCompletions returns the response with at least one choice. The model
+// may answer with a call of one of the functions.
+func (c *Client) GetCompletions(messages []Message, functions ...Function) (*CompletionResponse, error) {
+	return c.completions(c.payload(messages, functions, false))
+}
+
+func (c *Client) completions(payload map[string]any) (*CompletionResponse, error) {
 	body, err := json.Marshal(payload)
 
 	if err != nil {
-		return "", fmt.Errorf("marshal error: %v", err)
+		return nil, fmt.Errorf("marshal error: %v", err)
 	}
 
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(GetCompletionstUrl)
+	req.SetRequestURI(c.cfg.BaseUrl + CompletionsPath)
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.SetBody(body)
 
 	defer fasthttp.ReleaseRequest(req)
@@ -159,23 +438,47 @@ func (c *Client) GetCompletions(text string) (string, error) {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return "", fmt.Errorf("timeout, error: %v", err)
+	if err := c.do("completions", req, resp, c.cfg.Timeout); err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
-		return "", fmt.Errorf("status code: %v", resp.StatusCode())
+		return nil, fmt.Errorf("status code: %v", resp.StatusCode())
 	}
 
 	var res CompletionResponse
 
 	if err := json.Unmarshal(resp.Body(), &res); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if len(res.Choices) == 0 {
-		return "", fmt.Errorf("empty choices")
+		return nil, fmt.Errorf("empty choices")
 	}
 
-	return res.Choices[0].Message.Content, nil
+	observeUsage(res.Model, res.Usage)
+
+	c.log.Debug("completion done", "model", res.Model, "finish_reason", res.Choices[0].FinishReason, "total_tokens", res.Usage.TotalTokens)
+
+	return &res, nil
+}
+
+// observeUsage counts the tokens under the model name without the version,
+// which would start new series with every model update.
+func observeUsage(model string, usage Usage) {
+	model = modelName(model)
+
+	metrics.GigaChatTokens.WithLabelValues(model, "prompt").Add(float64(usage.PromptTokens))
+	metrics.GigaChatTokens.WithLabelValues(model, "completion").Add(float64(usage.CompletionTokens))
+	metrics.GigaChatTokens.WithLabelValues(model, "total").Add(float64(usage.TotalTokens))
+}
+
+// do sends the request and records it in the gigachat metrics under endpoint.
+func (c *Client) do(endpoint string, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	start := time.Now()
+	err := c.tokens.Do(c.cli, req, resp, timeout)
+
+	metrics.ObserveRequest("gigachat", endpoint, start, err == nil && resp.StatusCode() == fasthttp.StatusOK)
+
+	return err
 }
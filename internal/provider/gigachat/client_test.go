@@ -0,0 +1,56 @@
+package gigachat
+
+import (
+	"gosberbot/internal/metrics"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestObserveUsage(t *testing.T) {
+	observeUsage("GigaChat-Pro:1.0.26.20", Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7})
+	observeUsage("GigaChat-Pro:1.0.26.21", Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.GigaChatTokens)
+
+	families, err := reg.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			var model, kind string
+
+			for _, label := range m.GetLabel() {
+				switch label.GetName() {
+				case "model":
+					model = label.GetValue()
+				case "type":
+					kind = label.GetValue()
+				}
+			}
+
+			if strings.HasPrefix(model, "GigaChat-Pro") {
+				got[model+" "+kind] = m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	want := map[string]float64{"GigaChat-Pro prompt": 6, "GigaChat-Pro completion": 3, "GigaChat-Pro total": 9}
+
+	if len(got) != len(want) {
+		t.Fatalf("series = %v, want %v", got, want)
+	}
+
+	for series, value := range want {
+		if got[series] != value {
+			t.Fatalf("series = %v, want %v", got, want)
+		}
+	}
+}
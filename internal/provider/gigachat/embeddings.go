@@ -0,0 +1,95 @@
+package gigachat
+
+import (
+	"encoding/json"
+	"fmt"
+	"gosberbot/internal/domain"
+
+	"github.com/valyala/fasthttp"
+)
+
+type EmbeddingsResponse struct {
+	Object string `json:"object"`
+	Data   []struct {
+		Object    string    `json:"object"`
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+		Usage     struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	} `json:"data"`
+	Model string `json:"model"`
+}
+
+// GetEmbeddings returns one embedding for each of the texts.
+func (c *Client) GetEmbeddings(texts []string) (*EmbeddingsResponse, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": c.cfg.EmbeddingsModel,
+		"input": texts,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(c.cfg.BaseUrl + EmbeddingsPath)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBody(body)
+
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := c.do("embeddings", req, resp, c.cfg.Timeout); err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("status code: %v", resp.StatusCode())
+	}
+
+	var res EmbeddingsResponse
+
+	if err := json.Unmarshal(resp.Body(), &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(res.Data), len(texts))
+	}
+
+	return &res, nil
+}
+
+func (c *Client) EmbeddingsModel() string {
+	return c.cfg.EmbeddingsModel
+}
+
+// Embed implements domain.Embedder.
+func (c *Client) Embed(texts []string) ([][]float32, domain.TokenUsage, error) {
+	res, err := c.GetEmbeddings(texts)
+
+	if err != nil {
+		return nil, domain.TokenUsage{}, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	var usage domain.TokenUsage
+
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, domain.TokenUsage{}, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+
+		vectors[d.Index] = d.Embedding
+		usage.PromptTokens += d.Usage.PromptTokens
+	}
+
+	observeUsage(res.Model, Usage{PromptTokens: usage.PromptTokens, TotalTokens: usage.PromptTokens})
+
+	return vectors, usage, nil
+}
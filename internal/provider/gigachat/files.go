@@ -0,0 +1,213 @@
+package gigachat
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gosberbot/internal/domain"
+	"maps"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// FunctionText2Image is the built-in function GigaChat calls to draw. Its
+// answer refers to the picture with an <img> tag holding a file ID.
+const FunctionText2Image = "text2image"
+
+var imageTag = regexp.MustCompile(`<img\s[^>]*?src="([^"]+)"[^>]*>`)
+
+// imageTypes are the image formats the vision models read, with the file
+// extension to upload them with.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/tiff": ".tiff",
+	"image/bmp":  ".bmp",
+}
+
+// GetFile downloads the content of a file GigaChat generated and returns it
+// with its content type.
+func (c *Client) GetFile(id string) ([]byte, string, error) {
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(c.cfg.BaseUrl + FilesPath + "/" + url.PathEscape(id) + "/content")
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.Add("Accept", "application/jpg")
+
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := c.do("files", req, resp, c.cfg.Timeout); err != nil {
+		return nil, "", fmt.Errorf("request error: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, "", fmt.Errorf("status code: %v", resp.StatusCode())
+	}
+
+	return append([]byte(nil), resp.Body()...), string(resp.Header.ContentType()), nil
+}
+
+// File is an uploaded file as the files API describes it.
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// UploadFile stores the file for use in the messages of later requests.
+func (c *Client) UploadFile(name, mimeType string, data []byte) (*File, error) {
+	var body bytes.Buffer
+
+	w := multipart.NewWriter(&body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, name))
+	header.Set("Content-Type", mimeType)
+
+	part, err := w.CreatePart(header)
+
+	if err == nil {
+		_, err = part.Write(data)
+	}
+
+	if err == nil {
+		err = w.WriteField("purpose", "general")
+	}
+
+	if err == nil {
+		err = w.Close()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("multipart error: %w", err)
+	}
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(c.cfg.BaseUrl + FilesPath)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.Add("Accept", "application/json")
+	req.Header.SetContentType(w.FormDataContentType())
+	req.SetBody(body.Bytes())
+
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := c.do("files_upload", req, resp, c.cfg.Timeout); err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("status code: %v", resp.StatusCode())
+	}
+
+	var file File
+
+	if err := json.Unmarshal(resp.Body(), &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if file.ID == "" {
+		return nil, errors.New("no file ID in the response")
+	}
+
+	return &file, nil
+}
+
+// Upload implements domain.VisionModel.
+func (c *Client) Upload(image domain.Image) (string, error) {
+	mimeType := cmp.Or(image.MIME, "image/jpeg")
+	ext, ok := imageTypes[mimeType]
+
+	if !ok {
+		return "", fmt.Errorf("unsupported image type %s", mimeType)
+	}
+
+	file, err := c.UploadFile("image"+ext, mimeType, image.Data)
+
+	if err != nil {
+		return "", err
+	}
+
+	return file.ID, nil
+}
+
+func (c *Client) ImageTypes() []string {
+	return slices.Sorted(maps.Keys(imageTypes))
+}
+
+// Draw implements domain.ImageGenerator by making the model call its
+// text2image function. The model may still refuse and answer with text.
+func (c *Client) Draw(prompt string) (domain.Completion, error) {
+	payload := c.payload([]Message{{Role: domain.RoleUser, Content: prompt}}, nil, false)
+	payload["function_call"] = map[string]string{"name": FunctionText2Image}
+
+	res, err := c.completions(payload)
+
+	if err != nil {
+		return domain.Completion{}, err
+	}
+
+	completion := domain.Completion{
+		Text:  res.Choices[0].Message.Content,
+		Model: modelName(res.Model),
+		Usage: domain.TokenUsage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+		},
+	}
+
+	if err := c.attachImages(&completion); err != nil {
+		return completion, err
+	}
+
+	return completion, nil
+}
+
+// attachImages downloads the images the answer refers to and cuts their
+// tags out of the text.
+func (c *Client) attachImages(res *domain.Completion) error {
+	for _, m := range imageTag.FindAllStringSubmatch(res.Text, -1) {
+		data, mime, err := c.GetFile(m[1])
+
+		if err != nil {
+			return fmt.Errorf("failed to get file %s: %w", m[1], err)
+		}
+
+		res.Images = append(res.Images, domain.Image{Data: data, MIME: mime})
+	}
+
+	if len(res.Images) > 0 {
+		res.Text = strings.TrimSpace(imageTag.ReplaceAllString(res.Text, ""))
+	}
+
+	return nil
+}
+
+// visibleText is the streamed text to show so far: image tags are cut out
+// and a tag still arriving is held back.
+func visibleText(text string) string {
+	text = imageTag.ReplaceAllString(text, "")
+
+	if i := strings.LastIndex(text, "<"); i >= 0 && !strings.Contains(text[i:], ">") {
+		if tail := text[i:]; strings.HasPrefix(tail, "<img") || strings.HasPrefix("<img", tail) {
+			return text[:i]
+		}
+	}
+
+	return text
+}
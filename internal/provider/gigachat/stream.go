@@ -0,0 +1,234 @@
+package gigachat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gosberbot/internal/domain"
+	"io"
+	"iter"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// maxEventSize bounds a single server-sent event line.
+const maxEventSize = 1 << 20
+
+// StreamChunk is one event of a streamed completion. Usage comes with the
+// last chunk only.
+type StreamChunk struct {
+	Choices []struct {
+		Delta        Message `json:"delta"`
+		Index        int     `json:"index"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Created int    `json:"created"`
+	Model   string `json:"model"`
+	Usage   *Usage `json:"usage"`
+}
+
+// StreamCompletions requests a streamed completion and yields the chunks as
+// they arrive. Breaking the loop or canceling ctx closes the connection,
+// which stops the generation. A cancel also ends a wait for the next chunk.
+func (c *Client) StreamCompletions(ctx context.Context, messages []Message, functions ...Function) iter.Seq2[*StreamChunk, error] {
+	return func(yield func(*StreamChunk, error) bool) {
+		body, err := json.Marshal(c.payload(messages, functions, true))
+
+		if err != nil {
+			yield(nil, fmt.Errorf("marshal error: %w", err))
+			return
+		}
+
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(c.cfg.BaseUrl + CompletionsPath)
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.Add("Accept", "text/event-stream")
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBody(body)
+
+		// The connection is closed after the stream instead of going back to
+		// the pool, where the rest of an abandoned stream would still wait.
+		req.SetConnectionClose()
+
+		defer fasthttp.ReleaseRequest(req)
+
+		resp := fasthttp.AcquireResponse()
+		resp.StreamBody = true
+		defer fasthttp.ReleaseResponse(resp)
+
+		if err := c.do("completions_stream", req, resp, c.cfg.StreamTimeout); err != nil {
+			yield(nil, fmt.Errorf("request error: %w", err))
+			return
+		}
+
+		if resp.StatusCode() != fasthttp.StatusOK {
+			yield(nil, fmt.Errorf("status code: %v", resp.StatusCode()))
+			return
+		}
+
+		addr := resp.LocalAddr()
+		stop := context.AfterFunc(ctx, func() { c.conns.close(addr) })
+		defer stop()
+
+		scanner := bufio.NewScanner(resp.BodyStream())
+		scanner.Buffer(nil, maxEventSize)
+
+		for scanner.Scan() {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+
+			if !ok {
+				continue
+			}
+
+			data = strings.TrimSpace(data)
+
+			if data == "[DONE]" {
+				return
+			}
+
+			var chunk StreamChunk
+
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				yield(nil, fmt.Errorf("failed to unmarshal chunk: %w", err))
+				return
+			}
+
+			if chunk.Usage != nil {
+				observeUsage(chunk.Model, *chunk.Usage)
+				c.log.Debug("stream done", "model", chunk.Model, "total_tokens", chunk.Usage.TotalTokens)
+			}
+
+			if !yield(&chunk, nil) {
+				return
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(nil, fmt.Errorf("read error: %w", err))
+			return
+		}
+
+		yield(nil, fmt.Errorf("stream closed before [DONE]: %w", io.ErrUnexpectedEOF))
+	}
+}
+
+// Stream implements domain.ChatStreamer. On error the completion holds the
+// part of the answer received so far. A function call comes whole in one
+// chunk. Image tags are not passed to onDelta, the images are downloaded
+// at the end.
+func (c *Client) Stream(ctx context.Context, messages []domain.ChatMessage, functions []domain.Function, onDelta func(text string)) (domain.Completion, error) {
+	var res domain.Completion
+	var text strings.Builder
+
+	shown := 0
+
+	for chunk, err := range c.StreamCompletions(ctx, toMessages(messages), toFunctions(functions)...) {
+		if err != nil {
+			res.Text = visibleText(text.String())
+			return res, err
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+
+				if visible := visibleText(text.String()); len(visible) > shown {
+					onDelta(visible[shown:])
+					shown = len(visible)
+				}
+			}
+
+			if call := fromFunctionCall(choice.Delta); call != nil {
+				res.FunctionCall = call
+			}
+		}
+
+		if chunk.Model != "" {
+			res.Model = modelName(chunk.Model)
+		}
+
+		if chunk.Usage != nil {
+			res.Usage = domain.TokenUsage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+			}
+		}
+	}
+
+	res.Text = text.String()
+
+	if err := c.attachImages(&res); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// connSet keeps the open connections of the client by their local address,
+// so a canceled stream can close its connection while a read waits on it.
+type connSet struct {
+	mu    sync.Mutex
+	conns map[string]net.Conn
+}
+
+// dial opens a connection that is tracked until it is closed.
+func (s *connSet) dial(addr string) (net.Conn, error) {
+	conn, err := fasthttp.DialTimeout(addr, time.Duration(30)*time.Second)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		s.conns = make(map[string]net.Conn)
+	}
+
+	s.conns[conn.LocalAddr().String()] = conn
+
+	return &trackedConn{Conn: conn, set: s}, nil
+}
+
+func (s *connSet) close(addr net.Addr) {
+	if addr == nil {
+		return
+	}
+
+	s.mu.Lock()
+	conn, ok := s.conns[addr.String()]
+	s.mu.Unlock()
+
+	if ok {
+		conn.Close()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	set *connSet
+}
+
+func (c *trackedConn) Close() error {
+	c.set.mu.Lock()
+	delete(c.set.conns, c.LocalAddr().String())
+	c.set.mu.Unlock()
+
+	return c.Conn.Close()
+}
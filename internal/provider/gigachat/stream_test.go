@@ -0,0 +1,127 @@
+package gigachat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gosberbot/internal/provider/oauth"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newStreamTest serves a token and a stream that sends the chunks and then
+// stalls until the test ends.
+func newStreamTest(t *testing.T, chunks ...string) *Client {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stall := make(chan struct{})
+
+	server := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/token" {
+			fmt.Fprintf(ctx, `{"access_token":"token","expires_at":%d}`, time.Now().Add(time.Hour).UnixMilli())
+			return
+		}
+
+		ctx.SetContentType("text/event-stream")
+		ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			// Without the blank line after the last event the client waits
+			// in a read.
+			for _, chunk := range chunks {
+				fmt.Fprintf(w, "data: %s\n", chunk)
+				w.Flush()
+			}
+
+			<-stall
+		})
+	}}
+
+	go server.Serve(ln)
+
+	t.Cleanup(func() {
+		close(stall)
+		server.Shutdown()
+	})
+
+	base := "http://" + ln.Addr().String()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cfg := DefaultConfig()
+	cfg.BaseUrl = base
+	cfg.StreamTimeout = time.Minute
+
+	return NewClient(cfg, oauth.NewTokenSource(base+"/token", "key", oauth.ScopeGigaChat, log), log)
+}
+
+func TestStreamCancel(t *testing.T) {
+	c := newStreamTest(t, `{"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		text     string
+		err      error
+		canceled time.Time
+	)
+
+	for chunk, chunkErr := range c.StreamCompletions(ctx, []Message{{Role: "user", Content: "Hi"}}) {
+		if chunkErr != nil {
+			err = chunkErr
+			break
+		}
+
+		text += chunk.Choices[0].Delta.Content
+
+		// The server stalls after the first chunk, as a model may do.
+		canceled = time.Now()
+		cancel()
+	}
+
+	if text != "Hel" {
+		t.Fatalf("text = %q, want the first chunk", text)
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+
+	if wait := time.Since(canceled); wait > time.Second {
+		t.Fatalf("the stream ended %v after the cancel, want at once", wait)
+	}
+
+	if n := c.conns.open(); n != 0 {
+		t.Fatalf("%d connections are open after the stream", n)
+	}
+}
+
+func TestStreamBreak(t *testing.T) {
+	c := newStreamTest(t, `{"choices":[{"delta":{"content":"Hel"}}]}`, `{"choices":[{"delta":{"content":"lo"}}]}`)
+
+	for range c.StreamCompletions(context.Background(), []Message{{Role: "user", Content: "Hi"}}) {
+		break
+	}
+
+	// The abandoned stream is not reused for the next request.
+	if n := c.conns.open(); n != 0 {
+		t.Fatalf("%d connections are open after the stream", n)
+	}
+}
+
+func (s *connSet) open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
@@ -0,0 +1,214 @@
+package oauth
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gosberbot/internal/metrics"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultUrl = "https://ngw.devices.sberbank.ru:9443/api/v2/oauth"
+
+	ScopeGigaChat     = "GIGACHAT_API_PERS"
+	ScopeSaluteSpeech = "SALUTE_SPEECH_PERS"
+
+	// RefreshMargin is how long before expiry a token is considered stale.
+	RefreshMargin = time.Minute
+)
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresAt is a unix timestamp in milliseconds.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// TokenSource hands out Sber API access tokens and refreshes them lazily.
+// Concurrent callers wait for a single refresh instead of starting their own.
+type TokenSource struct {
+	cli     *fasthttp.Client
+	url     string
+	authKey string
+	scope   string
+	log     *slog.Logger
+
+	mu     sync.Mutex
+	token  string
+	expire time.Time
+	// err is the error of the last refresh.
+	err     error
+	refresh *refresh
+}
+
+// refresh is a token request in flight, done is closed when it ends.
+type refresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func NewTokenSource(url, authKey, scope string, log *slog.Logger) *TokenSource {
+	cli := &fasthttp.Client{
+		Dial: func(addr string) (net.Conn, error) {
+			return fasthttp.DialTimeout(addr, time.Duration(30)*time.Second)
+		},
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	return &TokenSource{cli: cli, url: url, authKey: authKey, scope: scope, log: log}
+}
+
+// Token returns the cached token or waits for a refresh. The lock is not held
+// during the request, so Invalidate doesn't wait for a slow token endpoint.
+func (t *TokenSource) Token() (string, error) {
+	t.mu.Lock()
+
+	if t.token != "" && time.Now().Add(RefreshMargin).Before(t.expire) {
+		defer t.mu.Unlock()
+		return t.token, nil
+	}
+
+	r := t.refresh
+
+	if r != nil {
+		t.mu.Unlock()
+		<-r.done
+
+		return r.token, r.err
+	}
+
+	r = &refresh{done: make(chan struct{})}
+	t.refresh = r
+	t.mu.Unlock()
+
+	defer close(r.done)
+
+	token, err := t.fetch()
+
+	metrics.TokenRefreshes.WithLabelValues(t.scope, metrics.Result(err)).Inc()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refresh = nil
+	t.err = err
+
+	if err != nil {
+		r.err = err
+		return "", err
+	}
+
+	t.token = token.AccessToken
+	t.expire = time.UnixMilli(token.ExpiresAt)
+	r.token = t.token
+
+	t.log.Debug("token refreshed", "scope", t.scope, "expires_at", t.expire)
+
+	return t.token, nil
+}
+
+// Valid checks the token without fetching one, for readiness probes. It fails
+// before the first refresh and after a failed one, unless the cached token
+// has not expired yet.
+func (t *TokenSource) Valid() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case t.token != "" && time.Now().Before(t.expire):
+		return nil
+	case t.err != nil:
+		return t.err
+	case t.token == "":
+		return errors.New("no token yet")
+	}
+
+	return nil
+}
+
+// Invalidate drops the token if it is still the cached one, so the next call
+// to Token fetches a new one. Tokens refreshed meanwhile are kept.
+func (t *TokenSource) Invalidate(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token == token {
+		t.token = ""
+		t.expire = time.Time{}
+	}
+}
+
+// Do sends an authorized request and retries it once with a fresh token when
+// the API answers 401. The request body must be replayable.
+func (t *TokenSource) Do(cli *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		token, err := t.Token()
+
+		if err != nil {
+			return fmt.Errorf("token error: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if err := cli.DoTimeout(req, resp, timeout); err != nil {
+			return fmt.Errorf("timeout, error: %w", err)
+		}
+
+		if resp.StatusCode() != fasthttp.StatusUnauthorized || attempt > 0 {
+			return nil
+		}
+
+		// A streamed response holds its connection until the body is closed.
+		if err := resp.CloseBodyStream(); err != nil {
+			t.log.Debug("failed to close rejected response", "scope", t.scope, "err", err)
+		}
+
+		t.log.Warn("token rejected, refreshing", "scope", t.scope)
+		t.Invalidate(token)
+	}
+}
+
+func (t *TokenSource) fetch() (Token, error) {
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(t.url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Basic "+t.authKey)
+	req.Header.Set("RqUID", uuid.New().String())
+	req.SetBodyString("scope=" + t.scope)
+
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	start := time.Now()
+	err := t.cli.DoTimeout(req, resp, time.Duration(10)*time.Second)
+
+	metrics.ObserveRequest("oauth", "token", start, err == nil && resp.StatusCode() == fasthttp.StatusOK)
+
+	if err != nil {
+		return Token{}, fmt.Errorf("timeout: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return Token{}, fmt.Errorf("status code: %v %s", resp.StatusCode(), resp.Body())
+	}
+
+	var token Token
+
+	if err := json.Unmarshal(resp.Body(), &token); err != nil {
+		return Token{}, fmt.Errorf("failed to unmarshal response: %w %s", err, resp.Body())
+	}
+
+	return token, nil
+}
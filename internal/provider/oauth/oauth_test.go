@@ -0,0 +1,279 @@
+package oauth
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// testAPI serves tokens valid for ttl on /token after delay, unless down is
+// set, and rejects the first tokens it hands out on /api.
+type testAPI struct {
+	ttl      time.Duration
+	delay    time.Duration
+	rejected int32
+	down     atomic.Bool
+	tokens   atomic.Int32
+	calls    atomic.Int32
+}
+
+func (a *testAPI) handle(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Path()) {
+	case "/token":
+		time.Sleep(a.delay)
+
+		if a.down.Load() {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+			return
+		}
+
+		n := a.tokens.Add(1)
+		fmt.Fprintf(ctx, `{"access_token":"token-%d","expires_at":%d}`, n, time.Now().Add(cmp.Or(a.ttl, time.Hour)).UnixMilli())
+	case "/api":
+		a.calls.Add(1)
+
+		var n int32
+		fmt.Sscanf(string(ctx.Request.Header.Peek("Authorization")), "Bearer token-%d", &n)
+
+		if n <= a.rejected {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			ctx.SetBodyString(`{"status":401,"message":"Unauthorized"}`)
+			return
+		}
+
+		ctx.SetBodyString("data: ok")
+	}
+}
+
+func newTestAPI(t *testing.T, api *testAPI) (*TokenSource, *fasthttp.Client) {
+	t.Helper()
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: api.handle}
+
+	go server.Serve(ln)
+
+	t.Cleanup(func() { server.Shutdown() })
+
+	dial := func(string) (net.Conn, error) { return ln.Dial() }
+
+	tokens := NewTokenSource("http://oauth/token", "key", ScopeGigaChat, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tokens.cli = &fasthttp.Client{Dial: dial}
+
+	// A single connection fails the retry if the rejected response still
+	// holds it.
+	cli := &fasthttp.Client{Dial: dial, MaxConnsPerHost: 1}
+
+	return tokens, cli
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		rejected int32
+		stream   bool
+		status   int
+		calls    int32
+	}{
+		{name: "accepted", status: fasthttp.StatusOK, calls: 1},
+		{name: "retried", rejected: 1, status: fasthttp.StatusOK, calls: 2},
+		{name: "retried stream", rejected: 1, stream: true, status: fasthttp.StatusOK, calls: 2},
+		{name: "rejected twice", rejected: 2, status: fasthttp.StatusUnauthorized, calls: 2},
+		{name: "rejected twice stream", rejected: 2, stream: true, status: fasthttp.StatusUnauthorized, calls: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &testAPI{rejected: test.rejected}
+			tokens, cli := newTestAPI(t, api)
+
+			req := fasthttp.AcquireRequest()
+			defer fasthttp.ReleaseRequest(req)
+
+			req.SetRequestURI("http://api/api")
+
+			resp := fasthttp.AcquireResponse()
+			resp.StreamBody = test.stream
+			defer fasthttp.ReleaseResponse(resp)
+
+			if err := tokens.Do(cli, req, resp, time.Second); err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+
+			if resp.StatusCode() != test.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode(), test.status)
+			}
+
+			if calls := api.calls.Load(); calls != test.calls {
+				t.Fatalf("API calls = %d, want %d", calls, test.calls)
+			}
+
+			if test.status != fasthttp.StatusOK {
+				return
+			}
+
+			var body []byte
+
+			if test.stream {
+				stream := resp.BodyStream()
+
+				if stream == nil {
+					t.Fatal("BodyStream() = nil, want the streamed answer")
+				}
+
+				var err error
+
+				if body, err = io.ReadAll(stream); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				body = resp.Body()
+			}
+
+			if !strings.HasPrefix(string(body), "data: ok") {
+				t.Fatalf("body = %q, want the answer", body)
+			}
+
+			if token, _ := tokens.Token(); token != fmt.Sprintf("token-%d", test.rejected+1) {
+				t.Fatalf("Token() = %q, want the accepted one", token)
+			}
+		})
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		fetches int32
+	}{
+		{name: "cached", ttl: time.Hour, fetches: 1},
+		{name: "within the refresh margin", ttl: RefreshMargin / 2, fetches: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &testAPI{ttl: test.ttl}
+			tokens, _ := newTestAPI(t, api)
+
+			var last string
+
+			for range 3 {
+				token, err := tokens.Token()
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				last = token
+			}
+
+			if n := api.tokens.Load(); n != test.fetches {
+				t.Fatalf("token requests = %d, want %d", n, test.fetches)
+			}
+
+			if want := fmt.Sprintf("token-%d", test.fetches); last != want {
+				t.Fatalf("Token() = %q, want %q", last, want)
+			}
+
+			// An invalidated token is fetched again, a stale one is kept.
+			tokens.Invalidate("stale")
+
+			if token, _ := tokens.Token(); test.fetches == 1 && token != last {
+				t.Fatalf("Token() after invalidating another token = %q, want %q", token, last)
+			}
+
+			tokens.Invalidate(last)
+
+			if token, _ := tokens.Token(); token == last {
+				t.Fatalf("Token() after Invalidate() = %q, want a new one", token)
+			}
+		})
+	}
+}
+
+func TestTokenConcurrent(t *testing.T) {
+	api := &testAPI{delay: 50 * time.Millisecond}
+	tokens, _ := newTestAPI(t, api)
+
+	const callers = 20
+
+	results := make(chan string, callers)
+
+	for range callers {
+		go func() {
+			token, err := tokens.Token()
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			results <- token
+		}()
+	}
+
+	for range callers {
+		if token := <-results; token != "token-1" {
+			t.Fatalf("Token() = %q, want token-1", token)
+		}
+	}
+
+	if n := api.tokens.Load(); n != 1 {
+		t.Fatalf("token requests = %d, want 1", n)
+	}
+}
+
+func TestTokenValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		valid bool
+	}{
+		{name: "expired", ttl: -time.Minute},
+		{name: "within the refresh margin", ttl: RefreshMargin / 2, valid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &testAPI{ttl: test.ttl}
+			tokens, _ := newTestAPI(t, api)
+
+			if err := tokens.Valid(); err == nil {
+				t.Fatal("Valid() before the first token error = nil")
+			}
+
+			if _, err := tokens.Token(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A refreshed token is valid even when it is about to expire.
+			if err := tokens.Valid(); err != nil {
+				t.Fatalf("Valid() after a refresh error = %v", err)
+			}
+
+			api.down.Store(true)
+
+			if _, err := tokens.Token(); err == nil {
+				t.Fatal("Token() with the endpoint down error = nil")
+			}
+
+			if err := tokens.Valid(); (err == nil) != test.valid {
+				t.Fatalf("Valid() after a failed refresh error = %v, want valid %v", err, test.valid)
+			}
+
+			// Valid never asks for a token.
+			if n := api.tokens.Load(); n != 1 {
+				t.Fatalf("token requests = %d, want 1", n)
+			}
+		})
+	}
+}
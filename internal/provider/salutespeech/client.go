@@ -3,33 +3,117 @@ package salutespeech
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gosberbot/internal/audio"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/metrics"
+	"gosberbot/internal/provider/oauth"
+	"log/slog"
+	"math"
 	"net"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 )
 
 const (
-	OAuthUrl           = "https://ngw.devices.sberbank.ru:9443/api/v2/oauth"
-	UploadUrl          = "https://smartspeech.sber.ru/rest/v1/data:upload"
-	RecognizeUrl       = "https://smartspeech.sber.ru/rest/v1/speech:async_recognize"
-	StatusUrl          = "https://smartspeech.sber.ru/rest/v1/task:get"
-	DownloadUrl        = "https://smartspeech.sber.ru/rest/v1/data:download"
+	DefaultBaseUrl = "https://smartspeech.sber.ru/rest/v1"
+
+	UploadPath     = "/data:upload"
+	RecognizePath  = "/speech:async_recognize"
+	StatusPath     = "/task:get"
+	DownloadPath   = "/data:download"
+	SynthesizePath = "/text:synthesize"
+
+	DefaultVoice = "May_24000"
+
+	FormatOpus = "opus"
+	FormatWav  = "wav16"
+)
+
+var voices = []string{
+	"May_24000", "Nec_24000", "Bys_24000", "Ost_24000", "Pon_24000", "Tur_24000", "Kin_24000",
+}
+
+var (
+	_ domain.SpeechRecognizer  = (*Client)(nil)
+	_ domain.SpeechSynthesizer = (*Client)(nil)
 )
 
-type Token struct {
-	AccessToken string `json:"access_token"`
-	ExpiresAt   int64  `json:"expires_at"`
+type Config struct {
+	AuthKey        string        `yaml:"auth_key" env:"SALUTESPEECH_AUTH_KEY" secret:"true"`
+	Scope          string        `yaml:"scope"`
+	BaseUrl        string        `yaml:"base_url"`
+	Language       string        `yaml:"language"`
+	Voice          string        `yaml:"voice"`
+	StatusAttempts int           `yaml:"status_attempts"`
+	StatusInterval time.Duration `yaml:"status_interval"`
+	// StatusAttemptsPerMinute adds polls for every minute of audio, long
+	// recordings take longer to recognize.
+	StatusAttemptsPerMinute int           `yaml:"status_attempts_per_minute"`
+	Timeout                 time.Duration `yaml:"timeout"`
+	// SynthesisTimeout is longer since synthesis answers with the whole audio.
+	SynthesisTimeout time.Duration `yaml:"synthesis_timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Scope:                   oauth.ScopeSaluteSpeech,
+		BaseUrl:                 DefaultBaseUrl,
+		Language:                "ru-RU",
+		Voice:                   DefaultVoice,
+		StatusAttempts:          10,
+		StatusInterval:          3 * time.Second,
+		StatusAttemptsPerMinute: 10,
+		Timeout:                 10 * time.Second,
+		SynthesisTimeout:        30 * time.Second,
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.AuthKey == "" {
+		errs = append(errs, errors.New("auth_key is required"))
+	}
+
+	if c.BaseUrl == "" {
+		errs = append(errs, errors.New("base_url is required"))
+	}
+
+	if c.Language == "" {
+		errs = append(errs, errors.New("language is required"))
+	}
+
+	if !slices.Contains(voices, c.Voice) {
+		errs = append(errs, fmt.Errorf("voice %q is unknown, use one of %s", c.Voice, strings.Join(voices, ", ")))
+	}
+
+	if c.StatusAttempts < 1 {
+		errs = append(errs, errors.New("status_attempts must be positive"))
+	}
+
+	if c.StatusAttemptsPerMinute < 0 {
+		errs = append(errs, errors.New("status_attempts_per_minute must not be negative"))
+	}
+
+	if c.StatusInterval <= 0 || c.Timeout <= 0 || c.SynthesisTimeout <= 0 {
+		errs = append(errs, errors.New("status_interval, timeout and synthesis_timeout must be positive"))
+	}
+
+	return errors.Join(errs...)
 }
 
 type Client struct {
-	cli     *fasthttp.Client
-	authKey string
-	token   string
-	expire  time.Time
+	cli    *fasthttp.Client
+	tokens *oauth.TokenSource
+	cfg    Config
+	log    *slog.Logger
 }
 
 type UploadResponse struct {
@@ -75,7 +159,7 @@ type DownloadResponse struct {
 	} `json:"speaker_info"`
 }
 
-func NewClient(authKey string) *Client {
+func NewClient(cfg Config, tokens *oauth.TokenSource, log *slog.Logger) *Client {
 	cli := &fasthttp.Client{
 		Dial: func(addr string) (net.Conn, error) {
 			return fasthttp.DialTimeout(addr, time.Duration(30)*time.Second)
@@ -83,63 +167,70 @@ func NewClient(authKey string) *Client {
 		TLSConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
-	return &Client{cli: cli, authKey: authKey}
+	return &Client{cli: cli, tokens: tokens, cfg: cfg, log: log}
 }
 
-func (c *Client) GetToken() error {
-	if !c.expire.IsZero() && c.expire.After(time.Now()) {
-		return nil
+func (c *Client) Recognize(filename string) (string, error) {
+	format, err := audio.DetectFile(filename)
+
+	if err != nil {
+		return "", fmt.Errorf("DetectFile error: %w", err)
 	}
 
-	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(OAuthUrl)
-	req.Header.SetMethod(fasthttp.MethodPost)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Basic "+c.authKey)
-	req.Header.Set("RqUID", uuid.New().String())
-	req.SetBodyString("scope=SALUTE_SPEECH_PERS")
+	attempts := c.cfg.StatusAttempts
 
-	defer fasthttp.ReleaseRequest(req)
+	if length, err := audio.FileDuration(filename); err != nil {
+		c.log.Warn("failed to measure audio length", "err", err)
+	} else {
+		attempts += int(math.Ceil(length.Minutes() * float64(c.cfg.StatusAttemptsPerMinute)))
+	}
 
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
+	reqFileId, err := c.UploadFile(filename)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return fmt.Errorf("timeout: %w", err)
+	if err != nil {
+		return "", fmt.Errorf("UploadFile error: %w", err)
 	}
 
-	if resp.StatusCode() != fasthttp.StatusOK {
-		return fmt.Errorf("wrong status code: %v %v", resp.StatusCode(), resp.Body())
+	taskId, err := c.RecognizeFile(reqFileId, format)
+
+	if err != nil {
+		return "", fmt.Errorf("RecognizeFile error: %w", err)
 	}
 
-	var token Token
+	c.log.Debug("recognition started", "task_id", taskId, "encoding", format.Encoding, "sample_rate", format.SampleRate)
 
-	if err := json.Unmarshal(resp.Body(), &token); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w %v", err, resp.Body())
-	}
+	for i := 0; i < attempts; i++ {
+		respFileId, err := c.GetStatus(taskId)
+
+		if err != nil {
+			return "", fmt.Errorf("GetStatus error: %w", err)
+		}
 
-	c.token = token.AccessToken
-	c.expire = time.Now().Add(time.Duration(token.ExpiresAt-60000) * time.Millisecond)
+		if respFileId != "" {
+			c.log.Debug("recognition done", "task_id", taskId, "polls", i+1)
+			return c.DownloadFile(respFileId)
+		}
 
-	return nil
+		time.Sleep(c.cfg.StatusInterval)
+	}
+
+	return "", fmt.Errorf("recognition timeout for task %s", taskId)
 }
 
 func (c *Client) GetStatus(taskId string) (string, error) {
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(StatusUrl + "?id=" + taskId)
+	req.SetRequestURI(c.cfg.BaseUrl + StatusPath + "?id=" + taskId)
 	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
 
 	defer fasthttp.ReleaseRequest(req)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return "", fmt.Errorf("timeout, error: %v", err)
+	if err := c.do("status", req, resp, c.cfg.Timeout); err != nil {
+		return "", fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
@@ -164,35 +255,27 @@ func (c *Client) GetStatus(taskId string) (string, error) {
 }
 
 func (c *Client) UploadFile(filename string) (string, error) {
-	file, err := os.Open(filename)
-
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
-	}
-
-	defer file.Close()
-
-	fileInfo, err := file.Stat()
+	// The body is kept in memory so the request can be replayed after a 401.
+	data, err := os.ReadFile(filename)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to get file info: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(UploadUrl)
+	req.SetRequestURI(c.cfg.BaseUrl + UploadPath)
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Set("Content-Type", "binary/octet-stream")
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.SetBodyStream(file, int(fileInfo.Size()))
+	req.SetBody(data)
 
 	defer fasthttp.ReleaseRequest(req)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return "", fmt.Errorf("timeout, error: %w", err)
+	if err := c.do("upload", req, resp, c.cfg.Timeout); err != nil {
+		return "", fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
@@ -212,17 +295,17 @@ func (c *Client) UploadFile(filename string) (string, error) {
 	return res.Result.RequestFileId, nil
 }
 
-func (c *Client) RecognizeFile(reqFileId string) (string, error) {
+func (c *Client) RecognizeFile(reqFileId string, format audio.Format) (string, error) {
 	payload := map[string]any{
 		"request_file_id": reqFileId,
 		"options": map[string]any{
-			"language":                "ru-RU",
-			"audio_encoding":          "OPUS",
-			"sample_rate":             48000,
+			"language":                c.cfg.Language,
+			"audio_encoding":          format.Encoding,
+			"sample_rate":             format.SampleRate,
 			"hypotheses_count":        1,
 			"enable_profanity_filter": false,
 			"max_speech_timeout":      "20s",
-			"channels_count":          1,
+			"channels_count":          format.Channels,
 			"no_speech_timeout":       "7s",
 			"speaker_separation_options": map[string]any{
 				"enable":                   false,
@@ -239,11 +322,10 @@ func (c *Client) RecognizeFile(reqFileId string) (string, error) {
 	}
 
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(RecognizeUrl)
+	req.SetRequestURI(c.cfg.BaseUrl + RecognizePath)
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.SetBody(body)
 
 	defer fasthttp.ReleaseRequest(req)
@@ -251,8 +333,8 @@ func (c *Client) RecognizeFile(reqFileId string) (string, error) {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return "", fmt.Errorf("timeout, error: %v", err)
+	if err := c.do("recognize", req, resp, c.cfg.Timeout); err != nil {
+		return "", fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
@@ -274,19 +356,18 @@ func (c *Client) RecognizeFile(reqFileId string) (string, error) {
 
 func (c *Client) DownloadFile(reqFileId string) (string, error) {
 	req := fasthttp.AcquireRequest()
-	req.SetRequestURI(DownloadUrl + "?response_file_id=" + reqFileId)
+	req.SetRequestURI(c.cfg.BaseUrl + DownloadPath + "?response_file_id=" + reqFileId)
 	req.Header.SetMethod(fasthttp.MethodGet)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
 
 	defer fasthttp.ReleaseRequest(req)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	if err := c.cli.DoTimeout(req, resp, time.Duration(10)*time.Second); err != nil {
-		return "", fmt.Errorf("timeout, error: %v", err)
+	if err := c.do("download", req, resp, c.cfg.Timeout); err != nil {
+		return "", fmt.Errorf("request error: %w", err)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
@@ -299,9 +380,70 @@ func (c *Client) DownloadFile(reqFileId string) (string, error) {
 		return "", fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	// Every element is an utterance with its hypotheses, the best first.
+	var texts []string
+
 	for _, r := range res {
-		return r.Results[0].Text, nil
+		if len(r.Results) > 0 && r.Results[0].Text != "" {
+			texts = append(texts, r.Results[0].Text)
+		}
+	}
+
+	return strings.Join(texts, " "), nil
+}
+
+func (c *Client) Voices() []string {
+	return voices
+}
+
+func (c *Client) Synthesize(text string, opts domain.SynthesisOptions) ([]byte, error) {
+	if opts.Voice == "" {
+		opts.Voice = c.cfg.Voice
+	}
+
+	if opts.Format == "" {
+		opts.Format = FormatOpus
+	}
+
+	contentType := "application/text"
+	if opts.SSML {
+		contentType = "application/ssml"
 	}
 
-	return "", nil
+	args := url.Values{}
+	args.Set("format", opts.Format)
+	args.Set("voice", opts.Voice)
+
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI(c.cfg.BaseUrl + SynthesizePath + "?" + args.Encode())
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.Set("Content-Type", contentType)
+	req.SetBodyString(text)
+
+	defer fasthttp.ReleaseRequest(req)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := c.do("synthesize", req, resp, c.cfg.SynthesisTimeout); err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("wrong status code: %v %s", resp.StatusCode(), resp.Body())
+	}
+
+	c.log.Debug("speech synthesized", "voice", opts.Voice, "format", opts.Format, "bytes", len(resp.Body()))
+
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// do sends the request and records it in the salutespeech metrics under endpoint.
+func (c *Client) do(endpoint string, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	start := time.Now()
+	err := c.tokens.Do(c.cli, req, resp, timeout)
+
+	metrics.ObserveRequest("salutespeech", endpoint, start, err == nil && resp.StatusCode() == fasthttp.StatusOK)
+
+	return err
 }
@@ -1,160 +1,453 @@
 package telegram
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"gosberbot/internal/domain"
-	"log"
+	"gosberbot/internal/metrics"
+	"gosberbot/internal/queue"
+	"gosberbot/internal/ratelimit"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	tele "gopkg.in/telebot.v3"
 )
 
-const (
-	FileBaseUrl = "https://api.telegram.org/file/bot"
-)
+var _ domain.Messenger = (*Client)(nil)
+
+type Config struct {
+	Token       string        `yaml:"token" env:"BOT_TOKEN" secret:"true"`
+	PollTimeout time.Duration `yaml:"poll_timeout"`
+	// EditInterval is the least time between edits of a streamed answer.
+	EditInterval time.Duration `yaml:"edit_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{PollTimeout: 10 * time.Second, EditInterval: 1500 * time.Millisecond}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Token == "" {
+		errs = append(errs, errors.New("token is required"))
+	}
+
+	if c.PollTimeout <= 0 {
+		errs = append(errs, errors.New("poll_timeout must be positive"))
+	}
+
+	if c.EditInterval <= 0 {
+		errs = append(errs, errors.New("edit_interval must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Access tells users who may use the bot from everybody else.
+type Access interface {
+	Allowed(chat domain.ChatRef) bool
+}
 
 type Client struct {
-	bot   *tele.Bot
-	token string
-	queue chan domain.Message
+	bot          *tele.Bot
+	queue        queue.Queue
+	limiter      *ratelimit.Limiter
+	access       Access
+	poller       *poller
+	editInterval time.Duration
+	log          *slog.Logger
+
+	liveMu sync.Mutex
+	lives  map[liveKey]*liveMessage
 }
 
-func NewClient(token string, queue chan domain.Message) *Client {
+func NewClient(cfg Config, queue queue.Queue, limiter *ratelimit.Limiter, access Access, log *slog.Logger) *Client {
+	poller := &poller{timeout: cfg.PollTimeout, log: log}
+
 	pref := tele.Settings{
-		Token:  token,
-		Poller: &tele.LongPoller{Timeout: 10 * time.Second},
+		Token:  cfg.Token,
+		Poller: poller,
+		OnError: func(err error, ctx tele.Context) {
+			log.Error("telegram error", "err", err)
+		},
 	}
 
 	bot, err := tele.NewBot(pref)
 	if err != nil {
-		log.Fatal(err)
+		log.Error("failed to create telegram bot", "err", err)
 		return nil
 	}
 
 	return &Client{
-		bot:   bot,
-		token: token,
-		queue: queue,
+		bot:          bot,
+		queue:        queue,
+		limiter:      limiter,
+		access:       access,
+		poller:       poller,
+		editInterval: cfg.EditInterval,
+		log:          log,
+		lives:        make(map[liveKey]*liveMessage),
 	}
 }
 
-func (s *Client) SendMessage(msg domain.Message) {
-	s.queue <- msg
+// Ready fails until long polling gets through to Telegram and whenever it
+// has not for a while.
+func (s *Client) Ready() error {
+	if !s.poller.connected() {
+		return errors.New("telegram long polling is not connected")
+	}
+
+	return nil
 }
 
-func (s *Client) Send(user any, text string) error {
-	if u, ok := user.(*tele.User); ok {
-		_, err := s.bot.Send(u, text)
-		if err != nil {
-			return fmt.Errorf("failed to send message: %w", err)
-		}
+func (s *Client) SendMessage(msg domain.Message) error {
+	if err := s.queue.Push(msg); err != nil {
+		return fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	s.log.Debug("message queued", "message", msg)
 
+	return nil
+}
+
+// enqueue queues the message unless the sender or the chat ran out of their
+// rate limit, in which case the sender is asked to slow down once. Messages
+// of users without access only get the no access reply or a public command,
+// so they are limited like commands and take no provider tokens.
+func (c *Client) enqueue(ctx tele.Context, msg domain.Message) error {
+	class := ratelimit.ClassText
+
+	switch msg.Kind {
+	case domain.KindCommand, domain.KindCallback:
+		class = ratelimit.ClassCommand
+	case domain.KindVoice, domain.KindAudio, domain.KindVideo:
+		class = ratelimit.ClassMedia
+	case domain.KindDocument, domain.KindPhoto:
+		class = ratelimit.ClassFile
+	}
+
+	if !c.access.Allowed(msg.Chat) {
+		class = ratelimit.ClassCommand
+	}
+
+	res := c.limiter.Allow(class, msg.Chat.UserID, msg.Chat.ChatID)
+
+	if res.Allowed {
+		return c.SendMessage(msg)
+	}
+
+	metrics.Throttled.WithLabelValues(string(class), res.Scope).Inc()
+	c.log.Info("message throttled", "message", msg, "scope", res.Scope, "retry_after", res.RetryAfter)
+
+	if !res.Notify {
 		return nil
 	}
 
-	return fmt.Errorf("failed to send message: invalid user type %T", user)
+	var lang string
+	if sender := ctx.Sender(); sender != nil {
+		lang = sender.LanguageCode
+	}
+
+	return ctx.Reply(throttledText(lang, res.RetryAfter))
 }
 
-func (c *Client) Hello(ctx tele.Context) error {
-	return ctx.Send("Hello!")
+func throttledText(lang string, wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+
+	if strings.HasPrefix(lang, "ru") {
+		return fmt.Sprintf("Слишком много сообщений, попробуйте снова через %d сек.", seconds)
+	}
+
+	return fmt.Sprintf("Too many messages, please slow down and try again in %d s.", seconds)
 }
 
-func (c *Client) OnText(ctx tele.Context) error {
-	msg := domain.Message{
-		Type:    "text",
-		Payload: ctx.Text(),
-		User:    ctx.Sender(),
+func (s *Client) Send(to domain.ChatRef, text string) error {
+	if _, err := s.bot.Send(tele.ChatID(to.ChatID), text, sendOptions(to, 0)); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("send").Inc()
+		return fmt.Errorf("failed to send message: %w", err)
 	}
 
-	c.SendMessage(msg)
+	return nil
+}
+
+func (s *Client) Reply(to domain.Message, text string) error {
+	if _, err := s.bot.Send(tele.ChatID(to.Chat.ChatID), text, sendOptions(to.Chat, to.ID)); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("reply").Inc()
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
 
 	return nil
 }
 
-func (c *Client) OnVideo(ctx tele.Context) error {
-	video := ctx.Message().Video
+func (s *Client) SendButtons(to domain.ChatRef, text string, buttons [][]domain.Button) error {
+	opts := sendOptions(to, 0)
+	opts.ReplyMarkup = inlineKeyboard(buttons)
 
-	file, err := c.bot.FileByID(video.FileID)
+	if _, err := s.bot.Send(tele.ChatID(to.ChatID), text, opts); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("buttons").Inc()
+		return fmt.Errorf("failed to send buttons: %w", err)
+	}
 
-	if err != nil {
-		return fmt.Errorf("onVideo error: %w", err)
+	return nil
+}
+
+func (s *Client) Edit(to domain.ChatRef, messageID int, text string) error {
+	msg := tele.StoredMessage{MessageID: strconv.Itoa(messageID), ChatID: to.ChatID}
+
+	if _, err := s.bot.Edit(msg, text); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("edit").Inc()
+		return fmt.Errorf("failed to edit message: %w", err)
 	}
 
-	msg := domain.Message{
-		Type:    "video",
-		Payload: FileBaseUrl + c.token + "/" + file.FilePath,
-		User:    ctx.Sender(),
+	return nil
+}
+
+func inlineKeyboard(buttons [][]domain.Button) *tele.ReplyMarkup {
+	rows := make([][]tele.InlineButton, 0, len(buttons))
+
+	for _, row := range buttons {
+		r := make([]tele.InlineButton, 0, len(row))
+
+		for _, b := range row {
+			r = append(r, tele.InlineButton{Text: b.Text, Data: b.Data})
+		}
+
+		rows = append(rows, r)
 	}
 
-	c.SendMessage(msg)
+	return &tele.ReplyMarkup{InlineKeyboard: rows}
+}
+
+func (s *Client) SendVoice(to domain.ChatRef, audio []byte) error {
+	voice := &tele.Voice{
+		File: tele.FromReader(bytes.NewReader(audio)),
+		MIME: "audio/ogg",
+	}
+
+	if _, err := s.bot.Send(tele.ChatID(to.ChatID), voice, sendOptions(to, 0)); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("voice").Inc()
+		return fmt.Errorf("failed to send voice: %w", err)
+	}
 
 	return nil
 }
 
-func (c *Client) OnAudio(ctx tele.Context) error {
-	audio := ctx.Message().Audio
+// SendPhoto sends the image with the caption, a caption over the Telegram
+// limit is sent as text after the image.
+func (s *Client) SendPhoto(to domain.ChatRef, photo domain.Image, caption string) error {
+	rest := ""
 
-	file, err := c.bot.FileByID(audio.FileID)
+	if utf8.RuneCountInString(caption) > maxCaptionLength {
+		caption, rest = "", caption
+	}
 
-	if err != nil {
-		return fmt.Errorf("onAudio error: %w", err)
+	p := &tele.Photo{File: tele.FromReader(bytes.NewReader(photo.Data)), Caption: caption}
+
+	if _, err := s.bot.Send(tele.ChatID(to.ChatID), p, sendOptions(to, 0)); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("photo").Inc()
+		return fmt.Errorf("failed to send photo: %w", err)
 	}
 
-	msg := domain.Message{
-		Type:    "audio",
-		Payload: FileBaseUrl + c.token + "/" + file.FilePath,
-		User:    ctx.Sender(),
+	for _, part := range split(rest, maxMessageLength) {
+		if part == "" {
+			continue
+		}
+
+		if err := s.Send(to, part); err != nil {
+			return err
+		}
 	}
 
-	c.SendMessage(msg)
+	return nil
+}
+
+func (s *Client) Download(file domain.Attachment, filename string) error {
+	if err := s.bot.Download(&tele.File{FileID: file.FileID}, filename); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
 
 	return nil
 }
 
-func (c *Client) OnVoice(ctx tele.Context) error {
-	voice := ctx.Message().Voice
+func (s *Client) SetCommands(commands []domain.Command) error {
+	list := make([]tele.Command, 0, len(commands))
 
-	file, err := c.bot.FileByID(voice.FileID)
+	for _, c := range commands {
+		list = append(list, tele.Command{Text: c.Name, Description: c.Description})
+	}
 
-	if err != nil {
-		return fmt.Errorf("onVoice error: %w", err)
+	if err := s.bot.SetCommands(list); err != nil {
+		return fmt.Errorf("failed to set commands: %w", err)
 	}
 
+	return nil
+}
+
+func sendOptions(to domain.ChatRef, replyTo int) *tele.SendOptions {
+	opts := &tele.SendOptions{ThreadID: to.ThreadID}
+
+	if replyTo != 0 {
+		opts.ReplyTo = &tele.Message{ID: replyTo}
+	}
+
+	return opts
+}
+
+func (c *Client) message(ctx tele.Context, kind domain.MessageKind, attachments ...domain.Attachment) domain.Message {
+	m := ctx.Message()
+
 	msg := domain.Message{
-		Type:    "voice",
-		Payload: FileBaseUrl + c.token + "/" + file.FilePath,
-		User:    ctx.Sender(),
+		Kind: kind,
+		Chat: domain.ChatRef{
+			Platform: domain.PlatformTelegram,
+			ChatID:   ctx.Chat().ID,
+			ThreadID: m.ThreadID,
+		},
+		ID:            m.ID,
+		Text:          ctx.Text(),
+		Attachments:   attachments,
+		Timestamp:     m.Time(),
+		CorrelationID: uuid.New().String(),
 	}
 
-	c.SendMessage(msg)
+	if sender := ctx.Sender(); sender != nil {
+		msg.Chat.UserID = sender.ID
+		msg.Chat.UserName = sender.Username
+	}
 
-	return nil
+	if m.ReplyTo != nil {
+		msg.ReplyToID = m.ReplyTo.ID
+	}
+
+	return msg
+}
+
+func (c *Client) OnText(ctx tele.Context) error {
+	kind := domain.KindText
+
+	if strings.HasPrefix(ctx.Text(), "/") {
+		kind = domain.KindCommand
+	}
+
+	return c.enqueue(ctx, c.message(ctx, kind))
+}
+
+func (c *Client) OnCallback(ctx tele.Context) error {
+	cb := ctx.Callback()
+
+	if cb.Data == liveStopData {
+		return c.onLiveStop(ctx)
+	}
+
+	// Stop the spinner on the button right away, the work happens in the queue.
+	if err := ctx.Respond(); err != nil {
+		c.log.Warn("failed to answer callback", "err", err)
+	}
+
+	if cb.Message == nil {
+		return nil
+	}
+
+	msg := c.message(ctx, domain.KindCallback)
+	msg.Text = cb.Data
+
+	return c.enqueue(ctx, msg)
+}
+
+func (c *Client) OnVideo(ctx tele.Context) error {
+	video := ctx.Message().Video
+
+	return c.enqueue(ctx, c.message(ctx, domain.KindVideo, domain.Attachment{
+		FileID:   video.FileID,
+		FileName: video.FileName,
+		MIME:     video.MIME,
+		Size:     video.FileSize,
+		Duration: time.Duration(video.Duration) * time.Second,
+	}))
+}
+
+func (c *Client) OnVideoNote(ctx tele.Context) error {
+	note := ctx.Message().VideoNote
+
+	return c.enqueue(ctx, c.message(ctx, domain.KindVideo, domain.Attachment{
+		FileID:   note.FileID,
+		MIME:     "video/mp4",
+		Size:     note.FileSize,
+		Duration: time.Duration(note.Duration) * time.Second,
+	}))
+}
+
+func (c *Client) OnAudio(ctx tele.Context) error {
+	audio := ctx.Message().Audio
+
+	return c.enqueue(ctx, c.message(ctx, domain.KindAudio, domain.Attachment{
+		FileID:   audio.FileID,
+		FileName: audio.FileName,
+		MIME:     audio.MIME,
+		Size:     audio.FileSize,
+		Duration: time.Duration(audio.Duration) * time.Second,
+	}))
+}
+
+func (c *Client) OnDocument(ctx tele.Context) error {
+	doc := ctx.Message().Document
+	kind := domain.KindDocument
+
+	switch {
+	case strings.HasPrefix(doc.MIME, "audio/"):
+		kind = domain.KindAudio
+	case strings.HasPrefix(doc.MIME, "image/"):
+		kind = domain.KindPhoto
+	}
+
+	return c.enqueue(ctx, c.message(ctx, kind, domain.Attachment{
+		FileID:   doc.FileID,
+		FileName: doc.FileName,
+		MIME:     doc.MIME,
+		Size:     doc.FileSize,
+	}))
+}
+
+// OnPhoto handles photos, telebot keeps the biggest of the sizes Telegram
+// made.
+func (c *Client) OnPhoto(ctx tele.Context) error {
+	photo := ctx.Message().Photo
+
+	return c.enqueue(ctx, c.message(ctx, domain.KindPhoto, domain.Attachment{
+		FileID: photo.FileID,
+		MIME:   "image/jpeg",
+		Size:   photo.FileSize,
+	}))
+}
+
+func (c *Client) OnVoice(ctx tele.Context) error {
+	voice := ctx.Message().Voice
+
+	return c.enqueue(ctx, c.message(ctx, domain.KindVoice, domain.Attachment{
+		FileID:   voice.FileID,
+		MIME:     voice.MIME,
+		Size:     voice.FileSize,
+		Duration: time.Duration(voice.Duration) * time.Second,
+	}))
 }
 
 func (c *Client) Start() {
-	c.bot.Handle("/hello", func(ctx tele.Context) error {
-		return c.Hello(ctx)
-	})
-
-	c.bot.Handle(tele.OnText, func(ctx tele.Context) error {
-		fmt.Printf("OnText\n")
-		return c.OnText(ctx)
-	})
-
-	c.bot.Handle(tele.OnVideo, func(ctx tele.Context) error {
-		fmt.Printf("OnVideo\n")
-		return c.OnVideo(ctx)
-	})
-
-	c.bot.Handle(tele.OnAudio, func(ctx tele.Context) error {
-		fmt.Printf("OnAudio\n")
-		return c.OnAudio(ctx)
-	})
-
-	c.bot.Handle(tele.OnVoice, func(ctx tele.Context) error {
-		fmt.Printf("OnVoice\n")
-		return c.OnVoice(ctx)
-	})
+	c.bot.Handle(tele.OnText, c.OnText)
+	c.bot.Handle(tele.OnVideo, c.OnVideo)
+	c.bot.Handle(tele.OnVideoNote, c.OnVideoNote)
+	c.bot.Handle(tele.OnAudio, c.OnAudio)
+	c.bot.Handle(tele.OnDocument, c.OnDocument)
+	c.bot.Handle(tele.OnVoice, c.OnVoice)
+	c.bot.Handle(tele.OnPhoto, c.OnPhoto)
+	c.bot.Handle(tele.OnCallback, c.OnCallback)
 
 	c.bot.Start()
 }
@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// maxMessageLength and maxCaptionLength are the Telegram limits for the
+// text of one message and the caption of a photo.
+const (
+	maxMessageLength = 4096
+	maxCaptionLength = 1024
+)
+
+// liveStopData is the callback data of the stop button. It is handled right
+// here instead of the queue, where it would wait for the answer it stops.
+const liveStopData = "live:stop"
+
+var _ domain.LiveMessage = (*liveMessage)(nil)
+
+type liveKey struct {
+	chatID    int64
+	messageID int
+}
+
+// liveMessage shows a growing answer by editing one message, at most once per
+// interval.
+type liveMessage struct {
+	c      *Client
+	to     domain.ChatRef
+	owner  int64
+	key    liveKey
+	stored tele.StoredMessage
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	text  string
+	shown string
+	next  time.Time
+	timer *time.Timer
+	done  bool
+
+	// editMu keeps the final edit from being overtaken by a pending update.
+	editMu sync.Mutex
+}
+
+func (s *Client) Live(to domain.Message, placeholder string) (domain.LiveMessage, error) {
+	opts := sendOptions(to.Chat, to.ID)
+	opts.ReplyMarkup = stopMarkup()
+
+	sent, err := s.bot.Send(tele.ChatID(to.Chat.ChatID), placeholder, opts)
+
+	if err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("live").Inc()
+		return nil, fmt.Errorf("failed to send placeholder: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &liveMessage{
+		c:      s,
+		to:     to.Chat,
+		owner:  to.Chat.UserID,
+		key:    liveKey{to.Chat.ChatID, sent.ID},
+		stored: tele.StoredMessage{MessageID: strconv.Itoa(sent.ID), ChatID: to.Chat.ChatID},
+		ctx:    ctx,
+		cancel: cancel,
+		shown:  placeholder,
+		next:   time.Now().Add(s.editInterval),
+	}
+
+	s.liveMu.Lock()
+	s.lives[m.key] = m
+	s.liveMu.Unlock()
+
+	return m, nil
+}
+
+func (m *liveMessage) Context() context.Context {
+	return m.ctx
+}
+
+func (m *liveMessage) Update(text string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.done {
+		return
+	}
+
+	m.text = text
+
+	if m.timer == nil {
+		m.timer = time.AfterFunc(max(time.Until(m.next), 0), m.flush)
+	}
+}
+
+// flush shows the latest text, keeping the stop button.
+func (m *liveMessage) flush() {
+	m.editMu.Lock()
+	defer m.editMu.Unlock()
+
+	m.mu.Lock()
+	m.timer = nil
+	text := truncate(m.text, maxMessageLength)
+
+	if m.done || text == m.shown {
+		m.mu.Unlock()
+		return
+	}
+
+	m.shown = text
+	m.mu.Unlock()
+
+	_, err := m.c.bot.Edit(m.stored, text, stopMarkup())
+
+	next := time.Now().Add(m.c.editInterval)
+
+	var flood tele.FloodError
+
+	if errors.As(err, &flood) {
+		next = time.Now().Add(time.Duration(flood.RetryAfter) * time.Second)
+	}
+
+	if err != nil && !errors.Is(err, tele.ErrSameMessageContent) && !errors.Is(err, tele.ErrMessageNotModified) {
+		metrics.TelegramSendFailures.WithLabelValues("edit").Inc()
+		m.c.log.Warn("failed to update live message", "chat_id", m.to.ChatID, "err", err)
+	}
+
+	m.mu.Lock()
+	m.next = next
+	m.mu.Unlock()
+}
+
+// Finish shows the final text without the stop button. Text over the
+// Telegram limit goes on in new messages.
+func (m *liveMessage) Finish(text string) error {
+	m.stop()
+
+	m.editMu.Lock()
+	defer m.editMu.Unlock()
+
+	parts := split(text, maxMessageLength)
+
+	if _, err := m.c.bot.Edit(m.stored, parts[0]); err != nil && !errors.Is(err, tele.ErrSameMessageContent) && !errors.Is(err, tele.ErrMessageNotModified) {
+		metrics.TelegramSendFailures.WithLabelValues("edit").Inc()
+		return fmt.Errorf("failed to finish live message: %w", err)
+	}
+
+	for _, part := range parts[1:] {
+		if err := m.c.Send(m.to, part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *liveMessage) Discard() error {
+	m.stop()
+
+	m.editMu.Lock()
+	defer m.editMu.Unlock()
+
+	if err := m.c.bot.Delete(m.stored); err != nil {
+		metrics.TelegramSendFailures.WithLabelValues("delete").Inc()
+		return fmt.Errorf("failed to delete live message: %w", err)
+	}
+
+	return nil
+}
+
+// stop turns off the updates and the stop button.
+func (m *liveMessage) stop() {
+	m.mu.Lock()
+	m.done = true
+
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+
+	m.mu.Unlock()
+
+	m.cancel()
+
+	m.c.liveMu.Lock()
+	delete(m.c.lives, m.key)
+	m.c.liveMu.Unlock()
+}
+
+func stopMarkup() *tele.ReplyMarkup {
+	return inlineKeyboard([][]domain.Button{{{Text: "Stop", Data: liveStopData}}})
+}
+
+// onLiveStop handles the stop button. Only the author of the question may
+// stop the answer.
+func (c *Client) onLiveStop(ctx tele.Context) error {
+	cb := ctx.Callback()
+
+	if cb.Message == nil {
+		return ctx.Respond()
+	}
+
+	c.liveMu.Lock()
+	m, ok := c.lives[liveKey{cb.Message.Chat.ID, cb.Message.ID}]
+	c.liveMu.Unlock()
+
+	if !ok {
+		return ctx.Respond(&tele.CallbackResponse{Text: "The answer is already finished"})
+	}
+
+	if ctx.Sender() == nil || ctx.Sender().ID != m.owner {
+		return ctx.Respond(&tele.CallbackResponse{Text: "Only the author of the question can stop it"})
+	}
+
+	m.cancel()
+
+	return ctx.Respond(&tele.CallbackResponse{Text: "Stopping"})
+}
+
+// truncate cuts the text to limit runes, marking the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	return string([]rune(text)[:limit-1]) + "…"
+}
+
+// split cuts the text into parts of at most limit runes, preferring line
+// breaks. It always returns at least one part.
+func split(text string, limit int) []string {
+	var parts []string
+
+	for utf8.RuneCountInString(text) > limit {
+		head := string([]rune(text)[:limit])
+
+		if i := strings.LastIndex(head, "\n"); i > 0 {
+			head = head[:i]
+		}
+
+		parts = append(parts, head)
+		text = strings.TrimPrefix(text[len(head):], "\n")
+	}
+
+	return append(parts, text)
+}
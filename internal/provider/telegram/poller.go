@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// pollRetryInterval is the pause after a failed getUpdates call.
+const pollRetryInterval = 3 * time.Second
+
+// poller is a long poller like tele.LongPoller that also remembers when
+// Telegram last answered, so readiness can tell a dead connection from a
+// quiet chat.
+type poller struct {
+	timeout time.Duration
+	offset  int
+	lastOK  atomic.Int64
+	log     *slog.Logger
+}
+
+func (p *poller) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		updates, err := p.getUpdates(b)
+
+		if err != nil {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			p.log.Warn("getUpdates failed", "err", err)
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(pollRetryInterval):
+			}
+
+			continue
+		}
+
+		p.lastOK.Store(time.Now().UnixNano())
+
+		for _, update := range updates {
+			p.offset = update.ID + 1
+			dest <- update
+		}
+	}
+}
+
+func (p *poller) getUpdates(b *tele.Bot) ([]tele.Update, error) {
+	data, err := b.Raw("getUpdates", map[string]string{
+		"offset":  strconv.Itoa(p.offset),
+		"timeout": strconv.Itoa(int(p.timeout / time.Second)),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Result []tele.Update `json:"result"`
+	}
+
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Result, nil
+}
+
+// connected reports whether a poll succeeded within two poll timeouts.
+func (p *poller) connected() bool {
+	last := p.lastOK.Load()
+
+	return last != 0 && time.Since(time.Unix(0, last)) < 2*p.timeout+pollRetryInterval
+}
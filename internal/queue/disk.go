@@ -0,0 +1,389 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gosberbot/internal/domain"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts = 3
+
+	logFile  = "jobs.log"
+	deadFile = "dead.log"
+)
+
+const (
+	opPush = "push"
+	opAck  = "ack"
+	opNack = "nack"
+	opDead = "dead"
+)
+
+type record struct {
+	Op      string          `json:"op"`
+	ID      uint64          `json:"id"`
+	Message *domain.Message `json:"message,omitempty"`
+}
+
+type deadRecord struct {
+	Job    Job       `json:"job"`
+	Error  string    `json:"error"`
+	DiedAt time.Time `json:"died_at"`
+}
+
+// Disk is an append-only log backed queue. Every state change is written to
+// the log before it is applied, so jobs that were waiting or in progress when
+// the process stopped are available again after Open.
+type Disk struct {
+	mu          sync.Mutex
+	dir         string
+	log         *os.File
+	dead        *os.File
+	jobs        map[uint64]*Job
+	pending     []uint64
+	nextID      uint64
+	maxAttempts int
+	ready       chan struct{}
+	closed      bool
+}
+
+func Open(dir string, maxAttempts int) (*Disk, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue dir: %w", err)
+	}
+
+	q := &Disk{
+		dir:         dir,
+		jobs:        make(map[uint64]*Job),
+		maxAttempts: maxAttempts,
+		ready:       make(chan struct{}, 1),
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	dead, err := os.OpenFile(filepath.Join(dir, deadFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		q.log.Close()
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+
+	q.dead = dead
+
+	if len(q.pending) > 0 {
+		q.notify()
+	}
+
+	return q, nil
+}
+
+func (q *Disk) Push(msg domain.Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.nextID++
+	job := &Job{ID: q.nextID, Message: msg}
+
+	if err := q.write(record{Op: opPush, ID: job.ID, Message: &job.Message}); err != nil {
+		return err
+	}
+
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job.ID)
+	q.notify()
+
+	return nil
+}
+
+func (q *Disk) Pop(ctx context.Context) (Job, error) {
+	for {
+		q.mu.Lock()
+
+		if q.closed {
+			q.mu.Unlock()
+			return Job{}, ErrClosed
+		}
+
+		if len(q.pending) > 0 {
+			job := q.jobs[q.pending[0]]
+			q.pending = q.pending[1:]
+
+			if len(q.pending) > 0 {
+				q.notify()
+			}
+
+			q.mu.Unlock()
+
+			return *job, nil
+		}
+
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		case <-q.ready:
+		}
+	}
+}
+
+func (q *Disk) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	if _, ok := q.jobs[id]; !ok {
+		return fmt.Errorf("unknown job: %v", id)
+	}
+
+	if err := q.write(record{Op: opAck, ID: id}); err != nil {
+		return err
+	}
+
+	delete(q.jobs, id)
+
+	return q.truncateIfIdle()
+}
+
+func (q *Disk) Nack(id uint64, reason error) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false, ErrClosed
+	}
+
+	job, ok := q.jobs[id]
+
+	if !ok {
+		return false, fmt.Errorf("unknown job: %v", id)
+	}
+
+	if job.Attempts+1 < q.maxAttempts {
+		if err := q.write(record{Op: opNack, ID: id}); err != nil {
+			return false, err
+		}
+
+		job.Attempts++
+
+		return false, nil
+	}
+
+	job.Attempts++
+
+	dead := deadRecord{Job: *job, DiedAt: time.Now()}
+	if reason != nil {
+		dead.Error = reason.Error()
+	}
+
+	if err := writeRecord(q.dead, dead); err != nil {
+		return false, fmt.Errorf("failed to write dead-letter: %w", err)
+	}
+
+	if err := q.write(record{Op: opDead, ID: id}); err != nil {
+		return true, err
+	}
+
+	delete(q.jobs, id)
+
+	return true, q.truncateIfIdle()
+}
+
+func (q *Disk) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.jobs)
+}
+
+func (q *Disk) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+	close(q.ready)
+
+	if err := q.dead.Close(); err != nil {
+		q.log.Close()
+		return fmt.Errorf("failed to close dead-letter file: %w", err)
+	}
+
+	if err := q.log.Close(); err != nil {
+		return fmt.Errorf("failed to close queue log: %w", err)
+	}
+
+	return nil
+}
+
+func (q *Disk) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Disk) write(r record) error {
+	if err := writeRecord(q.log, r); err != nil {
+		return fmt.Errorf("failed to write queue log: %w", err)
+	}
+
+	return nil
+}
+
+// replay rebuilds the queue state from the log. Jobs that were taken by a
+// worker but never acknowledged are put back in the order they were pushed.
+func (q *Disk) replay() error {
+	f, err := os.Open(filepath.Join(q.dir, logFile))
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var r record
+
+		// A torn last line after a crash is expected, skip anything unreadable.
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+
+		if r.ID > q.nextID {
+			q.nextID = r.ID
+		}
+
+		switch r.Op {
+		case opPush:
+			if r.Message != nil {
+				q.jobs[r.ID] = &Job{ID: r.ID, Message: *r.Message}
+			}
+		case opNack:
+			if job, ok := q.jobs[r.ID]; ok {
+				job.Attempts++
+			}
+		case opAck, opDead:
+			delete(q.jobs, r.ID)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read queue log: %w", err)
+	}
+
+	for id := range q.jobs {
+		q.pending = append(q.pending, id)
+	}
+
+	sort.Slice(q.pending, func(i, j int) bool { return q.pending[i] < q.pending[j] })
+
+	return nil
+}
+
+// compact rewrites the log so it only holds the jobs that are still alive.
+func (q *Disk) compact() error {
+	path := filepath.Join(q.dir, logFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to create queue log: %w", err)
+	}
+
+	for _, id := range q.pending {
+		job := q.jobs[id]
+
+		if err := writeRecord(f, record{Op: opPush, ID: id, Message: &job.Message}); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to compact queue log: %w", err)
+		}
+
+		for i := 0; i < job.Attempts; i++ {
+			if err := writeRecord(f, record{Op: opNack, ID: id}); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to compact queue log: %w", err)
+			}
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to compact queue log: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace queue log: %w", err)
+	}
+
+	q.log, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+
+	return nil
+}
+
+// truncateIfIdle drops the log contents once every job is finished, which
+// keeps the log from growing while the bot runs.
+func (q *Disk) truncateIfIdle() error {
+	if len(q.jobs) > 0 {
+		return nil
+	}
+
+	if err := q.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate queue log: %w", err)
+	}
+
+	return nil
+}
+
+func writeRecord(f *os.File, v any) error {
+	line, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,392 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"gosberbot/internal/domain"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testMessage(text string) domain.Message {
+	return domain.Message{Kind: domain.KindText, Chat: domain.ChatRef{ChatID: 1, UserID: 1}, Text: text}
+}
+
+func openTest(t *testing.T, dir string, maxAttempts int) *Disk {
+	t.Helper()
+
+	q, err := Open(dir, maxAttempts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+// readLines decodes every line of a file in the queue dir.
+func readLines[T any](t *testing.T, dir, name string) []T {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join(dir, name))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var lines []T
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var v T
+
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		lines = append(lines, v)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
+
+// op is a log record without the message, which is checked on Pop.
+type op struct {
+	Op string
+	ID uint64
+}
+
+func checkLog(t *testing.T, dir string, want ...op) {
+	t.Helper()
+
+	var got []op
+	for _, r := range readLines[record](t, dir, logFile) {
+		got = append(got, op{Op: r.Op, ID: r.ID})
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s = %v, want %v", logFile, got, want)
+	}
+}
+
+func pop(t *testing.T, q *Disk) Job {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	job, err := q.Pop(ctx)
+
+	if err != nil {
+		t.Fatalf("Pop() error = %v", err)
+	}
+
+	return job
+}
+
+func TestDiskPushAck(t *testing.T) {
+	dir := t.TempDir()
+	q := openTest(t, dir, 0)
+	defer q.Close()
+
+	for _, text := range []string{"one", "two"} {
+		if err := q.Push(testMessage(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkLog(t, dir, op{opPush, 1}, op{opPush, 2})
+
+	job := pop(t, q)
+
+	if job.ID != 1 || job.Message.Text != "one" {
+		t.Fatalf("Pop() = %+v, want the first job", job)
+	}
+
+	if err := q.Ack(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLog(t, dir, op{opPush, 1}, op{opPush, 2}, op{opAck, 1})
+
+	if err := q.Ack(job.ID); err == nil {
+		t.Fatal("Ack() of a finished job error = nil")
+	}
+
+	if err := q.Ack(pop(t, q).ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The log is emptied once nothing is left.
+	checkLog(t, dir)
+
+	if n := q.Len(); n != 0 {
+		t.Fatalf("Len() = %d, want 0", n)
+	}
+
+	if err := q.Push(testMessage("three")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLog(t, dir, op{opPush, 3})
+}
+
+func TestDiskPopWaits(t *testing.T) {
+	q := openTest(t, t.TempDir(), 0)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Pop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pop() of an empty queue error = %v, want the context error", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(testMessage("late"))
+	}()
+
+	if job := pop(t, q); job.Message.Text != "late" {
+		t.Fatalf("Pop() = %+v, want the late job", job)
+	}
+}
+
+func TestDiskReplay(t *testing.T) {
+	dir := t.TempDir()
+	q := openTest(t, dir, 5)
+
+	for _, text := range []string{"acked", "failed", "taken", "waiting"} {
+		if err := q.Push(testMessage(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Ack(pop(t, q).ID); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := pop(t, q)
+
+	for range 2 {
+		if dead, err := q.Nack(failed.ID, errors.New("boom")); err != nil || dead {
+			t.Fatalf("Nack() = %v, %v, want a retry", dead, err)
+		}
+	}
+
+	pop(t, q)
+
+	// The process dies without Close, in the middle of writing a record.
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.WriteString(`{"op":"ack","i`); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Close()
+
+	q = openTest(t, dir, 5)
+	defer q.Close()
+
+	// Open compacts the log to the jobs still alive.
+	checkLog(t, dir, op{opPush, 2}, op{opNack, 2}, op{opNack, 2}, op{opPush, 3}, op{opPush, 4})
+
+	if n := q.Len(); n != 3 {
+		t.Fatalf("Len() after replay = %d, want 3", n)
+	}
+
+	want := []Job{
+		{ID: 2, Message: testMessage("failed"), Attempts: 2},
+		{ID: 3, Message: testMessage("taken")},
+		{ID: 4, Message: testMessage("waiting")},
+	}
+
+	for _, w := range want {
+		if job := pop(t, q); !reflect.DeepEqual(job, w) {
+			t.Fatalf("Pop() after replay = %+v, want %+v", job, w)
+		}
+	}
+
+	// New jobs don't reuse the IDs of replayed ones.
+	if err := q.Push(testMessage("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if job := pop(t, q); job.ID != 5 {
+		t.Fatalf("Pop() of a new job = %+v, want ID 5", job)
+	}
+}
+
+func TestDiskNackDead(t *testing.T) {
+	dir := t.TempDir()
+	q := openTest(t, dir, 3)
+
+	if err := q.Push(testMessage("doomed")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Push(testMessage("fine")); err != nil {
+		t.Fatal(err)
+	}
+
+	job := pop(t, q)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		dead, err := q.Nack(job.ID, errors.New("boom"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dead != (attempt == 3) {
+			t.Fatalf("attempt %d: Nack() = %v", attempt, dead)
+		}
+	}
+
+	checkLog(t, dir, op{opPush, 1}, op{opPush, 2}, op{opNack, 1}, op{opNack, 1}, op{opDead, 1})
+
+	dead := readLines[deadRecord](t, dir, deadFile)
+
+	if len(dead) != 1 || dead[0].Job.ID != 1 || dead[0].Job.Attempts != 3 || dead[0].Job.Message.Text != "doomed" || dead[0].Error != "boom" {
+		t.Fatalf("%s = %+v, want the doomed job after 3 attempts", deadFile, dead)
+	}
+
+	if _, err := q.Nack(job.ID, nil); err == nil {
+		t.Fatal("Nack() of a dead job error = nil")
+	}
+
+	if n := q.Len(); n != 1 {
+		t.Fatalf("Len() = %d, want 1", n)
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dead job stays dead after a restart, and dead.log is kept.
+	q = openTest(t, dir, 3)
+	defer q.Close()
+
+	checkLog(t, dir, op{opPush, 2})
+
+	if job := pop(t, q); job.Message.Text != "fine" {
+		t.Fatalf("Pop() after restart = %+v, want the fine job", job)
+	}
+
+	if dead := readLines[deadRecord](t, dir, deadFile); len(dead) != 1 {
+		t.Fatalf("%s has %d records after restart, want 1", deadFile, len(dead))
+	}
+}
+
+func TestDiskClose(t *testing.T) {
+	q := openTest(t, t.TempDir(), 0)
+
+	popped := make(chan error)
+
+	go func() {
+		_, err := q.Pop(context.Background())
+		popped <- err
+	}()
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-popped:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("waiting Pop() error = %v, want ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not wake a waiting Pop()")
+	}
+
+	if err := q.Push(testMessage("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Push() after Close() error = %v, want ErrClosed", err)
+	}
+
+	if err := q.Ack(1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Ack() after Close() error = %v, want ErrClosed", err)
+	}
+
+	if _, err := q.Nack(1, nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Nack() after Close() error = %v, want ErrClosed", err)
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("second Close() error = %v", err)
+	}
+}
+
+func TestDiskCloseRacesPush(t *testing.T) {
+	dir := t.TempDir()
+	q := openTest(t, dir, 0)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		pushed int
+	)
+
+	for range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				err := q.Push(testMessage("racing"))
+
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+
+				if err != nil {
+					t.Errorf("Push() error = %v", err)
+					return
+				}
+
+				mu.Lock()
+				pushed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+
+	// Every push that succeeded is on disk, and nothing else is.
+	q = openTest(t, dir, 0)
+	defer q.Close()
+
+	if n := q.Len(); n != pushed {
+		t.Fatalf("Len() after reopening = %d, want the %d pushed jobs", n, pushed)
+	}
+
+	if pushed == 0 {
+		t.Fatal("no Push() succeeded before Close()")
+	}
+}
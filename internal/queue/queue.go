@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"gosberbot/internal/domain"
+)
+
+var ErrClosed = errors.New("queue is closed")
+
+type Job struct {
+	ID       uint64         `json:"id"`
+	Message  domain.Message `json:"message"`
+	Attempts int            `json:"attempts"`
+}
+
+type Queue interface {
+	// Push stores the message and makes it available to Pop.
+	Push(msg domain.Message) error
+	// Pop blocks until a job is available or the context is done.
+	Pop(ctx context.Context) (Job, error)
+	// Ack marks the job as processed.
+	Ack(id uint64) error
+	// Nack records a failed attempt. The job stays with the caller, which
+	// retries it ahead of later jobs, until it runs out of attempts and moves
+	// to the dead-letter area. It reports whether the job is dead.
+	Nack(id uint64, reason error) (bool, error)
+	// Len returns the number of jobs waiting or in progress.
+	Len() int
+	Close() error
+}
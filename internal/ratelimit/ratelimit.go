@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Class groups messages that share limits.
+type Class string
+
+const (
+	// ClassText covers chat questions, answered by GigaChat.
+	ClassText Class = "text"
+	// ClassMedia covers voice, audio and video, recognized by SaluteSpeech.
+	ClassMedia Class = "media"
+	// ClassFile covers documents and photos. They share the per-user and
+	// per-chat media limits and are read by GigaChat.
+	ClassFile Class = "file"
+	// ClassCommand shares the per-user and per-chat text limits but no
+	// provider limit.
+	ClassCommand Class = "command"
+)
+
+const (
+	ScopeUser     = "user"
+	ScopeChat     = "chat"
+	ScopeProvider = "provider"
+)
+
+// pruneInterval is how often buckets that refilled completely are dropped.
+const pruneInterval = time.Minute
+
+// Rule is a token bucket refilled at PerMinute tokens a minute and holding up
+// to Burst tokens. A zero PerMinute disables the limit.
+type Rule struct {
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+func (r Rule) validate(name string) error {
+	if r.PerMinute < 0 || r.Burst < 0 {
+		return fmt.Errorf("%s: per_minute and burst must not be negative", name)
+	}
+
+	return nil
+}
+
+type ClassConfig struct {
+	User Rule `yaml:"user"`
+	Chat Rule `yaml:"chat"`
+}
+
+type Config struct {
+	Text  ClassConfig `yaml:"text"`
+	Media ClassConfig `yaml:"media"`
+	// GigaChat and SaluteSpeech limit all users together.
+	GigaChat     Rule `yaml:"gigachat"`
+	SaluteSpeech Rule `yaml:"salutespeech"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Text: ClassConfig{
+			User: Rule{PerMinute: 20, Burst: 5},
+			Chat: Rule{PerMinute: 60, Burst: 20},
+		},
+		Media: ClassConfig{
+			User: Rule{PerMinute: 5, Burst: 2},
+			Chat: Rule{PerMinute: 15, Burst: 5},
+		},
+		GigaChat:     Rule{PerMinute: 120, Burst: 20},
+		SaluteSpeech: Rule{PerMinute: 30, Burst: 10},
+	}
+}
+
+func (c Config) Validate() error {
+	return errors.Join(
+		c.Text.User.validate("text.user"),
+		c.Text.Chat.validate("text.chat"),
+		c.Media.User.validate("media.user"),
+		c.Media.Chat.validate("media.chat"),
+		c.GigaChat.validate("gigachat"),
+		c.SaluteSpeech.validate("salutespeech"),
+	)
+}
+
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+	// Scope names the limit that was hit.
+	Scope string
+	// Notify is set for the first rejection of a user within RetryAfter, so
+	// a flood gets a single "slow down" reply.
+	Notify bool
+}
+
+type key struct {
+	group string
+	scope string
+	id    int64
+}
+
+type bucket struct {
+	rule   Rule
+	tokens float64
+	last   time.Time
+}
+
+type check struct {
+	key  key
+	rule Rule
+}
+
+// Limiter enforces the per-user, per-chat and provider token buckets.
+type Limiter struct {
+	cfg Config
+
+	mu        sync.Mutex
+	buckets   map[key]*bucket
+	quiet     map[int64]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[key]*bucket),
+		quiet:   make(map[int64]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from every bucket the message counts against, or from
+// none of them when any is empty.
+func (l *Limiter) Allow(class Class, userID, chatID int64) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	checks := l.checks(class, userID, chatID)
+
+	res := Result{Allowed: true}
+
+	for _, c := range checks {
+		if wait := l.bucket(c, now).wait(); wait > res.RetryAfter {
+			res = Result{RetryAfter: wait, Scope: c.key.scope}
+		}
+	}
+
+	if !res.Allowed {
+		if until, ok := l.quiet[userID]; !ok || now.After(until) {
+			l.quiet[userID] = now.Add(res.RetryAfter)
+			res.Notify = true
+		}
+
+		return res
+	}
+
+	for _, c := range checks {
+		l.buckets[c.key].tokens--
+	}
+
+	return res
+}
+
+func (l *Limiter) checks(class Class, userID, chatID int64) []check {
+	limits, provider := l.cfg.Text, l.cfg.GigaChat
+	group, providerGroup := string(ClassText), string(ClassText)
+
+	switch class {
+	case ClassMedia:
+		limits, provider = l.cfg.Media, l.cfg.SaluteSpeech
+		group, providerGroup = string(ClassMedia), string(ClassMedia)
+	case ClassFile:
+		limits = l.cfg.Media
+		group = string(ClassMedia)
+	case ClassCommand:
+		provider = Rule{}
+	}
+
+	var checks []check
+
+	add := func(group, scope string, id int64, rule Rule) {
+		if rule.PerMinute > 0 {
+			checks = append(checks, check{key: key{group: group, scope: scope, id: id}, rule: rule})
+		}
+	}
+
+	add(group, ScopeUser, userID, limits.User)
+	add(group, ScopeChat, chatID, limits.Chat)
+	add(providerGroup, ScopeProvider, 0, provider)
+
+	return checks
+}
+
+// bucket returns the refilled bucket for the check, creating a full one.
+func (l *Limiter) bucket(c check, now time.Time) *bucket {
+	b, ok := l.buckets[c.key]
+
+	if !ok {
+		b = &bucket{rule: c.rule, tokens: c.rule.burst(), last: now}
+		l.buckets[c.key] = b
+		return b
+	}
+
+	b.tokens = b.refilled(now)
+	b.last = now
+
+	return b
+}
+
+func (b *bucket) refilled(now time.Time) float64 {
+	return min(b.rule.burst(), b.tokens+now.Sub(b.last).Minutes()*b.rule.PerMinute)
+}
+
+// wait is how long until the bucket holds a whole token.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rule.PerMinute * float64(time.Minute))
+}
+
+func (r Rule) burst() float64 {
+	return float64(max(r.Burst, 1))
+}
+
+// prune drops buckets that would be full by now and expired quiet periods.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+
+	l.lastPrune = now
+
+	for k, b := range l.buckets {
+		if b.refilled(now) >= b.rule.burst() {
+			delete(l.buckets, k)
+		}
+	}
+
+	for id, until := range l.quiet {
+		if now.After(until) {
+			delete(l.quiet, id)
+		}
+	}
+}
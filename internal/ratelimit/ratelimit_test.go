@@ -0,0 +1,265 @@
+package ratelimit
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(cfg Config) (*Limiter, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(cfg)
+	l.now = func() time.Time { return clock.now }
+
+	return l, clock
+}
+
+func TestAllowBurstAndRefill(t *testing.T) {
+	l, clock := newTestLimiter(Config{Text: ClassConfig{User: Rule{PerMinute: 60, Burst: 3}}})
+
+	allow := func(want bool) Result {
+		t.Helper()
+
+		res := l.Allow(ClassText, 1, 1)
+
+		if res.Allowed != want {
+			t.Fatalf("Allow() = %+v, want allowed %v", res, want)
+		}
+
+		return res
+	}
+
+	for range 3 {
+		allow(true)
+	}
+
+	res := allow(false)
+
+	if res.Scope != ScopeUser || res.RetryAfter != time.Second {
+		t.Fatalf("Allow() = %+v, want user scope after 1s", res)
+	}
+
+	clock.advance(500 * time.Millisecond)
+	allow(false)
+
+	clock.advance(500 * time.Millisecond)
+	allow(true)
+	allow(false)
+
+	// A long pause refills the bucket up to the burst only.
+	clock.advance(time.Hour)
+
+	for range 3 {
+		allow(true)
+	}
+
+	allow(false)
+}
+
+func TestAllowZeroBurst(t *testing.T) {
+	l, _ := newTestLimiter(Config{Text: ClassConfig{User: Rule{PerMinute: 1}}})
+
+	if res := l.Allow(ClassText, 1, 1); !res.Allowed {
+		t.Fatalf("first Allow() = %+v, want allowed", res)
+	}
+
+	if res := l.Allow(ClassText, 1, 1); res.Allowed || res.RetryAfter != time.Minute {
+		t.Fatalf("second Allow() = %+v, want a minute to wait", res)
+	}
+}
+
+func TestAllowRejectSpendsNothing(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Text:     ClassConfig{User: Rule{PerMinute: 1, Burst: 3}, Chat: Rule{PerMinute: 1, Burst: 1}},
+		GigaChat: Rule{PerMinute: 1, Burst: 3},
+	})
+
+	if res := l.Allow(ClassText, 1, 10); !res.Allowed {
+		t.Fatalf("Allow() = %+v, want allowed", res)
+	}
+
+	for range 5 {
+		if res := l.Allow(ClassText, 1, 10); res.Allowed || res.Scope != ScopeChat {
+			t.Fatalf("Allow() in a full chat = %+v, want the chat limit", res)
+		}
+	}
+
+	tokens := func(scope string, id int64) float64 {
+		return l.buckets[key{group: string(ClassText), scope: scope, id: id}].tokens
+	}
+
+	if user, provider := tokens(ScopeUser, 1), tokens(ScopeProvider, 0); user != 2 || provider != 2 {
+		t.Fatalf("user and provider tokens = %v, %v, want 2 and 2", user, provider)
+	}
+
+	// The tokens kept by the rejections serve other chats.
+	for chatID := int64(11); chatID <= 12; chatID++ {
+		if res := l.Allow(ClassText, 1, chatID); !res.Allowed {
+			t.Fatalf("Allow() in chat %d = %+v, want allowed", chatID, res)
+		}
+	}
+
+	if res := l.Allow(ClassText, 1, 13); res.Allowed {
+		t.Fatalf("Allow() after the user burst = %+v, want rejected", res)
+	}
+}
+
+func TestAllowNotify(t *testing.T) {
+	l, clock := newTestLimiter(Config{Text: ClassConfig{Chat: Rule{PerMinute: 60, Burst: 1}}})
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		userID  int64
+		allowed bool
+		notify  bool
+	}{
+		{name: "first message", userID: 1, allowed: true},
+		{name: "first rejection", userID: 1, notify: true},
+		{name: "flood", advance: 300 * time.Millisecond, userID: 1},
+		{name: "other user", userID: 2, notify: true},
+		{name: "flood again", advance: 300 * time.Millisecond, userID: 1},
+		{name: "after the wait", advance: 500 * time.Millisecond, userID: 1, allowed: true},
+		{name: "rejection after the quiet window", userID: 1, notify: true},
+		{name: "flood after the quiet window", userID: 1},
+	}
+
+	for _, step := range steps {
+		clock.advance(step.advance)
+
+		res := l.Allow(ClassText, step.userID, 10)
+
+		if res.Allowed != step.allowed || res.Notify != step.notify {
+			t.Fatalf("%s: Allow() = %+v, want allowed %v, notify %v", step.name, res, step.allowed, step.notify)
+		}
+	}
+}
+
+func TestAllowClasses(t *testing.T) {
+	cfg := Config{
+		Text:         ClassConfig{User: Rule{PerMinute: 1}, Chat: Rule{PerMinute: 1}},
+		Media:        ClassConfig{User: Rule{PerMinute: 1}, Chat: Rule{PerMinute: 1}},
+		GigaChat:     Rule{PerMinute: 1},
+		SaluteSpeech: Rule{PerMinute: 1},
+	}
+
+	text := func(scope string, id int64) key { return key{group: string(ClassText), scope: scope, id: id} }
+	media := func(scope string, id int64) key { return key{group: string(ClassMedia), scope: scope, id: id} }
+
+	tests := []struct {
+		class Class
+		keys  []key
+	}{
+		{class: ClassText, keys: []key{text(ScopeUser, 1), text(ScopeChat, 10), text(ScopeProvider, 0)}},
+		{class: ClassMedia, keys: []key{media(ScopeUser, 1), media(ScopeChat, 10), media(ScopeProvider, 0)}},
+		{class: ClassFile, keys: []key{media(ScopeUser, 1), media(ScopeChat, 10), text(ScopeProvider, 0)}},
+		{class: ClassCommand, keys: []key{text(ScopeUser, 1), text(ScopeChat, 10)}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.class), func(t *testing.T) {
+			l, _ := newTestLimiter(cfg)
+
+			if res := l.Allow(test.class, 1, 10); !res.Allowed {
+				t.Fatalf("Allow() = %+v, want allowed", res)
+			}
+
+			keys := slices.Collect(maps.Keys(l.buckets))
+
+			if len(keys) != len(test.keys) {
+				t.Fatalf("charged buckets = %+v, want %+v", keys, test.keys)
+			}
+
+			for _, k := range test.keys {
+				if b, ok := l.buckets[k]; !ok || b.tokens != 0 {
+					t.Fatalf("bucket %+v = %+v, want an empty one", k, b)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowFileSharesLimits(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Text:     ClassConfig{User: Rule{PerMinute: 1, Burst: 5}},
+		Media:    ClassConfig{User: Rule{PerMinute: 1, Burst: 2}},
+		GigaChat: Rule{PerMinute: 1, Burst: 2},
+	})
+
+	if res := l.Allow(ClassFile, 1, 1); !res.Allowed {
+		t.Fatalf("Allow(file) = %+v, want allowed", res)
+	}
+
+	if res := l.Allow(ClassMedia, 1, 1); !res.Allowed {
+		t.Fatalf("Allow(media) = %+v, want allowed", res)
+	}
+
+	// The file and the voice message used up the media user limit.
+	if res := l.Allow(ClassFile, 1, 1); res.Allowed || res.Scope != ScopeUser {
+		t.Fatalf("Allow(file) = %+v, want the user limit", res)
+	}
+
+	// The file and this question use up GigaChat.
+	if res := l.Allow(ClassText, 2, 2); !res.Allowed {
+		t.Fatalf("Allow(text) = %+v, want allowed", res)
+	}
+
+	if res := l.Allow(ClassText, 3, 3); res.Allowed || res.Scope != ScopeProvider {
+		t.Fatalf("Allow(text) = %+v, want the provider limit", res)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, clock := newTestLimiter(Config{
+		Text:  ClassConfig{User: Rule{PerMinute: 1, Burst: 1}},
+		Media: ClassConfig{User: Rule{PerMinute: 0.1, Burst: 1}},
+	})
+
+	l.Allow(ClassText, 1, 1)
+	l.Allow(ClassText, 1, 1)
+	l.Allow(ClassMedia, 2, 2)
+
+	if len(l.buckets) != 2 || len(l.quiet) != 1 {
+		t.Fatalf("%d buckets, %d quiet users, want 2 and 1", len(l.buckets), len(l.quiet))
+	}
+
+	// Pruning waits for its interval.
+	clock.advance(pruneInterval - time.Second)
+	l.Allow(ClassCommand, 3, 3)
+
+	if len(l.buckets) != 3 || len(l.quiet) != 1 {
+		t.Fatalf("%d buckets, %d quiet users before the interval, want 3 and 1", len(l.buckets), len(l.quiet))
+	}
+
+	// The text bucket and the quiet window are over, the slow media bucket
+	// and the command bucket used just now are not full yet.
+	clock.advance(2 * time.Second)
+	l.prune(clock.now)
+
+	if len(l.quiet) != 0 {
+		t.Fatalf("quiet users = %v, want none", l.quiet)
+	}
+
+	if _, ok := l.buckets[key{group: string(ClassText), scope: ScopeUser, id: 1}]; ok {
+		t.Fatal("the refilled bucket was kept")
+	}
+
+	if len(l.buckets) != 2 {
+		t.Fatalf("%d buckets, want 2", len(l.buckets))
+	}
+
+	// A pruned bucket comes back full.
+	if res := l.Allow(ClassText, 1, 1); !res.Allowed {
+		t.Fatalf("Allow() after pruning = %+v, want allowed", res)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"errors"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/storage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleNone    Role = ""
+	RoleAdmin   Role = "admin"
+	RoleUser    Role = "user"
+	RoleBlocked Role = "blocked"
+)
+
+type AccessConfig struct {
+	// Open lets everybody who is not blocked use the bot.
+	Open bool `yaml:"open"`
+	// RequestAccess lets unknown users ask the admins for access with /request.
+	RequestAccess bool     `yaml:"request_access"`
+	Users         []int64  `yaml:"users"`
+	Usernames     []string `yaml:"usernames"`
+	Groups        []int64  `yaml:"groups"`
+	File          string   `yaml:"file"`
+}
+
+type AccessRequest struct {
+	UserID   int64     `json:"user_id"`
+	UserName string    `json:"user_name,omitempty"`
+	ChatID   int64     `json:"chat_id"`
+	Time     time.Time `json:"time"`
+}
+
+type accessFile struct {
+	Roles     map[int64]Role          `json:"roles"`
+	Usernames []string                `json:"usernames"`
+	Groups    []int64                 `json:"groups"`
+	Requests  map[int64]AccessRequest `json:"requests"`
+}
+
+// Access decides who may use the bot. The config lists are fixed, changes
+// made with admin commands are saved to disk.
+type Access struct {
+	cfg    AccessConfig
+	admins []int64
+
+	mu   sync.Mutex
+	data accessFile
+}
+
+func NewAccess(cfg AccessConfig, admins []int64) (*Access, error) {
+	a := &Access{cfg: cfg, admins: admins}
+
+	if err := storage.LoadJSON(cfg.File, &a.data); err != nil {
+		return nil, err
+	}
+
+	if a.data.Roles == nil {
+		a.data.Roles = make(map[int64]Role)
+	}
+
+	if a.data.Requests == nil {
+		a.data.Requests = make(map[int64]AccessRequest)
+	}
+
+	return a, nil
+}
+
+// Role returns the user's role. Admins from the config can't be demoted.
+func (a *Access) Role(userID int64) Role {
+	if slices.Contains(a.admins, userID) {
+		return RoleAdmin
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if role, ok := a.data.Roles[userID]; ok {
+		return role
+	}
+
+	if slices.Contains(a.cfg.Users, userID) {
+		return RoleUser
+	}
+
+	return RoleNone
+}
+
+// Allowed reports whether the sender may use the bot in this chat.
+func (a *Access) Allowed(chat domain.ChatRef) bool {
+	switch a.Role(chat.UserID) {
+	case RoleAdmin, RoleUser:
+		return true
+	case RoleBlocked:
+		return false
+	}
+
+	if a.cfg.Open {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if name := normalizeUsername(chat.UserName); name != "" {
+		if slices.Contains(a.data.Usernames, name) || slices.ContainsFunc(a.cfg.Usernames, func(u string) bool { return normalizeUsername(u) == name }) {
+			return true
+		}
+	}
+
+	if chat.ChatID != chat.UserID {
+		return slices.Contains(a.data.Groups, chat.ChatID) || slices.Contains(a.cfg.Groups, chat.ChatID)
+	}
+
+	return false
+}
+
+// Configured reports whether the config lists the user or group ID, or the
+// username when it is not empty. Admin commands can't remove those.
+func (a *Access) Configured(id int64, username string) bool {
+	if username != "" {
+		name := normalizeUsername(username)
+		return slices.ContainsFunc(a.cfg.Usernames, func(u string) bool { return normalizeUsername(u) == name })
+	}
+
+	if id < 0 {
+		return slices.Contains(a.cfg.Groups, id)
+	}
+
+	return slices.Contains(a.cfg.Users, id)
+}
+
+func (a *Access) RequestsEnabled() bool {
+	return a.cfg.RequestAccess
+}
+
+// Admins lists everybody who gets access requests.
+func (a *Access) Admins() []int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	admins := slices.Clone(a.admins)
+
+	for id, role := range a.data.Roles {
+		if role == RoleAdmin && !slices.Contains(admins, id) {
+			admins = append(admins, id)
+		}
+	}
+
+	return admins
+}
+
+// SetRole stores the role, RoleNone removes the stored one.
+func (a *Access) SetRole(userID int64, role Role) error {
+	if slices.Contains(a.admins, userID) {
+		return errors.New("admins from the config can't be changed")
+	}
+
+	return a.update(func(d *accessFile) {
+		if role == RoleNone {
+			delete(d.Roles, userID)
+		} else {
+			d.Roles[userID] = role
+		}
+
+		delete(d.Requests, userID)
+	})
+}
+
+func (a *Access) AllowUsername(name string, allow bool) error {
+	name = normalizeUsername(name)
+
+	return a.update(func(d *accessFile) {
+		d.Usernames = slices.DeleteFunc(d.Usernames, func(u string) bool { return u == name })
+
+		if allow {
+			d.Usernames = append(d.Usernames, name)
+		}
+	})
+}
+
+func (a *Access) AllowGroup(chatID int64, allow bool) error {
+	return a.update(func(d *accessFile) {
+		d.Groups = slices.DeleteFunc(d.Groups, func(id int64) bool { return id == chatID })
+
+		if allow {
+			d.Groups = append(d.Groups, chatID)
+		}
+	})
+}
+
+// Request records an access request and reports whether it is a new one.
+func (a *Access) Request(req AccessRequest) (bool, error) {
+	a.mu.Lock()
+	_, exists := a.data.Requests[req.UserID]
+	a.mu.Unlock()
+
+	if exists {
+		return false, nil
+	}
+
+	return true, a.update(func(d *accessFile) { d.Requests[req.UserID] = req })
+}
+
+// Deny drops the open request of the user, who may ask again later. A
+// stored role stays as it is.
+func (a *Access) Deny(userID int64) error {
+	return a.update(func(d *accessFile) { delete(d.Requests, userID) })
+}
+
+// Pending returns the open request of the user.
+func (a *Access) Pending(userID int64) (AccessRequest, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	req, ok := a.data.Requests[userID]
+	return req, ok
+}
+
+// Snapshot returns a copy of the stored lists for display.
+func (a *Access) Snapshot() (roles map[int64]Role, usernames []string, groups []int64, requests []AccessRequest) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	roles = make(map[int64]Role, len(a.data.Roles))
+	for id, role := range a.data.Roles {
+		roles[id] = role
+	}
+
+	for _, req := range a.data.Requests {
+		requests = append(requests, req)
+	}
+
+	return roles, slices.Clone(a.data.Usernames), slices.Clone(a.data.Groups), requests
+}
+
+func (a *Access) update(fn func(*accessFile)) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fn(&a.data)
+
+	return storage.SaveJSON(a.cfg.File, a.data)
+}
+
+func normalizeUsername(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "@"))
+}
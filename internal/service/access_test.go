@@ -0,0 +1,305 @@
+package service
+
+import (
+	"gosberbot/internal/domain"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testAdmin   int64 = 1
+	testUser    int64 = 2
+	testStored  int64 = 3
+	testBlocked int64 = 4
+	testGroup   int64 = -100
+)
+
+// newTestAccess returns an Access with config admins, users, usernames and
+// groups, and stored roles on top of them.
+func newTestAccess(t *testing.T, cfg AccessConfig) *Access {
+	t.Helper()
+
+	cfg.Users = []int64{testUser, testBlocked}
+	cfg.Usernames = []string{"@Alice"}
+	cfg.Groups = []int64{testGroup}
+	cfg.File = filepath.Join(t.TempDir(), "access.json")
+
+	a, err := NewAccess(cfg, []int64{testAdmin})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, role := range map[int64]Role{testStored: RoleUser, testBlocked: RoleBlocked} {
+		if err := a.SetRole(id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return a
+}
+
+func TestAccessRole(t *testing.T) {
+	a := newTestAccess(t, AccessConfig{})
+
+	if err := a.SetRole(testAdmin, RoleBlocked); err == nil {
+		t.Fatal("SetRole() of a config admin error = nil")
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		role   Role
+	}{
+		{name: "config admin", userID: testAdmin, role: RoleAdmin},
+		{name: "config user", userID: testUser, role: RoleUser},
+		{name: "stored user", userID: testStored, role: RoleUser},
+		{name: "stored role over config user", userID: testBlocked, role: RoleBlocked},
+		{name: "unknown", userID: 99, role: RoleNone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if role := a.Role(test.userID); role != test.role {
+				t.Fatalf("Role(%d) = %q, want %q", test.userID, role, test.role)
+			}
+		})
+	}
+}
+
+func TestAccessAllowed(t *testing.T) {
+	private := func(userID int64, name string) domain.ChatRef {
+		return domain.ChatRef{ChatID: userID, UserID: userID, UserName: name}
+	}
+
+	group := func(chatID, userID int64) domain.ChatRef {
+		return domain.ChatRef{ChatID: chatID, UserID: userID}
+	}
+
+	tests := []struct {
+		name    string
+		open    bool
+		chat    domain.ChatRef
+		allowed bool
+	}{
+		{name: "config admin", chat: private(testAdmin, ""), allowed: true},
+		{name: "config user", chat: private(testUser, ""), allowed: true},
+		{name: "stored user", chat: private(testStored, ""), allowed: true},
+		{name: "blocked", chat: private(testBlocked, "")},
+		{name: "config username", chat: private(10, "alice"), allowed: true},
+		{name: "stored username", chat: private(11, "Bob"), allowed: true},
+		{name: "unknown username", chat: private(12, "carol")},
+		{name: "config group", chat: group(testGroup, 13), allowed: true},
+		{name: "stored group", chat: group(-200, 13), allowed: true},
+		{name: "unknown group", chat: group(-300, 13)},
+		{name: "group id in a private chat", chat: private(testGroup, "")},
+		{name: "blocked in group", chat: group(testGroup, testBlocked)},
+		{name: "open", open: true, chat: private(14, ""), allowed: true},
+		{name: "blocked when open", open: true, chat: private(testBlocked, "")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestAccess(t, AccessConfig{Open: test.open})
+
+			if err := a.AllowUsername("@bob", true); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.AllowGroup(-200, true); err != nil {
+				t.Fatal(err)
+			}
+
+			if allowed := a.Allowed(test.chat); allowed != test.allowed {
+				t.Fatalf("Allowed(%+v) = %v, want %v", test.chat, allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestAccessConfigured(t *testing.T) {
+	a := newTestAccess(t, AccessConfig{})
+
+	if err := a.AllowUsername("bob", true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         int64
+		username   string
+		configured bool
+	}{
+		{name: "config user", id: testUser, configured: true},
+		{name: "stored user", id: testStored},
+		{name: "config username", username: "@ALICE", configured: true},
+		{name: "stored username", username: "@bob"},
+		{name: "config group", id: testGroup, configured: true},
+		{name: "unknown group", id: -200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := a.Configured(test.id, test.username); got != test.configured {
+				t.Fatalf("Configured(%d, %q) = %v, want %v", test.id, test.username, got, test.configured)
+			}
+		})
+	}
+}
+
+// testMessenger records the texts the service sends and edits.
+type testMessenger struct {
+	domain.Messenger
+	texts map[int64][]string
+}
+
+func (m *testMessenger) Send(to domain.ChatRef, text string) error {
+	m.texts[to.ChatID] = append(m.texts[to.ChatID], text)
+	return nil
+}
+
+func (m *testMessenger) Edit(to domain.ChatRef, messageID int, text string) error {
+	return m.Send(to, text)
+}
+
+func TestAccessCallback(t *testing.T) {
+	const applicant int64 = 20
+
+	tests := []struct {
+		name     string
+		decision string
+		role     Role
+		allowed  bool
+		notice   string
+	}{
+		{name: "approve", decision: accessApprove, role: RoleUser, allowed: true, notice: "approved"},
+		{name: "deny", decision: accessDeny, role: RoleNone, notice: "/request again"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestAccess(t, AccessConfig{RequestAccess: true})
+			bot := &testMessenger{texts: map[int64][]string{}}
+			s := &Service{access: a, bot: bot, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			if isNew, err := a.Request(AccessRequest{UserID: applicant, ChatID: applicant}); err != nil || !isNew {
+				t.Fatalf("Request() = %v, %v", isNew, err)
+			}
+
+			press := domain.Message{Chat: domain.ChatRef{ChatID: testAdmin, UserID: testAdmin}}
+
+			if err := s.onAccessCallback(press, test.decision+":20"); err != nil {
+				t.Fatal(err)
+			}
+
+			if role := a.Role(applicant); role != test.role {
+				t.Fatalf("Role() = %q, want %q", role, test.role)
+			}
+
+			if allowed := a.Allowed(domain.ChatRef{ChatID: applicant, UserID: applicant}); allowed != test.allowed {
+				t.Fatalf("Allowed() = %v, want %v", allowed, test.allowed)
+			}
+
+			if _, ok := a.Pending(applicant); ok {
+				t.Fatal("the request is still pending")
+			}
+
+			if notices := bot.texts[applicant]; len(notices) != 1 || !strings.Contains(notices[0], test.notice) {
+				t.Fatalf("notices = %q, want one with %q", notices, test.notice)
+			}
+
+			// A second admin pressing the button changes nothing.
+			if err := s.onAccessCallback(press, accessApprove+":20"); err != nil {
+				t.Fatal(err)
+			}
+
+			if role := a.Role(applicant); role != test.role {
+				t.Fatalf("Role() after a second press = %q, want %q", role, test.role)
+			}
+
+			// The decision survives a restart.
+			reloaded, err := NewAccess(a.cfg, a.admins)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if role := reloaded.Role(applicant); role != test.role {
+				t.Fatalf("Role() after reload = %q, want %q", role, test.role)
+			}
+
+			if isNew, err := reloaded.Request(AccessRequest{UserID: applicant, ChatID: applicant}); err != nil || !isNew {
+				t.Fatalf("Request() after the decision = %v, %v, want a new request", isNew, err)
+			}
+		})
+	}
+}
+
+func TestAccessCallbackNotAdmin(t *testing.T) {
+	a := newTestAccess(t, AccessConfig{RequestAccess: true})
+	s := &Service{access: a, bot: &testMessenger{texts: map[int64][]string{}}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	if _, err := a.Request(AccessRequest{UserID: 20, ChatID: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	press := domain.Message{Chat: domain.ChatRef{ChatID: testUser, UserID: testUser}}
+
+	if err := s.onAccessCallback(press, accessApprove+":20"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.Pending(20); !ok {
+		t.Fatal("a user who is not an admin handled the request")
+	}
+}
+
+func TestDisallow(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		chat    domain.ChatRef
+		allowed bool
+	}{
+		{name: "config user", target: "2", chat: domain.ChatRef{ChatID: testUser, UserID: testUser}, allowed: true},
+		{name: "stored user", target: "3", chat: domain.ChatRef{ChatID: testStored, UserID: testStored}},
+		{name: "config username", target: "@alice", chat: domain.ChatRef{ChatID: 10, UserID: 10, UserName: "Alice"}, allowed: true},
+		{name: "stored username", target: "@bob", chat: domain.ChatRef{ChatID: 11, UserID: 11, UserName: "bob"}},
+		{name: "config group", target: "-100", chat: domain.ChatRef{ChatID: testGroup, UserID: 13}, allowed: true},
+		{name: "stored group", target: "-200", chat: domain.ChatRef{ChatID: -200, UserID: 13}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestAccess(t, AccessConfig{})
+			bot := &testMessenger{texts: map[int64][]string{}}
+			s := &Service{access: a, bot: bot, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			if err := a.AllowUsername("bob", true); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.AllowGroup(-200, true); err != nil {
+				t.Fatal(err)
+			}
+
+			_, args, _ := ParseCommand("/disallow " + test.target)
+			msg := domain.Message{Chat: domain.ChatRef{ChatID: testAdmin, UserID: testAdmin}}
+
+			if err := s.onDisallow(msg, args); err != nil {
+				t.Fatal(err)
+			}
+
+			if allowed := a.Allowed(test.chat); allowed != test.allowed {
+				t.Fatalf("Allowed() after /disallow %s = %v, want %v", test.target, allowed, test.allowed)
+			}
+
+			if replies := bot.texts[testAdmin]; test.allowed != strings.Contains(strings.Join(replies, "\n"), "config file") {
+				t.Fatalf("replies = %q", replies)
+			}
+		})
+	}
+}
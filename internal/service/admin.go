@@ -0,0 +1,346 @@
+package service
+
+import (
+	"fmt"
+	"gosberbot/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	callbackAccess = "access"
+
+	accessApprove = "approve"
+	accessDeny    = "deny"
+)
+
+func (s *Service) registerAdminCommands() {
+	s.router.Register(Command{
+		Name:        "access",
+		Description: "Show roles, allowlists and pending requests",
+		AdminOnly:   true,
+		Handler:     s.onAccess,
+	})
+
+	s.router.Register(Command{
+		Name:        "allow",
+		Usage:       "<user id|@username|group id>",
+		Description: "Give access to a user, username or group",
+		Help:        "Group IDs are negative, e.g. -1001234567890.",
+		AdminOnly:   true,
+		Handler:     s.onAllow,
+	})
+
+	s.router.Register(Command{
+		Name:        "disallow",
+		Usage:       "<user id|@username|group id>",
+		Description: "Take access away",
+		AdminOnly:   true,
+		Handler:     s.onDisallow,
+	})
+
+	s.router.Register(Command{
+		Name:        "role",
+		Usage:       "<user id> <admin|user|blocked|none>",
+		Description: "Set the role of a user",
+		Help:        "admin - may manage access\nuser - may use the bot\nblocked - is ignored\nnone - drops the stored role",
+		AdminOnly:   true,
+		Handler:     s.onRole,
+	})
+
+	s.router.Register(Command{
+		Name:        "report",
+		Usage:       "[YYYY-MM]",
+		Description: "Show the usage of every user",
+		Help:        "Lists the users by tokens spent in the month, the current one by default.",
+		AdminOnly:   true,
+		Handler:     s.onReport,
+	})
+
+	s.router.RegisterCallback(callbackAccess, s.onAccessCallback)
+}
+
+func (s *Service) onRequest(msg domain.Message, args Args) error {
+	if s.access.Allowed(msg.Chat) {
+		s.bot.Send(msg.Chat, "You already have access")
+		return nil
+	}
+
+	if !s.access.RequestsEnabled() {
+		s.bot.Send(msg.Chat, "Sorry, this bot is private")
+		return nil
+	}
+
+	req := AccessRequest{
+		UserID:   msg.Chat.UserID,
+		UserName: msg.Chat.UserName,
+		ChatID:   msg.Chat.ChatID,
+		Time:     msg.Timestamp,
+	}
+
+	isNew, err := s.access.Request(req)
+
+	if err != nil {
+		return fmt.Errorf("Request error: %w", err)
+	}
+
+	if !isNew {
+		s.bot.Send(msg.Chat, "Your request is waiting for an admin")
+		return nil
+	}
+
+	id := strconv.FormatInt(req.UserID, 10)
+	buttons := [][]domain.Button{{
+		{Text: "Approve", Data: callbackAccess + ":" + accessApprove + ":" + id},
+		{Text: "Deny", Data: callbackAccess + ":" + accessDeny + ":" + id},
+	}}
+
+	for _, admin := range s.access.Admins() {
+		to := domain.ChatRef{Platform: msg.Chat.Platform, ChatID: admin, UserID: admin}
+
+		if err := s.bot.SendButtons(to, "Access request from "+describeUser(req.UserID, req.UserName), buttons); err != nil {
+			s.logger(msg).Error("failed to send access request", "admin_id", admin, "err", err)
+		}
+	}
+
+	s.bot.Send(msg.Chat, "Your request was sent to the admins")
+
+	return nil
+}
+
+// onAccessCallback handles the approve and deny buttons of access requests.
+// The first admin to answer decides, later presses only update the prompt.
+func (s *Service) onAccessCallback(msg domain.Message, data string) error {
+	if !s.isAdmin(msg.Chat.UserID) {
+		return nil
+	}
+
+	decision, id, _ := strings.Cut(data, ":")
+	userID, err := strconv.ParseInt(id, 10, 64)
+
+	if err != nil {
+		s.logger(msg).Warn("bad access callback", "data", data)
+		return nil
+	}
+
+	req, ok := s.access.Pending(userID)
+
+	if !ok {
+		s.bot.Edit(msg.Chat, msg.ID, fmt.Sprintf("The request of %s was already handled", describeUser(userID, "")))
+		return nil
+	}
+
+	// A denied user only loses the request, blocking is up to /role.
+	verdict, notice := "approved", "Your access request was approved, welcome!"
+	save := func() error { return s.access.SetRole(userID, RoleUser) }
+
+	if decision == accessDeny {
+		verdict, notice = "denied", "Your access request was denied. You can send /request again later."
+		save = func() error { return s.access.Deny(userID) }
+	}
+
+	if err := save(); err != nil {
+		s.logger(msg).Error("failed to save access", "err", err)
+		s.bot.Send(msg.Chat, "Sorry, failed to save the decision")
+		return nil
+	}
+
+	s.logger(msg).Info("access request handled", "user_id", userID, "verdict", verdict)
+
+	s.bot.Edit(msg.Chat, msg.ID, fmt.Sprintf("Access for %s %s by %s", describeUser(req.UserID, req.UserName), verdict, describeUser(msg.Chat.UserID, msg.Chat.UserName)))
+	s.bot.Send(domain.ChatRef{Platform: msg.Chat.Platform, ChatID: req.ChatID, UserID: req.UserID}, notice)
+
+	return nil
+}
+
+func (s *Service) onAccess(msg domain.Message, args Args) error {
+	roles, usernames, groups, requests := s.access.Snapshot()
+
+	var b strings.Builder
+
+	b.WriteString("Roles:\n")
+
+	ids := make([]int64, 0, len(roles))
+	for id := range roles {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%d - %s\n", id, roles[id])
+	}
+
+	if len(usernames) > 0 {
+		b.WriteString("\nUsernames: @" + strings.Join(usernames, ", @") + "\n")
+	}
+
+	if len(groups) > 0 {
+		b.WriteString("\nGroups:")
+
+		for _, id := range groups {
+			fmt.Fprintf(&b, " %d", id)
+		}
+
+		b.WriteString("\n")
+	}
+
+	if len(requests) > 0 {
+		b.WriteString("\nPending requests:\n")
+
+		for _, req := range requests {
+			b.WriteString(describeUser(req.UserID, req.UserName) + "\n")
+		}
+	}
+
+	s.bot.Send(msg.Chat, b.String())
+
+	return nil
+}
+
+func (s *Service) onAllow(msg domain.Message, args Args) error {
+	return s.changeAccess(msg, args, true)
+}
+
+func (s *Service) onDisallow(msg domain.Message, args Args) error {
+	return s.changeAccess(msg, args, false)
+}
+
+// changeAccess handles /allow and /disallow. Positive IDs are users, negative
+// IDs are groups and anything starting with @ is a username.
+func (s *Service) changeAccess(msg domain.Message, args Args, allow bool) error {
+	target := args.Get(0)
+
+	if target == "" {
+		s.bot.Send(msg.Chat, "Usage: /allow <user id|@username|group id>")
+		return nil
+	}
+
+	var (
+		id       int64
+		username string
+	)
+
+	if strings.HasPrefix(target, "@") {
+		username = target
+	} else if parsed, err := strconv.ParseInt(target, 10, 64); err != nil {
+		s.bot.Send(msg.Chat, "Expected a user ID, a group ID or @username")
+		return nil
+	} else {
+		id = parsed
+	}
+
+	if !allow && s.access.Configured(id, username) {
+		text := fmt.Sprintf("%s is listed in the config file, remove it there", target)
+		if username == "" && id > 0 {
+			text += " or block the user with /role " + target + " blocked"
+		}
+
+		s.bot.Send(msg.Chat, text)
+		return nil
+	}
+
+	var err error
+
+	if username != "" {
+		err = s.access.AllowUsername(username, allow)
+	} else if id < 0 {
+		err = s.access.AllowGroup(id, allow)
+	} else {
+		role := RoleUser
+		if !allow {
+			role = RoleNone
+		}
+
+		err = s.access.SetRole(id, role)
+	}
+
+	if err != nil {
+		s.logger(msg).Error("failed to save access", "err", err)
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, failed to save: %v", err))
+		return nil
+	}
+
+	s.bot.Send(msg.Chat, "Saved")
+
+	return nil
+}
+
+func (s *Service) onRole(msg domain.Message, args Args) error {
+	id, err := strconv.ParseInt(args.Get(0), 10, 64)
+	role := Role(strings.ToLower(args.Get(1)))
+
+	if role == "none" {
+		role = RoleNone
+	}
+
+	if err != nil || args.Len() < 2 || !slices.Contains([]Role{RoleAdmin, RoleUser, RoleBlocked, RoleNone}, role) {
+		s.bot.Send(msg.Chat, "Usage: /role <user id> <admin|user|blocked|none>")
+		return nil
+	}
+
+	if err := s.access.SetRole(id, role); err != nil {
+		s.logger(msg).Error("failed to save access", "err", err)
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, failed to save: %v", err))
+		return nil
+	}
+
+	s.bot.Send(msg.Chat, "Saved")
+
+	return nil
+}
+
+func (s *Service) onReport(msg domain.Message, args Args) error {
+	month := time.Now().Format("2006-01")
+
+	if args.Len() > 0 {
+		if _, err := time.Parse("2006-01", args.Get(0)); err != nil {
+			s.bot.Send(msg.Chat, "Usage: /report [YYYY-MM]")
+			return nil
+		}
+
+		month = args.Get(0)
+	}
+
+	report := s.usage.Report(month)
+
+	if len(report) == 0 {
+		s.bot.Send(msg.Chat, fmt.Sprintf("No usage in %s", month))
+		return nil
+	}
+
+	ids := make([]int64, 0, len(report))
+	for id := range report {
+		ids = append(ids, id)
+	}
+
+	slices.SortFunc(ids, func(a, b int64) int {
+		return report[b].Tokens() - report[a].Tokens()
+	})
+
+	var b strings.Builder
+	var total Spent
+
+	fmt.Fprintf(&b, "Usage in %s:\n", month)
+
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%d - %s\n", id, report[id])
+		total.add(report[id])
+	}
+
+	fmt.Fprintf(&b, "\nTotal: %s", total)
+
+	s.bot.Send(msg.Chat, b.String())
+
+	return nil
+}
+
+func describeUser(id int64, name string) string {
+	if name != "" {
+		return fmt.Sprintf("@%s (%d)", name, id)
+	}
+
+	return strconv.FormatInt(id, 10)
+}
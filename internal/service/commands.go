@@ -0,0 +1,583 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"gosberbot/internal/domain"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// callbackModel is the prefix of the /model buttons.
+const callbackModel = "model"
+
+func (s *Service) registerCommands() {
+	s.router.Register(Command{
+		Name:        "start",
+		Description: "Start talking to the bot",
+		Public:      true,
+		Handler:     s.onStart,
+	})
+
+	s.router.Register(Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Description: "List commands or show help for one",
+		Public:      true,
+		Handler:     s.onHelp,
+	})
+
+	s.router.Register(Command{
+		Name:        "reset",
+		Aliases:     []string{"clear"},
+		Description: "Forget the conversation",
+		Help:        "Clears the conversation history of this chat, the next message starts a new dialog.",
+		Handler:     s.onReset,
+	})
+
+	s.router.Register(Command{
+		Name:        "settings",
+		Description: "Show the current settings",
+		Handler:     s.onSettings,
+	})
+
+	s.router.Register(Command{
+		Name:        "model",
+		Usage:       "[name]",
+		Description: "Choose the chat model",
+		Help:        "Shows the model answering in this chat with buttons to choose another one the API offers. The choice is kept for the chat, /usage shows the tokens spent on every model.",
+		Handler:     s.onModel,
+	})
+
+	s.router.Register(Command{
+		Name:        "voice",
+		Usage:       "[text|answer|both]",
+		Description: "Choose what to do with voice messages",
+		Help:        "text - reply with the transcript\nanswer - answer the question\nboth - quote the transcript above the answer",
+		Handler:     s.onVoiceMode,
+	})
+
+	s.router.Register(Command{
+		Name:        "tts",
+		Usage:       "[on|off|voice <name>]",
+		Description: "Answer with voice messages",
+		Help:        "on - answer with voice messages\noff - answer with text\nvoice <name> - choose the voice",
+		Handler:     s.onVoiceReplies,
+	})
+
+	s.router.Register(Command{
+		Name:        "say",
+		Usage:       "<text or SSML>",
+		Description: "Read the text aloud",
+		Handler:     s.onSay,
+	})
+
+	s.router.Register(Command{
+		Name:        "draw",
+		Usage:       "<description>",
+		Description: "Draw a picture",
+		Help:        "Generates an image for the description. Asking for a picture in a plain message works too, but the model decides whether to draw.",
+		Handler:     s.onDraw,
+	})
+
+	s.router.Register(Command{
+		Name:        "usage",
+		Description: "Show what you used and the budget left",
+		Help:        "Admins can add a user ID to see the usage of that user.",
+		Handler:     s.onUsage,
+	})
+
+	s.router.Register(Command{
+		Name:        "docs",
+		Description: "List the documents of this chat",
+		Help:        "Send a PDF, DOCX, .txt or .md file to add it, questions in this chat are then answered from the documents with the sources cited. A caption on the file is answered right away.",
+		Handler:     s.onDocs,
+	})
+
+	s.router.Register(Command{
+		Name:        "forget",
+		Usage:       "<document name>",
+		Description: "Remove a document from this chat",
+		Handler:     s.onForget,
+	})
+
+	s.router.Register(Command{
+		Name:        "request",
+		Description: "Ask the admins for access",
+		Public:      true,
+		Handler:     s.onRequest,
+	})
+
+	s.router.Register(Command{
+		Name:        "status",
+		Description: "Show the bot status",
+		AdminOnly:   true,
+		Handler:     s.onStatus,
+	})
+
+	s.router.RegisterCallback(callbackModel, s.onModelCallback)
+
+	s.registerAdminCommands()
+}
+
+func (s *Service) onCommand(msg domain.Message) error {
+	s.logger(msg).Info("command received", "message", msg)
+
+	name, args, ok := ParseCommand(msg.Text)
+
+	if !ok {
+		return nil
+	}
+
+	cmd, ok := s.router.Lookup(name)
+
+	if !ok {
+		s.bot.Send(msg.Chat, fmt.Sprintf("Unknown command /%s, see /help", name))
+		return nil
+	}
+
+	if cmd.AdminOnly && !s.isAdmin(msg.Chat.UserID) {
+		s.bot.Send(msg.Chat, "This command is only available to admins")
+		return nil
+	}
+
+	return cmd.Handler(msg, args)
+}
+
+func (s *Service) onCallback(msg domain.Message) error {
+	handler, data, ok := s.router.Callback(msg.Text)
+
+	if !ok {
+		s.logger(msg).Warn("unknown callback", "data", msg.Text)
+		return nil
+	}
+
+	return handler(msg, data)
+}
+
+func (s *Service) onStart(msg domain.Message, args Args) error {
+	s.bot.Send(msg.Chat, "Hi! Send me a question, a voice message, an audio file or a video and I will answer or transcribe it. Send a PDF, DOCX or text document to get its summary and ask questions about it. Send a photo, for example of an equipment plate or an error screen, to ask about it.\n\nSee /help for the list of commands.")
+
+	return nil
+}
+
+func (s *Service) onHelp(msg domain.Message, args Args) error {
+	admin := s.isAdmin(msg.Chat.UserID)
+
+	if args.Len() > 0 {
+		cmd, ok := s.router.Lookup(strings.TrimPrefix(args.Get(0), "/"))
+
+		if !ok || cmd.AdminOnly && !admin {
+			s.bot.Send(msg.Chat, fmt.Sprintf("Unknown command %s", args.Get(0)))
+			return nil
+		}
+
+		s.bot.Send(msg.Chat, commandHelp(cmd))
+		return nil
+	}
+
+	var b strings.Builder
+
+	for _, cmd := range s.router.Commands() {
+		if cmd.AdminOnly && !admin {
+			continue
+		}
+
+		b.WriteString(commandLine(cmd))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n/help <command> shows more about a command")
+
+	s.bot.Send(msg.Chat, b.String())
+
+	return nil
+}
+
+func commandLine(cmd *Command) string {
+	line := "/" + cmd.Name
+
+	if cmd.Usage != "" {
+		line += " " + cmd.Usage
+	}
+
+	return line + " - " + cmd.Description
+}
+
+func commandHelp(cmd *Command) string {
+	text := commandLine(cmd)
+
+	if len(cmd.Aliases) > 0 {
+		text += "\nAliases: /" + strings.Join(cmd.Aliases, ", /")
+	}
+
+	if cmd.Help != "" {
+		text += "\n\n" + cmd.Help
+	}
+
+	return text
+}
+
+func (s *Service) onReset(msg domain.Message, args Args) error {
+	s.history.Reset(msg.Chat.ChatID)
+	s.bot.Send(msg.Chat, "Conversation history cleared")
+
+	return nil
+}
+
+func (s *Service) onSettings(msg domain.Message, args Args) error {
+	user := s.settings.User(msg.Chat.UserID)
+	chat := s.settings.Chat(msg.Chat.ChatID)
+
+	replies := "off"
+	if chat.VoiceReplies {
+		replies = "on"
+	}
+
+	voice := chat.Voice
+	if voice == "" {
+		voice = "default"
+	}
+
+	text := fmt.Sprintf("Voice messages mode: %s\nVoice replies: %s\nVoice: %s", user.VoiceMode, replies, voice)
+
+	if model := s.modelName(msg.Chat.ChatID); model != "" {
+		text += "\nModel: " + model
+	}
+
+	s.bot.Send(msg.Chat, text)
+
+	return nil
+}
+
+func (s *Service) onModel(msg domain.Message, args Args) error {
+	catalog, ok := s.chat.(domain.ModelCatalog)
+
+	if !ok {
+		s.bot.Send(msg.Chat, "The chat model does not report its models")
+		return nil
+	}
+
+	if args.Len() > 0 {
+		s.bot.Send(msg.Chat, s.chooseModel(msg, catalog, args.Get(0)))
+		return nil
+	}
+
+	current := s.modelName(msg.Chat.ChatID)
+	models, err := catalog.Models()
+
+	if err != nil {
+		s.logger(msg).Error("failed to list models", "err", err)
+		s.bot.Send(msg.Chat, fmt.Sprintf("Model: %s\n\nSorry, failed to get the list of models", current))
+		return nil
+	}
+
+	if len(models) == 0 {
+		s.bot.Send(msg.Chat, "Model: "+current)
+		return nil
+	}
+
+	var buttons [][]domain.Button
+
+	for chunk := range slices.Chunk(models, 2) {
+		var row []domain.Button
+
+		for _, model := range chunk {
+			text := model
+			if model == current {
+				text = "✓ " + model
+			}
+
+			row = append(row, domain.Button{Text: text, Data: callbackModel + ":" + model})
+		}
+
+		buttons = append(buttons, row)
+	}
+
+	s.bot.SendButtons(msg.Chat, fmt.Sprintf("Model: %s\n\nChoose the model for this chat:", current), buttons)
+
+	return nil
+}
+
+// onModelCallback handles the model buttons of /model.
+func (s *Service) onModelCallback(msg domain.Message, data string) error {
+	catalog, ok := s.chat.(domain.ModelCatalog)
+
+	if !ok {
+		return nil
+	}
+
+	s.bot.Edit(msg.Chat, msg.ID, s.chooseModel(msg, catalog, data))
+
+	return nil
+}
+
+// chooseModel saves the model for the chat and returns the reply. The
+// default model is saved as no choice, so the chat follows the config.
+func (s *Service) chooseModel(msg domain.Message, catalog domain.ModelCatalog, name string) string {
+	models, err := catalog.Models()
+
+	if err != nil {
+		s.logger(msg).Error("failed to list models", "err", err)
+		return "Sorry, failed to get the list of models"
+	}
+
+	i := slices.IndexFunc(models, func(model string) bool { return strings.EqualFold(model, name) })
+
+	if i < 0 {
+		return fmt.Sprintf("Unknown model %s, available: %s", name, strings.Join(models, ", "))
+	}
+
+	model := models[i]
+
+	saved := model
+	if model == catalog.Model() {
+		saved = ""
+	}
+
+	if err := s.settings.UpdateChat(msg.Chat.ChatID, func(c *ChatSettings) { c.Model = saved }); err != nil {
+		s.logger(msg).Error("failed to save chat settings", "err", err)
+		return "Sorry, failed to save the setting"
+	}
+
+	s.logger(msg).Info("model chosen", "model", model)
+
+	return "Model set to " + model
+}
+
+func (s *Service) onVoiceMode(msg domain.Message, args Args) error {
+	mode := strings.ToLower(args.Get(0))
+
+	switch mode {
+	case VoiceModeText, VoiceModeAnswer, VoiceModeBoth:
+	case "":
+		current := s.settings.User(msg.Chat.UserID).VoiceMode
+		s.bot.Send(msg.Chat, fmt.Sprintf("Voice messages mode: %s\n\n/voice text - reply with the transcript\n/voice answer - answer the question\n/voice both - quote the transcript above the answer", current))
+		return nil
+	default:
+		s.bot.Send(msg.Chat, "Unknown mode, use one of: text, answer, both")
+		return nil
+	}
+
+	if err := s.settings.UpdateUser(msg.Chat.UserID, func(u *UserSettings) { u.VoiceMode = mode }); err != nil {
+		s.logger(msg).Error("failed to save user settings", "err", err)
+		s.bot.Send(msg.Chat, "Sorry, failed to save the setting")
+		return nil
+	}
+
+	s.bot.Send(msg.Chat, fmt.Sprintf("Voice messages mode set to %s", mode))
+
+	return nil
+}
+
+func (s *Service) onVoiceReplies(msg domain.Message, args Args) error {
+	if args.Len() == 0 {
+		settings := s.settings.Chat(msg.Chat.ChatID)
+
+		state := "off"
+		if settings.VoiceReplies {
+			state = "on"
+		}
+
+		s.bot.Send(msg.Chat, fmt.Sprintf("Voice replies: %s\n\n/tts on - answer with voice messages\n/tts off - answer with text\n/tts voice <name> - choose the voice", state))
+		return nil
+	}
+
+	var update func(*ChatSettings)
+
+	switch strings.ToLower(args.Get(0)) {
+	case "on":
+		update = func(c *ChatSettings) { c.VoiceReplies = true }
+	case "off":
+		update = func(c *ChatSettings) { c.VoiceReplies = false }
+	case "voice":
+		voices := s.synth.Voices()
+
+		if args.Len() < 2 {
+			s.bot.Send(msg.Chat, "Available voices: "+strings.Join(voices, ", "))
+			return nil
+		}
+
+		i := slices.IndexFunc(voices, func(v string) bool { return strings.EqualFold(v, args.Get(1)) })
+
+		if i < 0 {
+			s.bot.Send(msg.Chat, fmt.Sprintf("Unknown voice %s, available voices: %s", args.Get(1), strings.Join(voices, ", ")))
+			return nil
+		}
+
+		voice := voices[i]
+		update = func(c *ChatSettings) { c.Voice = voice }
+	default:
+		s.bot.Send(msg.Chat, "Unknown option, use one of: on, off, voice")
+		return nil
+	}
+
+	if err := s.settings.UpdateChat(msg.Chat.ChatID, update); err != nil {
+		s.logger(msg).Error("failed to save chat settings", "err", err)
+		s.bot.Send(msg.Chat, "Sorry, failed to save the setting")
+		return nil
+	}
+
+	s.bot.Send(msg.Chat, "Saved")
+
+	return nil
+}
+
+func (s *Service) onSay(msg domain.Message, args Args) error {
+	if args.Raw == "" {
+		s.bot.Send(msg.Chat, "Usage: /say <text or SSML>")
+		return nil
+	}
+
+	if err := s.say(msg.Chat, args.Raw, s.settings.Chat(msg.Chat.ChatID).Voice); err != nil {
+		s.logger(msg).Error("failed to say the text", "err", err)
+		s.bot.Send(msg.Chat, "Sorry, failed to synthesize speech")
+	}
+
+	return nil
+}
+
+func (s *Service) onDraw(msg domain.Message, args Args) error {
+	if args.Raw == "" {
+		s.bot.Send(msg.Chat, "Usage: /draw <description>")
+		return nil
+	}
+
+	generator, ok := s.chatModel(msg.Chat.ChatID).(domain.ImageGenerator)
+
+	if !ok {
+		s.bot.Send(msg.Chat, "Sorry, the chat model can't draw")
+		return nil
+	}
+
+	if err := s.checkQuota(msg, ResourceTokens); err != nil {
+		return err
+	}
+
+	s.bot.Send(msg.Chat, "Drawing...")
+
+	res, err := generator.Draw(args.Raw)
+
+	if res.Usage.Total() > 0 {
+		s.record(msg, completionSpent(cmp.Or(res.Model, s.modelName(msg.Chat.ChatID)), res.Usage))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Draw error: %w", err)
+	}
+
+	s.history.Append(msg.Chat.ChatID,
+		domain.ChatMessage{Role: domain.RoleUser, Content: "Draw " + args.Raw},
+		domain.ChatMessage{Role: domain.RoleAssistant, Content: historyText(res)},
+	)
+
+	if len(res.Images) == 0 {
+		s.bot.Reply(msg, cmp.Or(res.Text, "Sorry, no picture this time"))
+		return nil
+	}
+
+	s.sendImages(msg, res)
+
+	return nil
+}
+
+func (s *Service) onUsage(msg domain.Message, args Args) error {
+	userID := msg.Chat.UserID
+
+	if args.Len() > 0 && s.isAdmin(userID) {
+		id, err := strconv.ParseInt(args.Get(0), 10, 64)
+
+		if err != nil {
+			s.bot.Send(msg.Chat, "Usage: /usage [user id]")
+			return nil
+		}
+
+		userID = id
+	}
+
+	day, month := s.usage.Totals(userID)
+	q := s.usage.Quota()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Today: %s\nThis month: %s\n\n", day, month)
+
+	if s.isAdmin(userID) {
+		b.WriteString("Admins have no quotas")
+	} else {
+		fmt.Fprintf(&b, "Tokens left today: %s\n", budget(day.Tokens(), q.DailyTokens, ""))
+		fmt.Fprintf(&b, "Tokens left this month: %s\n", budget(month.Tokens(), q.MonthlyTokens, ""))
+		fmt.Fprintf(&b, "Audio left today: %s\n", budget(day.AudioSeconds, q.DailyAudioSeconds, " s"))
+		fmt.Fprintf(&b, "Audio left this month: %s", budget(month.AudioSeconds, q.MonthlyAudioSeconds, " s"))
+	}
+
+	s.bot.Send(msg.Chat, b.String())
+
+	return nil
+}
+
+// budget describes what is left of a limit, zero limits are unlimited.
+func budget(used, limit int, unit string) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+
+	return fmt.Sprintf("%d%s of %d%s", max(limit-used, 0), unit, limit, unit)
+}
+
+func (s *Service) onDocs(msg domain.Message, args Args) error {
+	sources, err := s.knowledge.Sources(msg.Chat.ChatID)
+
+	if err != nil {
+		return fmt.Errorf("Sources error: %w", err)
+	}
+
+	if len(sources) == 0 {
+		s.bot.Send(msg.Chat, "No documents yet, send a PDF, DOCX or text file to add one")
+		return nil
+	}
+
+	var b strings.Builder
+
+	b.WriteString("Documents:")
+
+	for _, src := range sources {
+		fmt.Fprintf(&b, "\n%s - %d parts, added %s", src.Name, src.Chunks, src.Added.Format(time.DateOnly))
+	}
+
+	b.WriteString("\n\n/forget <name> removes a document")
+
+	s.bot.Send(msg.Chat, b.String())
+
+	return nil
+}
+
+func (s *Service) onForget(msg domain.Message, args Args) error {
+	if args.Raw == "" {
+		s.bot.Send(msg.Chat, "Usage: /forget <document name>")
+		return nil
+	}
+
+	n, err := s.knowledge.Forget(msg.Chat.ChatID, args.Raw)
+
+	if err != nil {
+		return fmt.Errorf("Forget error: %w", err)
+	}
+
+	if n == 0 {
+		s.bot.Send(msg.Chat, fmt.Sprintf("No document %s, see /docs", args.Raw))
+		return nil
+	}
+
+	s.bot.Send(msg.Chat, fmt.Sprintf("Removed %s", args.Raw))
+
+	return nil
+}
+
+func (s *Service) onStatus(msg domain.Message, args Args) error {
+	s.bot.Send(msg.Chat, fmt.Sprintf("Queued jobs: %d\nTools: %s", s.queue.Len(), strings.Join(s.tools.Names(), ", ")))
+
+	return nil
+}
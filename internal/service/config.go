@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"time"
+)
+
+type Config struct {
+	AdminIDs      []int64 `yaml:"admin_ids" env:"ADMIN_IDS"`
+	HistoryTurns  int     `yaml:"history_max_turns" env:"HISTORY_MAX_TURNS"`
+	HistoryTokens int     `yaml:"history_max_tokens" env:"HISTORY_MAX_TOKENS"`
+	LightWorkers  int     `yaml:"light_workers" env:"LIGHT_WORKERS"`
+	HeavyWorkers  int     `yaml:"heavy_workers" env:"HEAVY_WORKERS"`
+	SettingsFile  string  `yaml:"settings_file" env:"SETTINGS_FILE"`
+	// RetryDelay is the wait before the first retry of a failed message,
+	// it doubles with every further attempt.
+	RetryDelay time.Duration `yaml:"retry_delay" env:"RETRY_DELAY"`
+
+	Access    AccessConfig    `yaml:"access"`
+	Usage     UsageConfig     `yaml:"usage"`
+	Knowledge KnowledgeConfig `yaml:"knowledge"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HistoryTurns:  DefaultHistoryTurns,
+		HistoryTokens: DefaultHistoryTokens,
+		LightWorkers:  DefaultLightWorkers,
+		HeavyWorkers:  DefaultHeavyWorkers,
+		SettingsFile:  "data/settings.json",
+		RetryDelay:    DefaultRetryDelay,
+		Access: AccessConfig{
+			RequestAccess: true,
+			File:          "data/access.json",
+		},
+		Usage: UsageConfig{
+			File:          "data/usage.json",
+			RetentionDays: 90,
+		},
+		Knowledge: KnowledgeConfig{
+			Dir:             "data/vectors",
+			ChunkSize:       1000,
+			ChunkOverlap:    150,
+			TopK:            4,
+			MinScore:        0.3,
+			MaxDocumentSize: 10 << 20,
+			SummaryPartSize: 8000,
+			SummaryMaxParts: 30,
+		},
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.HistoryTurns < 1 || c.HistoryTokens < 1 {
+		errs = append(errs, errors.New("history_max_turns and history_max_tokens must be positive"))
+	}
+
+	if c.LightWorkers < 1 || c.HeavyWorkers < 1 {
+		errs = append(errs, errors.New("light_workers and heavy_workers must be positive"))
+	}
+
+	if c.RetryDelay <= 0 {
+		errs = append(errs, errors.New("retry_delay must be positive"))
+	}
+
+	if c.SettingsFile == "" {
+		errs = append(errs, errors.New("settings_file is required"))
+	}
+
+	if c.Access.File == "" {
+		errs = append(errs, errors.New("access.file is required"))
+	}
+
+	if !c.Access.Open && len(c.AdminIDs) == 0 && len(c.Access.Users) == 0 && len(c.Access.Usernames) == 0 && len(c.Access.Groups) == 0 {
+		errs = append(errs, errors.New("the bot is closed to everybody, set admin_ids, access allowlists or access.open"))
+	}
+
+	if err := c.Usage.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Knowledge.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"gosberbot/internal/document"
+	"gosberbot/internal/domain"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// onDocument reads a PDF, DOCX or text document and replies with its
+// summary, or with the answer when the caption asks a question. The
+// document is also indexed for the questions that follow, and the summary
+// goes into the conversation. Sending a document with the same name again
+// replaces it.
+func (s *Service) onDocument(msg domain.Message) error {
+	s.logger(msg).Info("document received", "message", msg)
+
+	if len(msg.Attachments) == 0 {
+		return fmt.Errorf("%s message without attachment", msg.Kind)
+	}
+
+	file := msg.Attachments[0]
+	cfg := s.knowledge.Config()
+
+	if file.Size > cfg.MaxDocumentSize {
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, the document is too big, the limit is %d MB", cfg.MaxDocumentSize>>20))
+		return nil
+	}
+
+	if err := s.checkQuota(msg, ResourceTokens); err != nil {
+		return err
+	}
+
+	name := file.FileName
+	if name == "" {
+		name = "document"
+	}
+
+	fileName, err := s.download(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(fileName)
+
+	text, err := document.ExtractFile(fileName, name)
+
+	switch {
+	case errors.Is(err, document.ErrUnsupported):
+		reason := err.Error()
+		if i := strings.Index(reason, document.ErrUnsupported.Error()); i >= 0 {
+			reason = reason[i:]
+		}
+
+		s.bot.Reply(msg, fmt.Sprintf("Sorry, this document can't be read: %s.\nSupported formats: PDF with a text layer, DOCX, TXT and Markdown.", reason))
+		return nil
+	case err != nil:
+		return fmt.Errorf("ExtractFile error: %w", err)
+	case strings.TrimSpace(text) == "":
+		s.bot.Reply(msg, "The document is empty")
+		return nil
+	}
+
+	live, err := s.bot.Live(msg, "Reading the document…")
+
+	if err != nil {
+		return fmt.Errorf("Live error: %w", err)
+	}
+
+	var indexed Spent
+
+	if embedder, ok := s.chat.(domain.Embedder); ok {
+		chunks, u, err := s.knowledge.Index(embedder, msg.Chat.ChatID, name, text)
+		indexed = embeddingSpent(embedder.EmbeddingsModel(), u)
+
+		// The summary is still worth having without the index.
+		if err != nil {
+			s.logger(msg).Error("failed to index the document", "err", err)
+		} else {
+			s.logger(msg).Info("document indexed", "chunks", chunks, "tokens", u.Total())
+		}
+	}
+
+	question := strings.TrimSpace(msg.Text)
+	res, err := s.digest(live.Context(), s.chatModel(msg.Chat.ChatID), name, text, question, func(done, total int) {
+		live.Update(fmt.Sprintf("Reading the document, part %d of %d…", done, total))
+	})
+
+	if res.Usage.Total() > 0 || indexed.Tokens() > 0 {
+		spent := completionSpent(cmp.Or(res.Model, s.modelName(msg.Chat.ChatID)), res.Usage)
+		spent.add(indexed)
+
+		s.record(msg, spent)
+	}
+
+	stopped := live.Context().Err() != nil
+	final := res.Text
+
+	switch {
+	case stopped:
+		final = "[stopped]"
+	case err != nil:
+		final = "Sorry, failed to read the document"
+	case res.read < res.parts:
+		final += fmt.Sprintf("\n\n[only the first %d of %d parts were read]", res.read, res.parts)
+	}
+
+	if finishErr := live.Finish(final); finishErr != nil {
+		s.logger(msg).Error("failed to finish the answer", "err", finishErr)
+	}
+
+	if err != nil && !stopped {
+		return fmt.Errorf("digest error: %w", err)
+	}
+
+	if stopped || res.Text == "" {
+		return nil
+	}
+
+	request := question
+	if request == "" {
+		request = "Summarize the document"
+	}
+
+	s.history.Append(msg.Chat.ChatID,
+		domain.ChatMessage{Role: domain.RoleUser, Content: fmt.Sprintf("%s %q", request, name)},
+		domain.ChatMessage{Role: domain.RoleAssistant, Content: res.Text},
+	)
+
+	return nil
+}
+
+// digestResult is the summary or the answer with the usage of all requests,
+// made from the first read of the parts of the document.
+type digestResult struct {
+	domain.Completion
+	read, parts int
+}
+
+// digest summarizes the text or answers the question about it. A text
+// longer than a part is read map-reduce style: every part is summarized or
+// searched for the question on its own, then the notes are merged, in
+// rounds while they are still too long, and the final answer is written
+// from them.
+func (s *Service) digest(ctx context.Context, chat domain.ChatModel, name, text, question string, progress func(done, total int)) (digestResult, error) {
+	cfg := s.knowledge.Config()
+	parts := chunkText(text, cfg.SummaryPartSize, 0)
+	res := digestResult{parts: len(parts)}
+	parts = parts[:min(len(parts), cfg.SummaryMaxParts)]
+
+	var err error
+
+	complete := func(instruction, content string) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		completion, err := chat.Complete([]domain.ChatMessage{
+			{Role: domain.RoleSystem, Content: instruction},
+			{Role: domain.RoleUser, Content: content},
+		})
+
+		res.Usage.PromptTokens += completion.Usage.PromptTokens
+		res.Usage.CompletionTokens += completion.Usage.CompletionTokens
+		res.Model = cmp.Or(completion.Model, res.Model)
+
+		return strings.TrimSpace(completion.Text), err
+	}
+
+	if len(parts) == 1 {
+		res.read = 1
+		res.Text, err = complete(readInstruction(name, question), withQuestion(parts[0], question))
+
+		return res, err
+	}
+
+	notes := make([]string, 0, len(parts))
+
+	for i, part := range parts {
+		progress(i+1, len(parts))
+
+		note, err := complete(partInstruction(name, question, i+1, len(parts)), part)
+
+		if err != nil {
+			return res, err
+		}
+
+		notes = append(notes, note)
+		res.read++
+	}
+
+	// Merge the notes in groups that fit a part until they fit one.
+	for len(notes) > 1 && utf8.RuneCountInString(strings.Join(notes, "\n\n")) > cfg.SummaryPartSize {
+		var merged []string
+
+		for _, group := range groupNotes(notes, cfg.SummaryPartSize) {
+			note, err := complete(mergeInstruction(name, question), strings.Join(group, "\n\n"))
+
+			if err != nil {
+				return res, err
+			}
+
+			merged = append(merged, note)
+		}
+
+		notes = merged
+	}
+
+	res.Text, err = complete(finalInstruction(name, question), withQuestion(strings.Join(notes, "\n\n"), question))
+
+	return res, err
+}
+
+// groupNotes packs consecutive notes into groups of up to size characters,
+// at least two notes each so every round shrinks.
+func groupNotes(notes []string, size int) [][]string {
+	var (
+		groups [][]string
+		group  []string
+		length int
+	)
+
+	for _, note := range notes {
+		if len(group) >= 2 && length+utf8.RuneCountInString(note) > size {
+			groups = append(groups, group)
+			group, length = nil, 0
+		}
+
+		group = append(group, note)
+		length += utf8.RuneCountInString(note)
+	}
+
+	return append(groups, group)
+}
+
+func withQuestion(text, question string) string {
+	if question == "" {
+		return text
+	}
+
+	return text + "\n\nQuestion: " + question
+}
+
+func readInstruction(name, question string) string {
+	if question == "" {
+		return fmt.Sprintf("Summarize the document %q: what it is about, the key points, facts and figures. Write in the language of the document.", name)
+	}
+
+	return fmt.Sprintf("Answer the question after the document %q using the document. If the document doesn't answer it, say so. Write in the language of the question.", name)
+}
+
+func partInstruction(name, question string, part, parts int) string {
+	if question == "" {
+		return fmt.Sprintf("This is part %d of %d of the document %q. Summarize the part: the key points, facts, figures and names. Write in the language of the document.", part, parts, name)
+	}
+
+	return fmt.Sprintf("This is part %d of %d of the document %q. Write down everything in it that helps to answer the question %q. Reply with just \"nothing\" if nothing does.", part, parts, name, question)
+}
+
+func mergeInstruction(name, question string) string {
+	if question == "" {
+		return fmt.Sprintf("These are summaries of consecutive parts of the document %q. Merge them into one shorter summary keeping the key points, facts and figures.", name)
+	}
+
+	return fmt.Sprintf("These are notes from consecutive parts of the document %q. Merge them into one shorter note keeping everything that helps to answer the question %q.", name, question)
+}
+
+func finalInstruction(name, question string) string {
+	if question == "" {
+		return fmt.Sprintf("These are summaries of consecutive parts of the document %q. Write the summary of the whole document from them: what it is about, the key points, facts and figures. Write in the language of the document.", name)
+	}
+
+	return fmt.Sprintf("These are notes from the parts of the document %q. Answer the question after them using the notes. If they don't answer it, say so. Write in the language of the question.", name)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"gosberbot/internal/domain"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	DefaultHistoryTurns  = 10
+	DefaultHistoryTokens = 4000
+)
+
+type History struct {
+	mu        sync.Mutex
+	chats     map[int64][]domain.ChatMessage
+	maxTurns  int
+	maxTokens int
+}
+
+func NewHistory(maxTurns, maxTokens int) *History {
+	if maxTurns <= 0 {
+		maxTurns = DefaultHistoryTurns
+	}
+
+	if maxTokens <= 0 {
+		maxTokens = DefaultHistoryTokens
+	}
+
+	return &History{
+		chats:     make(map[int64][]domain.ChatMessage),
+		maxTurns:  maxTurns,
+		maxTokens: maxTokens,
+	}
+}
+
+// Messages returns a copy of the chat history followed by the given messages.
+func (h *History) Messages(chatID int64, next ...domain.ChatMessage) []domain.ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	messages := make([]domain.ChatMessage, 0, len(h.chats[chatID])+len(next))
+	messages = append(messages, h.chats[chatID]...)
+	messages = append(messages, next...)
+
+	return messages
+}
+
+func (h *History) Append(chatID int64, messages ...domain.ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.chats[chatID] = h.trim(append(h.chats[chatID], messages...))
+}
+
+func (h *History) Reset(chatID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.chats, chatID)
+}
+
+// trim drops the oldest turns until the history fits both the turn and the
+// token limits. A turn is a user message together with the assistant answer.
+func (h *History) trim(messages []domain.ChatMessage) []domain.ChatMessage {
+	if len(messages) > h.maxTurns*2 {
+		messages = messages[len(messages)-h.maxTurns*2:]
+	}
+
+	tokens := 0
+	for _, m := range messages {
+		tokens += estimateTokens(m.Content)
+	}
+
+	for len(messages) > 2 && tokens > h.maxTokens {
+		tokens -= estimateTokens(messages[0].Content) + estimateTokens(messages[1].Content)
+		messages = messages[2:]
+	}
+
+	return append([]domain.ChatMessage(nil), messages...)
+}
+
+// estimateTokens is a rough approximation; GigaChat averages about
+// three to four characters per token for Russian and English text.
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 1
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/vector"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// embedBatch is how many chunks go into one embeddings request.
+const embedBatch = 16
+
+type KnowledgeConfig struct {
+	Dir string `yaml:"dir"`
+	// ChunkSize and ChunkOverlap are in characters. The GigaChat embeddings
+	// model reads up to 512 tokens of a text.
+	ChunkSize    int `yaml:"chunk_size"`
+	ChunkOverlap int `yaml:"chunk_overlap"`
+	// TopK chunks scoring at least MinScore are added to a question.
+	TopK            int     `yaml:"top_k"`
+	MinScore        float64 `yaml:"min_score"`
+	MaxDocumentSize int64   `yaml:"max_document_size"`
+	// Documents longer than SummaryPartSize characters are summarized part
+	// by part, up to SummaryMaxParts parts.
+	SummaryPartSize int `yaml:"summary_part_size"`
+	SummaryMaxParts int `yaml:"summary_max_parts"`
+}
+
+func (c KnowledgeConfig) validate() error {
+	var errs []error
+
+	if c.Dir == "" {
+		errs = append(errs, errors.New("knowledge.dir is required"))
+	}
+
+	if c.ChunkSize < 100 || c.ChunkOverlap < 0 || c.ChunkOverlap > c.ChunkSize/2 {
+		errs = append(errs, errors.New("knowledge.chunk_size must be at least 100 and chunk_overlap at most half of it"))
+	}
+
+	if c.TopK < 1 {
+		errs = append(errs, errors.New("knowledge.top_k must be positive"))
+	}
+
+	if c.MaxDocumentSize < 1 {
+		errs = append(errs, errors.New("knowledge.max_document_size must be positive"))
+	}
+
+	if c.SummaryPartSize < 1000 || c.SummaryMaxParts < 1 {
+		errs = append(errs, errors.New("knowledge.summary_part_size must be at least 1000 and summary_max_parts positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Knowledge indexes the documents uploaded to a chat and finds the parts
+// relevant to a question. Each chat has its own collection.
+type Knowledge struct {
+	cfg   KnowledgeConfig
+	store *vector.Store
+}
+
+func NewKnowledge(cfg KnowledgeConfig) (*Knowledge, error) {
+	store, err := vector.Open(cfg.Dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Knowledge{cfg: cfg, store: store}, nil
+}
+
+// Index chunks and embeds the text and stores it under the source name,
+// replacing an earlier version. It returns the number of chunks.
+func (k *Knowledge) Index(embedder domain.Embedder, chatID int64, source, text string) (int, domain.TokenUsage, error) {
+	chunks := chunkText(text, k.cfg.ChunkSize, k.cfg.ChunkOverlap)
+
+	if len(chunks) == 0 {
+		return 0, domain.TokenUsage{}, errors.New("the document is empty")
+	}
+
+	var usage domain.TokenUsage
+	records := make([]vector.Record, 0, len(chunks))
+	now := time.Now()
+
+	for start := 0; start < len(chunks); start += embedBatch {
+		batch := chunks[start:min(start+embedBatch, len(chunks))]
+		vectors, u, err := embedder.Embed(batch)
+
+		usage.PromptTokens += u.PromptTokens
+
+		if err != nil {
+			return 0, usage, fmt.Errorf("Embed error: %w", err)
+		}
+
+		for i, v := range vectors {
+			records = append(records, vector.Record{Chunk: start + i + 1, Text: batch[i], Vector: v, Added: now})
+		}
+	}
+
+	if err := k.store.Put(collection(chatID), source, records); err != nil {
+		return 0, usage, err
+	}
+
+	return len(records), usage, nil
+}
+
+// Retrieve returns the chunks relevant to the question. Chats without
+// documents cost nothing.
+func (k *Knowledge) Retrieve(embedder domain.Embedder, chatID int64, question string) ([]vector.Match, domain.TokenUsage, error) {
+	sources, err := k.store.Sources(collection(chatID))
+
+	if err != nil || len(sources) == 0 {
+		return nil, domain.TokenUsage{}, err
+	}
+
+	vectors, usage, err := embedder.Embed([]string{question})
+
+	if err != nil {
+		return nil, usage, fmt.Errorf("Embed error: %w", err)
+	}
+
+	matches, err := k.store.Search(collection(chatID), vectors[0], k.cfg.TopK)
+
+	if err != nil {
+		return nil, usage, err
+	}
+
+	relevant := matches[:0]
+
+	for _, m := range matches {
+		if float64(m.Score) >= k.cfg.MinScore {
+			relevant = append(relevant, m)
+		}
+	}
+
+	return relevant, usage, nil
+}
+
+func (k *Knowledge) Sources(chatID int64) ([]vector.Source, error) {
+	return k.store.Sources(collection(chatID))
+}
+
+func (k *Knowledge) Forget(chatID int64, source string) (int, error) {
+	return k.store.Delete(collection(chatID), source)
+}
+
+func (k *Knowledge) Config() KnowledgeConfig {
+	return k.cfg
+}
+
+func collection(chatID int64) string {
+	return strconv.FormatInt(chatID, 10)
+}
+
+// contextMessage turns the matches into a system message asking the model to
+// cite them by number.
+func contextMessage(matches []vector.Match) domain.ChatMessage {
+	var b strings.Builder
+
+	b.WriteString("Answer using the document excerpts below when they are relevant and cite them by number, e.g. [1]. If they don't cover the question, say so and answer from general knowledge.")
+
+	for i, m := range matches {
+		fmt.Fprintf(&b, "\n\n[%d] %s, part %d:\n%s", i+1, m.Source, m.Chunk, m.Text)
+	}
+
+	return domain.ChatMessage{Role: domain.RoleSystem, Content: b.String()}
+}
+
+// citations lists the excerpts given to the model, to go under the answer.
+func citations(matches []vector.Match) string {
+	if len(matches) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString("\n\nSources:")
+
+	for i, m := range matches {
+		fmt.Fprintf(&b, "\n[%d] %s, part %d", i+1, m.Source, m.Chunk)
+	}
+
+	return b.String()
+}
+
+// chunkText cuts the text into pieces of at most size characters that
+// overlap by about overlap characters. Cuts go at paragraph, line, sentence
+// or word boundaries where possible.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+
+	var chunks []string
+
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+
+		if end < len(runes) {
+			end = breakPoint(runes, start+size/2, end)
+		}
+
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		if end == len(runes) {
+			break
+		}
+
+		// Step back for the overlap, then forward to the start of a word.
+		next := end - overlap
+		for next < end && !unicode.IsSpace(runes[next-1]) {
+			next++
+		}
+
+		start = next
+	}
+
+	return chunks
+}
+
+// breakPoint returns the best place to cut runes between from and to.
+func breakPoint(runes []rune, from, to int) int {
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		s := []rune(sep)
+
+		for i := to - len(s); i >= from; i-- {
+			if string(runes[i:i+len(s)]) == sep {
+				return i + len(s)
+			}
+		}
+	}
+
+	return to
+}
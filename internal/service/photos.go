@@ -0,0 +1,74 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"gosberbot/internal/domain"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxImageSize is the GigaChat limit for an uploaded image.
+const maxImageSize = 15 << 20
+
+// defaultPhotoPrompt is the question about a photo sent without a caption.
+const defaultPhotoPrompt = "What is in the picture? Read out any text on it, such as an equipment nameplate or an error message on a screen, and explain what it means."
+
+// onPhoto asks the vision model about the photo with the caption as the
+// question. The questions that follow go to the chat's model, which sees the
+// answer about the photo but not the photo itself.
+func (s *Service) onPhoto(msg domain.Message) error {
+	s.logger(msg).Info("photo received", "message", msg)
+
+	if len(msg.Attachments) == 0 {
+		return fmt.Errorf("%s message without attachment", msg.Kind)
+	}
+
+	file := msg.Attachments[0]
+	vision, ok := s.chat.(domain.VisionModel)
+
+	switch {
+	case !ok:
+		s.bot.Send(msg.Chat, "Sorry, the chat model can't look at images")
+		return nil
+	case !slices.Contains(vision.ImageTypes(), file.MIME):
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, %s images are not supported, send a photo or one of: %s", file.MIME, strings.Join(vision.ImageTypes(), ", ")))
+		return nil
+	case file.Size > maxImageSize:
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, the image is too big, the limit is %d MB", maxImageSize>>20))
+		return nil
+	}
+
+	if err := s.checkQuota(msg, ResourceTokens); err != nil {
+		return err
+	}
+
+	fileName, err := s.download(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(fileName)
+
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return fmt.Errorf("os.ReadFile error: %w", err)
+	}
+
+	id, err := vision.Upload(domain.Image{Data: data, MIME: file.MIME})
+
+	if err != nil {
+		return fmt.Errorf("Upload error: %w", err)
+	}
+
+	s.logger(msg).Debug("photo uploaded", "file_id", id, "size", len(data))
+
+	return s.respond(msg, domain.ChatMessage{
+		Role:        domain.RoleUser,
+		Content:     cmp.Or(strings.TrimSpace(msg.Text), defaultPhotoPrompt),
+		Attachments: []string{id},
+	})
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"gosberbot/internal/domain"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLightWorkers = 8
+	DefaultHeavyWorkers = 2
+	DefaultRetryDelay   = 5 * time.Second
+
+	// maxRetryDelay caps the doubled retry delay.
+	maxRetryDelay = 5 * time.Minute
+)
+
+// Pool runs messages of different chats in parallel while keeping messages
+// of the same chat in the order they were submitted. A failed message is
+// retried before the later messages of its chat.
+type Pool struct {
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	lanes      map[int64][]task
+	light      chan struct{}
+	heavy      chan struct{}
+	retryDelay time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewPool(lightWorkers, heavyWorkers int, retryDelay time.Duration) *Pool {
+	if lightWorkers <= 0 {
+		lightWorkers = DefaultLightWorkers
+	}
+
+	if heavyWorkers <= 0 {
+		heavyWorkers = DefaultHeavyWorkers
+	}
+
+	if retryDelay <= 0 {
+		retryDelay = DefaultRetryDelay
+	}
+
+	return &Pool{
+		lanes:      make(map[int64][]task),
+		light:      make(chan struct{}, lightWorkers),
+		heavy:      make(chan struct{}, heavyWorkers),
+		retryDelay: retryDelay,
+		stop:       make(chan struct{}),
+	}
+}
+
+type task struct {
+	msg     domain.Message
+	handler func() bool
+}
+
+// Submit queues the handler in the lane of the chat. A handler returning
+// true is run again after a delay that doubles with every retry.
+func (p *Pool) Submit(msg domain.Message, handler func() bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, busy := p.lanes[msg.Chat.ChatID]
+	p.lanes[msg.Chat.ChatID] = append(pending, task{msg: msg, handler: handler})
+
+	if busy {
+		return
+	}
+
+	p.wg.Add(1)
+	go p.run(msg.Chat.ChatID)
+}
+
+// Wait stops the pool and waits for the running handlers. Retries and
+// messages that did not start yet are dropped without an ack, so the queue
+// replays them after a restart.
+func (p *Pool) Wait() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
+
+func (p *Pool) run(chatID int64) {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		pending := p.lanes[chatID]
+		if len(pending) == 0 || p.stopped() {
+			// A stopped pool leaves the rest of the lane to the queue.
+			delete(p.lanes, chatID)
+			p.mu.Unlock()
+			return
+		}
+		t := pending[0]
+		p.lanes[chatID] = pending[1:]
+		p.mu.Unlock()
+
+		if !p.runTask(t) {
+			// The failed message and the rest of the lane were never
+			// acknowledged, they run again in order after a restart.
+			p.mu.Lock()
+			delete(p.lanes, chatID)
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// runTask runs the task until it no longer asks for a retry. It returns false
+// when the pool stopped before the task could run or while waiting for a
+// retry.
+func (p *Pool) runTask(t task) bool {
+	sem := p.semaphore(t.msg)
+
+	for retries := 0; ; retries++ {
+		select {
+		case sem <- struct{}{}:
+		case <-p.stop:
+			return false
+		}
+
+		// Both cases may be ready at once, a stop wins.
+		if p.stopped() {
+			<-sem
+			return false
+		}
+
+		retry := t.handler()
+		<-sem
+
+		if !retry {
+			return true
+		}
+
+		timer := time.NewTimer(min(p.retryDelay<<retries, maxRetryDelay))
+
+		select {
+		case <-timer.C:
+		case <-p.stop:
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+func (p *Pool) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) semaphore(msg domain.Message) chan struct{} {
+	switch msg.Kind {
+	case domain.KindVoice, domain.KindAudio, domain.KindVideo, domain.KindDocument, domain.KindPhoto:
+		return p.heavy
+	default:
+		return p.light
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"gosberbot/internal/domain"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func poolMessage(chatID int64) domain.Message {
+	return domain.Message{Kind: domain.KindText, Chat: domain.ChatRef{ChatID: chatID, UserID: chatID}}
+}
+
+// waitStopped waits until Wait has closed the stop channel of the pool.
+func waitStopped(t *testing.T, p *Pool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !p.stopped(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the pool did not stop")
+		}
+	}
+}
+
+func TestPoolOrderAndRetry(t *testing.T) {
+	p := NewPool(4, 1, time.Millisecond)
+
+	var (
+		mu   sync.Mutex
+		runs = map[int64][]int{}
+		done sync.WaitGroup
+	)
+
+	for i := range 6 {
+		chatID := int64(i % 2)
+		failures := 0
+
+		if i == 2 {
+			failures = 2
+		}
+
+		done.Add(1)
+
+		p.Submit(poolMessage(chatID), func() bool {
+			mu.Lock()
+			runs[chatID] = append(runs[chatID], i)
+			mu.Unlock()
+
+			if failures > 0 {
+				failures--
+				return true
+			}
+
+			done.Done()
+
+			return false
+		})
+	}
+
+	done.Wait()
+	p.Wait()
+
+	// A retried message runs again before the later ones of its chat.
+	want := map[int64][]int{0: {0, 2, 2, 2, 4}, 1: {1, 3, 5}}
+
+	if !reflect.DeepEqual(runs, want) {
+		t.Fatalf("runs = %v, want %v", runs, want)
+	}
+}
+
+func TestPoolWaitLeavesQueued(t *testing.T) {
+	p := NewPool(1, 1, time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+
+	record := func(name string) func() bool {
+		return func() bool {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+
+			return false
+		}
+	}
+
+	p.Submit(poolMessage(1), func() bool {
+		close(started)
+		<-release
+
+		return false
+	})
+
+	<-started
+
+	// The next message of the chat waits for its lane, the other chat for
+	// the only light worker.
+	p.Submit(poolMessage(1), record("same chat"))
+	p.Submit(poolMessage(2), record("other chat"))
+
+	waited := make(chan struct{})
+
+	go func() {
+		p.Wait()
+		close(waited)
+	}()
+
+	waitStopped(t, p)
+	close(release)
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return")
+	}
+
+	if len(ran) != 0 {
+		t.Fatalf("%v ran after Wait(), want them left to the queue", ran)
+	}
+}
+
+func TestPoolWaitDuringRetry(t *testing.T) {
+	p := NewPool(1, 1, time.Hour)
+
+	failed := make(chan struct{})
+	var next bool
+
+	p.Submit(poolMessage(1), func() bool {
+		close(failed)
+		return true
+	})
+
+	p.Submit(poolMessage(1), func() bool {
+		next = true
+		return false
+	})
+
+	<-failed
+
+	waited := make(chan struct{})
+
+	go func() {
+		p.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() waited for the retry delay")
+	}
+
+	if next {
+		t.Fatal("the message after the failed one ran")
+	}
+}
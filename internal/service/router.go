@@ -0,0 +1,181 @@
+package service
+
+import (
+	"fmt"
+	"gosberbot/internal/domain"
+	"strings"
+	"unicode"
+)
+
+type CommandHandler func(msg domain.Message, args Args) error
+
+// CallbackHandler handles an inline button press, data is the button data
+// without the "prefix:" part.
+type CallbackHandler func(msg domain.Message, data string) error
+
+type Command struct {
+	// Name is the command without the leading slash, e.g. "help".
+	Name    string
+	Aliases []string
+	// Usage describes the arguments, e.g. "[on|off]".
+	Usage string
+	// Description is the one line shown in the client menu and /help.
+	Description string
+	// Help is the longer text shown by /help <command>.
+	Help string
+	// AdminOnly commands are rejected for other users and hidden from the menu.
+	AdminOnly bool
+	// Public commands also work for users without access.
+	Public  bool
+	Handler CommandHandler
+}
+
+// Args holds the command arguments both as typed and split into fields.
+// Double quotes group words with spaces into a single field.
+type Args struct {
+	Raw    string
+	Fields []string
+}
+
+func (a Args) Len() int {
+	return len(a.Fields)
+}
+
+// Get returns the i-th field or an empty string when there are fewer fields.
+func (a Args) Get(i int) string {
+	if i < 0 || i >= len(a.Fields) {
+		return ""
+	}
+
+	return a.Fields[i]
+}
+
+// Router maps command names and aliases to commands, and button data
+// prefixes to callback handlers.
+type Router struct {
+	commands  []*Command
+	names     map[string]*Command
+	callbacks map[string]CallbackHandler
+}
+
+func NewRouter() *Router {
+	return &Router{names: make(map[string]*Command), callbacks: make(map[string]CallbackHandler)}
+}
+
+// RegisterCallback routes button data "prefix:..." to the handler.
+func (r *Router) RegisterCallback(prefix string, handler CallbackHandler) {
+	if _, ok := r.callbacks[prefix]; ok {
+		panic(fmt.Sprintf("callback %s registered twice", prefix))
+	}
+
+	r.callbacks[prefix] = handler
+}
+
+// Callback finds the handler for the button data and strips the prefix.
+func (r *Router) Callback(data string) (CallbackHandler, string, bool) {
+	prefix, rest, _ := strings.Cut(data, ":")
+	handler, ok := r.callbacks[prefix]
+
+	return handler, rest, ok
+}
+
+// Register adds the command. Names are case-insensitive; registering the same
+// name twice is a programming error and panics.
+func (r *Router) Register(cmd Command) {
+	c := &cmd
+
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		name = strings.ToLower(name)
+
+		if _, ok := r.names[name]; ok {
+			panic(fmt.Sprintf("command /%s registered twice", name))
+		}
+
+		r.names[name] = c
+	}
+
+	r.commands = append(r.commands, c)
+}
+
+func (r *Router) Lookup(name string) (*Command, bool) {
+	c, ok := r.names[strings.ToLower(name)]
+	return c, ok
+}
+
+// Commands returns the registered commands in registration order.
+func (r *Router) Commands() []*Command {
+	return r.commands
+}
+
+// Menu returns the commands to show in the messenger's command menu.
+func (r *Router) Menu() []domain.Command {
+	menu := make([]domain.Command, 0, len(r.commands))
+
+	for _, c := range r.commands {
+		if c.AdminOnly {
+			continue
+		}
+
+		menu = append(menu, domain.Command{Name: c.Name, Description: c.Description})
+	}
+
+	return menu
+}
+
+// ParseCommand splits "/name@bot args" into the command name and arguments.
+func ParseCommand(text string) (string, Args, bool) {
+	text = strings.TrimSpace(text)
+
+	if !strings.HasPrefix(text, "/") {
+		return "", Args{}, false
+	}
+
+	name, raw := text[1:], ""
+
+	// Arguments may also start on the next line.
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, raw = name[:i], name[i:]
+	}
+
+	name, _, _ = strings.Cut(name, "@")
+
+	if name == "" {
+		return "", Args{}, false
+	}
+
+	raw = strings.TrimSpace(raw)
+
+	return strings.ToLower(name), Args{Raw: raw, Fields: splitArgs(raw)}, true
+}
+
+func splitArgs(s string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+		inside bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inside = true
+		case unicode.IsSpace(r) && !quoted:
+			if inside {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			field.WriteRune(r)
+			inside = true
+		}
+	}
+
+	if inside {
+		fields = append(fields, field.String())
+	}
+
+	return fields
+}
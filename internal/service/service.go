@@ -1,191 +1,784 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"gosberbot/internal/audio"
 	"gosberbot/internal/domain"
-	"gosberbot/internal/provider/gigachat"
-	"gosberbot/internal/provider/salutespeech"
-	"gosberbot/internal/provider/telegram"
-	"io"
-	"net/http"
-	"net/url"
+	"gosberbot/internal/metrics"
+	"gosberbot/internal/queue"
+	"gosberbot/internal/tools"
+	"log/slog"
+	"math"
 	"os"
-	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
+// maxSynthesisLength is the SaluteSpeech limit for a single synthesis request.
+const maxSynthesisLength = 4000
+
+// estimatedBytesPerSecond is 128 kbit/s, used for audio of unknown length.
+const estimatedBytesPerSecond = 16000
+
+var errNoSpeech = errors.New("no speech recognized")
+
 type Service struct {
-	speech *salutespeech.Client
-	chat   *gigachat.Client
-	bot    *telegram.Client
-	queue  chan domain.Message
+	speech    domain.SpeechRecognizer
+	synth     domain.SpeechSynthesizer
+	chat      domain.ChatModel
+	bot       domain.Messenger
+	queue     queue.Queue
+	history   *History
+	pool      *Pool
+	settings  *Settings
+	router    *Router
+	access    *Access
+	usage     *Usage
+	tools     *tools.Registry
+	knowledge *Knowledge
+	log       *slog.Logger
+	running   atomic.Bool
 }
 
-func NewService(queue chan domain.Message) *Service {
-	return &Service{queue: queue}
+func NewService(queue queue.Queue, history *History, pool *Pool, settings *Settings, access *Access, usage *Usage, tools *tools.Registry, knowledge *Knowledge, log *slog.Logger) *Service {
+	s := &Service{queue: queue, history: history, pool: pool, settings: settings, access: access, usage: usage, tools: tools, knowledge: knowledge, router: NewRouter(), log: log}
+	s.registerCommands()
+
+	return s
 }
 
-func (s *Service) Init(bot *telegram.Client, speech *salutespeech.Client, chat *gigachat.Client) {
+// logger returns the service logger tagged with the message correlation ID.
+func (s *Service) logger(msg domain.Message) *slog.Logger {
+	return s.log.With("correlation_id", msg.CorrelationID, "chat_id", msg.Chat.ChatID)
+}
+
+func (s *Service) isAdmin(userID int64) bool {
+	return s.access.Role(userID) == RoleAdmin
+}
+
+func (s *Service) Init(bot domain.Messenger, speech domain.SpeechRecognizer, synth domain.SpeechSynthesizer, chat domain.ChatModel) {
 	s.bot = bot
 	s.speech = speech
+	s.synth = synth
 	s.chat = chat
+
+	if err := s.bot.SetCommands(s.router.Menu()); err != nil {
+		s.log.Error("failed to set commands", "err", err)
+	}
 }
 
 func (s *Service) Start(ctx context.Context) {
+	s.running.Store(true)
+	defer s.running.Store(false)
+
 	for {
-		select {
-		case <-ctx.Done():
+		job, err := s.queue.Pop(ctx)
+
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, queue.ErrClosed) {
+				s.log.Error("queue error", "err", err)
+			}
+
 			return
-		case msg := <-s.queue:
-			s.processor(msg)
 		}
+
+		s.pool.Submit(job.Message, func() bool {
+			retry := s.handle(job)
+			job.Attempts++
+
+			return retry
+		})
 	}
 }
 
+// Alive fails once the queue loop has stopped, e.g. after a queue error.
+func (s *Service) Alive() error {
+	if !s.running.Load() {
+		return errors.New("service loop is not running")
+	}
+
+	return nil
+}
+
 func (s *Service) Stop() {
+	s.pool.Wait()
 }
 
-func (s *Service) processor(msg domain.Message) {
-	switch msg.Type {
-	case "text":
-		s.onText(msg)
-	case "video":
-		s.onVideo(msg)
-	case "voice":
-		s.onVoice(msg)
-	case "audio":
-		s.onAudio(msg)
-	case "command":
-		s.onCommand(msg)
+// handle processes the job and reports whether it should be retried.
+func (s *Service) handle(job queue.Job) bool {
+	log := s.logger(job.Message).With("job_id", job.ID)
+	start := time.Now()
+
+	err := s.process(job.Message)
+
+	metrics.MessageDuration.WithLabelValues(string(job.Message.Kind), metrics.Result(err)).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		log.Debug("job done", "duration", time.Since(start))
+
+		if err := s.queue.Ack(job.ID); err != nil {
+			log.Error("failed to ack job", "err", err)
+		}
+
+		return false
+	}
+
+	log.Warn("job failed", "attempt", job.Attempts+1, "err", err)
+
+	dead, err := s.queue.Nack(job.ID, err)
+
+	if err != nil {
+		log.Error("failed to nack job", "err", err)
+	}
+
+	if dead {
+		log.Error("job moved to dead letters")
+		s.bot.Send(job.Message.Chat, "Sorry, I could not process your message, please try again later")
+	}
+
+	return !dead
+}
+
+// process runs the message, a panic becomes an error so the job is retried
+// and dead-lettered like any failure instead of crashing the bot.
+func (s *Service) process(msg domain.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger(msg).Error("panic while processing message", "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return s.processor(msg)
+}
+
+func (s *Service) processor(msg domain.Message) error {
+	if !s.authorize(msg) {
+		return nil
+	}
+
+	err := s.dispatch(msg)
+
+	var quota *QuotaError
+
+	if errors.As(err, &quota) {
+		s.logger(msg).Info("quota exceeded", "user_id", msg.Chat.UserID, "resource", quota.Resource, "period", quota.Period)
+		s.bot.Send(msg.Chat, quota.Notice())
+		return nil
+	}
+
+	return err
+}
+
+func (s *Service) dispatch(msg domain.Message) error {
+	switch msg.Kind {
+	case domain.KindText:
+		return s.onText(msg)
+	case domain.KindVideo:
+		return s.onVideo(msg)
+	case domain.KindVoice:
+		return s.onVoice(msg)
+	case domain.KindAudio:
+		return s.onAudio(msg)
+	case domain.KindDocument:
+		return s.onDocument(msg)
+	case domain.KindPhoto:
+		return s.onPhoto(msg)
+	case domain.KindCommand:
+		return s.onCommand(msg)
+	case domain.KindCallback:
+		return s.onCallback(msg)
 	default:
-		fmt.Printf("unknown message: %v\n", msg)
+		s.logger(msg).Warn("unknown message kind", "message", msg)
 	}
+
+	return nil
 }
 
-func (s *Service) onText(msg domain.Message) {
-	fmt.Printf("onText: %v\n", msg)
+// authorize lets users with access through and tells everybody else, except
+// blocked users, how to get it. Public commands work for everybody not blocked.
+func (s *Service) authorize(msg domain.Message) bool {
+	if s.access.Allowed(msg.Chat) {
+		return true
+	}
 
-	text, err := s.chat.GetCompletions(msg.Payload)
+	if s.access.Role(msg.Chat.UserID) == RoleBlocked {
+		s.logger(msg).Info("message from blocked user ignored")
+		return false
+	}
 
-	if err != nil {
-		fmt.Printf("GetCompletions error: %v\n", err)
-		return
+	if msg.Kind == domain.KindCommand {
+		if name, _, ok := ParseCommand(msg.Text); ok {
+			if cmd, ok := s.router.Lookup(name); ok && cmd.Public {
+				return true
+			}
+		}
 	}
 
-	fmt.Printf("Completion: %s\n", text)
+	s.logger(msg).Info("access denied", "user_id", msg.Chat.UserID)
 
-	s.bot.Send(msg.User, text)
+	if msg.Kind == domain.KindCallback {
+		return false
+	}
+
+	if s.access.RequestsEnabled() {
+		s.bot.Send(msg.Chat, "You don't have access to this bot yet. Send /request to ask the admins for it.")
+	} else {
+		s.bot.Send(msg.Chat, "Sorry, this bot is private")
+	}
+
+	return false
 }
 
-func (s *Service) onVideo(msg domain.Message) {
-	fmt.Printf("onVideo: %v\n", msg)
+func (s *Service) onText(msg domain.Message) error {
+	s.logger(msg).Info("text received", "message", msg)
+
+	return s.respond(msg, domain.ChatMessage{Role: domain.RoleUser, Content: msg.Text})
+}
+
+// respond answers the question. Text answers are streamed into a live
+// message when the model can stream, voice answers need the whole text.
+func (s *Service) respond(msg domain.Message, q domain.ChatMessage) error {
+	streamer, ok := s.chatModel(msg.Chat.ChatID).(domain.ChatStreamer)
+
+	if ok && !s.settings.Chat(msg.Chat.ChatID).VoiceReplies {
+		return s.stream(msg, streamer, q)
+	}
+
+	res, err := s.answer(msg, q)
+
+	if err != nil {
+		return err
+	}
 
-	s.bot.Send(msg.User, "not implemented yet")
+	if len(res.Images) > 0 {
+		s.sendImages(msg, res)
+		return nil
+	}
+
+	s.reply(msg, res.Text)
+
+	return nil
 }
 
-func (s *Service) onAudio(msg domain.Message) {
-	fmt.Printf("onAudio: %v\n", msg)
+// chatModel returns the chat model answering in the chat, switched to the
+// model the chat chose with /model.
+func (s *Service) chatModel(chatID int64) domain.ChatModel {
+	catalog, ok := s.chat.(domain.ModelCatalog)
 
-	s.bot.Send(msg.User, "not implemented yet")
+	if !ok {
+		return s.chat
+	}
+
+	if model := s.settings.Chat(chatID).Model; model != "" && model != catalog.Model() {
+		return catalog.WithModel(model)
+	}
+
+	return s.chat
 }
 
-func (s *Service) onVoice(msg domain.Message) {
-	fmt.Printf("onVoice: %v\n", msg)
+// modelName is the name of the model answering in the chat, empty when the
+// chat model doesn't tell.
+func (s *Service) modelName(chatID int64) string {
+	catalog, ok := s.chat.(domain.ModelCatalog)
 
-	fileUrl := msg.Payload
-	fileName := getFilename(fileUrl)
+	if !ok {
+		return ""
+	}
+
+	return cmp.Or(s.settings.Chat(chatID).Model, catalog.Model())
+}
 
-	if err := downloadFile(fileUrl, fileName); err != nil {
-		fmt.Printf("downloadFile error\n")
+// reply answers the message with a voice message when the chat asked for
+// voice replies and falls back to text when synthesis is not possible.
+func (s *Service) reply(msg domain.Message, text string) {
+	settings := s.settings.Chat(msg.Chat.ChatID)
+
+	if !settings.VoiceReplies || utf8.RuneCountInString(text) > maxSynthesisLength {
+		s.bot.Reply(msg, text)
 		return
 	}
 
-	s.bot.Send(msg.User, fmt.Sprintf("Download %s", fileName))
+	if err := s.say(msg.Chat, text, settings.Voice); err != nil {
+		s.logger(msg).Error("failed to say the answer", "err", err)
+		s.bot.Reply(msg, text)
+	}
+}
+
+func (s *Service) say(to domain.ChatRef, text, voice string) error {
+	opts := domain.SynthesisOptions{
+		Voice: voice,
+		SSML:  strings.HasPrefix(strings.TrimSpace(text), "<speak>"),
+	}
 
-	fileReqId, err := s.speech.UploadFile(fileName)
+	data, err := s.synth.Synthesize(text, opts)
 
 	if err != nil {
-		fmt.Printf("UploadFile error: %v\n", err)
-		return
+		return fmt.Errorf("Synthesize error: %w", err)
+	}
+
+	return s.bot.SendVoice(to, data)
+}
+
+// answer continues the chat conversation with the question and returns the
+// reply. The tokens are charged to the sender of msg.
+func (s *Service) answer(msg domain.Message, q domain.ChatMessage) (domain.Completion, error) {
+	if err := s.checkQuota(msg, ResourceTokens); err != nil {
+		return domain.Completion{}, err
 	}
 
-	s.bot.Send(msg.User, "Start recognize...")
+	chatID := msg.Chat.ChatID
+	messages, sources := s.prompt(msg, q)
+
+	chat := s.chatModel(chatID)
+
+	res, err := s.converse(context.Background(), msg, messages, func(messages []domain.ChatMessage, functions []domain.Function) (domain.Completion, error) {
+		return chat.Complete(messages, functions...)
+	}, nil)
 
-	taskId, err := s.speech.RecognizeFile(fileReqId)
+	// Tool calls before a failure were paid for.
+	if err == nil || res.Usage.Total() > 0 {
+		s.record(msg, completionSpent(cmp.Or(res.Model, s.modelName(chatID)), res.Usage))
+	}
 
 	if err != nil {
-		fmt.Printf("RecognizeFile error: %v\n", err)
-		return
+		return domain.Completion{}, fmt.Errorf("Complete error: %w", err)
 	}
 
-	for i := 0; i < 10; i++ {
-		fileReqId, err = s.speech.GetStatus(taskId)
+	s.logger(msg).Debug("completion received", "length", utf8.RuneCountInString(res.Text), "images", len(res.Images), "prompt_tokens", res.Usage.PromptTokens, "completion_tokens", res.Usage.CompletionTokens)
 
-		if err != nil {
-			fmt.Printf("GetStatus error: %v\n", err)
-			return
+	s.history.Append(chatID, q, domain.ChatMessage{Role: domain.RoleAssistant, Content: historyText(res)})
+
+	res.Text += sources
+
+	return res, nil
+}
+
+// sendImages sends the images of the answer, the first one with the text
+// as its caption.
+func (s *Service) sendImages(msg domain.Message, res domain.Completion) {
+	caption := res.Text
+
+	for _, image := range res.Images {
+		if err := s.bot.SendPhoto(msg.Chat, image, caption); err != nil {
+			s.logger(msg).Error("failed to send image", "err", err)
+		}
+
+		caption = ""
+	}
+}
+
+// historyText is the answer as the model sees it later, the images are
+// only mentioned.
+func historyText(res domain.Completion) string {
+	if len(res.Images) == 0 {
+		return res.Text
+	}
+
+	return strings.TrimSpace(res.Text + "\n\n" + strings.Repeat("[image]", len(res.Images)))
+}
+
+// completer makes one chat model request.
+type completer func(messages []domain.ChatMessage, functions []domain.Function) (domain.Completion, error)
+
+// converse asks the model until it answers with text, running the tools it
+// calls in between. After MaxCalls tool calls the model gets no functions
+// and has to answer. The usage of all requests is summed up. Only the
+// question and the final answer go to the history, the tool calls don't.
+func (s *Service) converse(ctx context.Context, msg domain.Message, messages []domain.ChatMessage, complete completer, onCall func(name string)) (domain.Completion, error) {
+	var usage domain.TokenUsage
+
+	for calls := 0; ; calls++ {
+		var functions []domain.Function
+
+		if calls < s.tools.MaxCalls() {
+			functions = s.tools.Functions()
+		}
+
+		if err := ctx.Err(); err != nil {
+			return domain.Completion{Usage: usage}, err
+		}
+
+		res, err := complete(messages, functions)
+
+		usage.PromptTokens += res.Usage.PromptTokens
+		usage.CompletionTokens += res.Usage.CompletionTokens
+		res.Usage = usage
+
+		if err != nil || res.FunctionCall == nil {
+			return res, err
+		}
+
+		if len(functions) == 0 {
+			return res, fmt.Errorf("model called %s without functions", res.FunctionCall.Name)
 		}
 
-		if fileReqId != "" {
-			break
+		call := *res.FunctionCall
+
+		s.logger(msg).Info("tool called", "tool", call.Name, "call", calls+1)
+
+		if onCall != nil {
+			onCall(call.Name)
 		}
 
-		time.Sleep(3 * time.Second)
+		result := s.tools.Call(ctx, call)
+
+		messages = append(slices.Clip(messages),
+			domain.ChatMessage{Role: domain.RoleAssistant, Content: res.Text, FunctionCall: &call},
+			domain.ChatMessage{Role: domain.RoleFunction, Name: call.Name, Content: result},
+		)
 	}
+}
 
-	s.bot.Send(msg.User, "Get text...")
+// stream answers the question in a live message the user can stop. What was
+// generated before the stop stays in the history. A failure is returned for
+// a retry only when no answer was shown.
+func (s *Service) stream(msg domain.Message, streamer domain.ChatStreamer, q domain.ChatMessage) error {
+	if err := s.checkQuota(msg, ResourceTokens); err != nil {
+		return err
+	}
 
-	text, err := s.speech.DownloadFile(fileReqId)
+	live, err := s.bot.Live(msg, "…")
 
 	if err != nil {
-		fmt.Printf("DownloadFile error: %v\n", err)
-		return
+		return fmt.Errorf("Live error: %w", err)
+	}
+
+	chatID := msg.Chat.ChatID
+	messages, sources := s.prompt(msg, q)
+
+	var text strings.Builder
+
+	res, err := s.converse(live.Context(), msg, messages, func(messages []domain.ChatMessage, functions []domain.Function) (domain.Completion, error) {
+		text.Reset()
+
+		return streamer.Stream(live.Context(), messages, functions, func(delta string) {
+			text.WriteString(delta)
+			live.Update(text.String())
+		})
+	}, func(name string) {
+		live.Update(fmt.Sprintf("Using %s…", name))
+	})
+
+	stopped := live.Context().Err() != nil
+	usage := res.Usage
+
+	// A stopped request ends before its usage is reported, so it is estimated.
+	if stopped {
+		if usage.PromptTokens == 0 {
+			for _, m := range messages {
+				usage.PromptTokens += estimateTokens(m.Content)
+			}
+		}
+
+		usage.CompletionTokens += estimateTokens(res.Text)
 	}
 
-	s.bot.Send(msg.User, fmt.Sprintf("Text: %s\n", text))
+	if err == nil || stopped || usage.Total() > 0 {
+		s.record(msg, completionSpent(cmp.Or(res.Model, s.modelName(chatID)), usage))
+	}
+
+	// A failure before any answer showed up is retried in a new live
+	// message, once this one is gone.
+	if err != nil && !stopped && text.Len() == 0 && res.Text == "" && len(res.Images) == 0 {
+		discardErr := live.Discard()
+
+		if discardErr == nil {
+			return fmt.Errorf("Stream error: %w", err)
+		}
+
+		s.logger(msg).Error("failed to discard the live message", "err", discardErr)
+	}
+
+	final := res.Text
+
+	switch {
+	case stopped:
+		final = strings.TrimSpace(final + "\n\n[stopped]")
+	case err != nil && final == "":
+		final = "Sorry, failed to get the answer"
+	case err != nil:
+		final += "\n\n[interrupted]"
+	case final == "" && len(res.Images) == 0:
+		final = "[empty answer]"
+	default:
+		final += sources
+	}
+
+	s.finish(msg, live, final, res)
+
+	// The user saw how the answer ended, a retry would answer twice.
+	if err != nil && !stopped {
+		s.logger(msg).Error("stream failed", "err", err)
+		return nil
+	}
+
+	s.logger(msg).Debug("stream finished", "length", utf8.RuneCountInString(res.Text), "stopped", stopped, "prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+
+	if res.Text != "" || len(res.Images) > 0 {
+		s.history.Append(chatID, q, domain.ChatMessage{Role: domain.RoleAssistant, Content: historyText(res)})
+	}
+
+	return nil
 }
 
-func (s *Service) onCommand(msg domain.Message) {
-	fmt.Printf("onCommand: %v\n", msg)
+// finish ends the live answer with the final text. An answer with images
+// replaces the live message with them, the text becoming the caption.
+func (s *Service) finish(msg domain.Message, live domain.LiveMessage, final string, res domain.Completion) {
+	if len(res.Images) > 0 {
+		err := live.Discard()
+
+		if err == nil {
+			s.sendImages(msg, domain.Completion{Text: final, Images: res.Images})
+			return
+		}
+
+		s.logger(msg).Error("failed to discard the live message", "err", err)
+	}
+
+	if err := live.Finish(final); err != nil {
+		s.logger(msg).Error("failed to finish the answer", "err", err)
+	}
+
+	if len(res.Images) > 0 {
+		s.sendImages(msg, domain.Completion{Images: res.Images})
+	}
+}
+
+// prompt returns the messages to send for the question: the history, the
+// excerpts of the chat documents relevant to the question and the question.
+// The second result lists the excerpts to show under the answer. Documents
+// are skipped when they can't be searched.
+func (s *Service) prompt(msg domain.Message, q domain.ChatMessage) ([]domain.ChatMessage, string) {
+	chatID := msg.Chat.ChatID
+	embedder, ok := s.chat.(domain.Embedder)
+
+	if !ok {
+		return s.history.Messages(chatID, q), ""
+	}
+
+	matches, usage, err := s.knowledge.Retrieve(embedder, chatID, q.Content)
+
+	if usage.Total() > 0 {
+		s.record(msg, embeddingSpent(embedder.EmbeddingsModel(), usage))
+	}
+
+	if err != nil {
+		s.logger(msg).Error("failed to search the documents", "err", err)
+	}
+
+	if len(matches) == 0 {
+		return s.history.Messages(chatID, q), ""
+	}
+
+	s.logger(msg).Debug("document excerpts found", "count", len(matches), "best_score", matches[0].Score)
+
+	return s.history.Messages(chatID, contextMessage(matches), q), citations(matches)
+}
+
+// checkQuota fails with a QuotaError when the sender has used up the
+// resource. Admins have no quotas.
+func (s *Service) checkQuota(msg domain.Message, resource string) error {
+	if s.isAdmin(msg.Chat.UserID) {
+		return nil
+	}
+
+	return s.usage.Check(msg.Chat.UserID, resource)
 }
 
-func (s *Service) Send(msg domain.Message) {
-	s.queue <- msg
+func (s *Service) record(msg domain.Message, spent Spent) {
+	if err := s.usage.Record(msg.Chat.UserID, spent); err != nil {
+		s.logger(msg).Error("failed to record usage", "err", err)
+	}
 }
 
-func getFilename(urlstr string) string {
-	u, err := url.Parse(urlstr)
+func (s *Service) onVideo(msg domain.Message) error {
+	s.logger(msg).Info("video received", "message", msg)
+
+	text, err := s.transcribe(msg)
+
 	if err != nil {
-		fmt.Printf("Error due to parsing url: %v\n", err)
-		return ""
+		return s.transcribeError(msg, err)
+	}
+
+	s.bot.Send(msg.Chat, fmt.Sprintf("Text: %s\n", text))
+
+	return nil
+}
+
+func (s *Service) onAudio(msg domain.Message) error {
+	s.logger(msg).Info("audio received", "message", msg)
+
+	text, err := s.transcribe(msg)
+
+	if err != nil {
+		return s.transcribeError(msg, err)
 	}
 
-	x, _ := url.QueryUnescape(u.EscapedPath())
+	s.bot.Send(msg.Chat, fmt.Sprintf("Text: %s\n", text))
 
-	return filepath.Base(x)
+	return nil
 }
 
-func downloadFile(urlstr, filename string) error {
-	resp, err := http.Get(urlstr)
+func (s *Service) onVoice(msg domain.Message) error {
+	s.logger(msg).Info("voice received", "message", msg)
+
+	mode := s.settings.User(msg.Chat.UserID).VoiceMode
+
+	// Don't spend audio on a question that can't be answered.
+	if mode != VoiceModeText {
+		if err := s.checkQuota(msg, ResourceTokens); err != nil {
+			return err
+		}
+	}
+
+	text, err := s.transcribe(msg)
 
 	if err != nil {
-		return fmt.Errorf("http.Get error: %w", err)
+		return s.transcribeError(msg, err)
 	}
 
-	defer resp.Body.Close()
+	if mode == VoiceModeText {
+		s.bot.Send(msg.Chat, fmt.Sprintf("Text: %s\n", text))
+		return nil
+	}
 
-	w, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if mode == VoiceModeBoth {
+		s.bot.Send(msg.Chat, fmt.Sprintf("> %s", text))
+	}
+
+	return s.respond(msg, domain.ChatMessage{Role: domain.RoleUser, Content: text})
+}
+
+// transcribe downloads the media file of the message and recognizes its speech.
+func (s *Service) transcribe(msg domain.Message) (string, error) {
+	if len(msg.Attachments) == 0 {
+		return "", fmt.Errorf("%s message without attachment", msg.Kind)
+	}
+
+	if err := s.checkQuota(msg, ResourceAudio); err != nil {
+		return "", err
+	}
+
+	fileName, err := s.download(msg.Attachments[0])
 
 	if err != nil {
-		return fmt.Errorf("os.OpenFile error: %w", err)
+		return "", err
 	}
 
-	defer w.Close()
+	defer os.Remove(fileName)
 
-	if _, err := io.Copy(w, resp.Body); err != nil {
-		return fmt.Errorf("io.Copy error: %w", err)
+	isMP4, err := audio.IsMP4File(fileName)
+
+	if err != nil {
+		return "", fmt.Errorf("IsMP4File error: %w", err)
+	}
+
+	if isMP4 {
+		trackName := fileName + ".audio"
+
+		err := audio.ExtractFile(fileName, trackName)
+		defer os.Remove(trackName)
+
+		if err != nil {
+			return "", fmt.Errorf("ExtractFile error: %w", err)
+		}
+
+		fileName = trackName
+	}
+
+	s.bot.Send(msg.Chat, "Start recognize...")
+
+	text, err := s.speech.Recognize(fileName)
+
+	if err != nil {
+		return "", fmt.Errorf("Recognize error: %w", err)
+	}
+
+	s.record(msg, Spent{Requests: 1, AudioSeconds: s.audioSeconds(msg, fileName)})
+
+	if strings.TrimSpace(text) == "" {
+		return "", errNoSpeech
+	}
+
+	return text, nil
+}
+
+// audioSeconds is the audio length SaluteSpeech bills. Telegram reports it
+// for all media except audio sent as a document, then it is measured from the
+// file or, for formats without a known length, estimated from its size.
+func (s *Service) audioSeconds(msg domain.Message, fileName string) int {
+	length := msg.Attachments[0].Duration
+
+	if length == 0 {
+		measured, err := audio.FileDuration(fileName)
+
+		if err != nil {
+			s.logger(msg).Warn("failed to measure audio length, estimating it from the size", "err", err)
+			measured = estimatedDuration(fileName)
+		}
+
+		length = measured
+	}
+
+	return int(math.Ceil(length.Seconds()))
+}
+
+func estimatedDuration(fileName string) time.Duration {
+	info, err := os.Stat(fileName)
+
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(info.Size()) * time.Second / estimatedBytesPerSecond
+}
+
+// transcribeError tells the user about problems a retry won't fix and
+// passes everything else back to the queue.
+func (s *Service) transcribeError(msg domain.Message, err error) error {
+	switch {
+	case errors.Is(err, audio.ErrUnsupported):
+		reason := err.Error()
+		if i := strings.Index(reason, audio.ErrUnsupported.Error()); i >= 0 {
+			reason = reason[i:]
+		}
+
+		s.bot.Send(msg.Chat, fmt.Sprintf("Sorry, this file can't be recognized: %s.\nSupported formats: MP3, WAV (PCM 16 bit, A-law, mu-law), FLAC, Ogg Opus and MP4/M4A/MOV with AAC or Opus audio.", reason))
+	case errors.Is(err, errNoSpeech):
+		s.bot.Send(msg.Chat, "Sorry, I couldn't hear any speech")
+	default:
+		return err
 	}
 
 	return nil
 }
+
+func (s *Service) Send(msg domain.Message) error {
+	return s.queue.Push(msg)
+}
+
+// download saves the attachment to a temporary file, the caller removes it.
+func (s *Service) download(file domain.Attachment) (string, error) {
+	f, err := os.CreateTemp("", "gosberbot-*")
+
+	if err != nil {
+		return "", fmt.Errorf("os.CreateTemp error: %w", err)
+	}
+
+	f.Close()
+
+	if err := s.bot.Download(file, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("Download error: %w", err)
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/tools"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLive records what happens to a live message.
+type testLive struct {
+	ctx        context.Context
+	final      string
+	finished   bool
+	discarded  bool
+	discardErr error
+}
+
+func (l *testLive) Context() context.Context { return l.ctx }
+func (l *testLive) Update(text string)       {}
+
+func (l *testLive) Finish(text string) error {
+	l.final, l.finished = text, true
+	return nil
+}
+
+func (l *testLive) Discard() error {
+	l.discarded = l.discardErr == nil
+	return l.discardErr
+}
+
+type liveMessenger struct {
+	testMessenger
+	live *testLive
+}
+
+func (m *liveMessenger) Live(to domain.Message, placeholder string) (domain.LiveMessage, error) {
+	return m.live, nil
+}
+
+// testStreamer sends the deltas and then fails with err.
+type testStreamer struct {
+	deltas []string
+	usage  domain.TokenUsage
+	err    error
+}
+
+func (s testStreamer) Stream(ctx context.Context, messages []domain.ChatMessage, functions []domain.Function, onDelta func(text string)) (domain.Completion, error) {
+	var text strings.Builder
+
+	for _, delta := range s.deltas {
+		text.WriteString(delta)
+		onDelta(delta)
+	}
+
+	return domain.Completion{Text: text.String(), Model: "GigaChat", Usage: s.usage}, s.err
+}
+
+func TestStream(t *testing.T) {
+	failure := errors.New("connection reset")
+
+	tests := []struct {
+		name       string
+		streamer   testStreamer
+		discardErr error
+		err        bool
+		final      string
+		tokens     int
+		history    int
+	}{
+		{name: "answer", streamer: testStreamer{deltas: []string{"Hel", "lo"}, usage: domain.TokenUsage{PromptTokens: 5, CompletionTokens: 2}}, final: "Hello", tokens: 7, history: 2},
+		{name: "failure before the answer", streamer: testStreamer{err: failure}, err: true},
+		{name: "failure after usage", streamer: testStreamer{usage: domain.TokenUsage{PromptTokens: 5}, err: failure}, err: true, tokens: 5},
+		{name: "failure in the answer", streamer: testStreamer{deltas: []string{"Hel"}, usage: domain.TokenUsage{PromptTokens: 5, CompletionTokens: 1}, err: failure}, final: "Hel\n\n[interrupted]", tokens: 6},
+		{name: "failure with a live message left", streamer: testStreamer{err: failure}, discardErr: errors.New("too old"), final: "Sorry, failed to get the answer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			live := &testLive{ctx: context.Background(), discardErr: test.discardErr}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			s := &Service{
+				bot:     &liveMessenger{testMessenger: testMessenger{texts: map[int64][]string{}}, live: live},
+				access:  newTestAccess(t, AccessConfig{}),
+				usage:   newTestUsage(t, QuotaConfig{}, &now),
+				history: NewHistory(0, 0),
+				tools:   tools.NewRegistry(tools.Config{}, log),
+				log:     log,
+			}
+
+			msg := domain.Message{Kind: domain.KindText, Chat: domain.ChatRef{ChatID: testUser, UserID: testUser}, Text: "Hi"}
+			err := s.stream(msg, test.streamer, domain.ChatMessage{Role: domain.RoleUser, Content: msg.Text})
+
+			if (err != nil) != test.err {
+				t.Fatalf("stream() error = %v, want error %v", err, test.err)
+			}
+
+			// A retried failure leaves no message behind, any other ends the
+			// live one.
+			if test.err {
+				if !live.discarded || live.finished {
+					t.Fatalf("live message discarded %v, finished %v, want it discarded", live.discarded, live.finished)
+				}
+			} else if live.final != test.final {
+				t.Fatalf("final text = %q, want %q", live.final, test.final)
+			}
+
+			if _, month := s.usage.Totals(testUser); month.Tokens() != test.tokens {
+				t.Fatalf("recorded %d tokens, want %d", month.Tokens(), test.tokens)
+			}
+
+			if n := len(s.history.Messages(testUser)); n != test.history {
+				t.Fatalf("history has %d messages, want %d", n, test.history)
+			}
+		})
+	}
+}
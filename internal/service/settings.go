@@ -0,0 +1,95 @@
+package service
+
+import (
+	"gosberbot/internal/storage"
+	"sync"
+)
+
+const (
+	VoiceModeText   = "text"
+	VoiceModeAnswer = "answer"
+	VoiceModeBoth   = "both"
+)
+
+type UserSettings struct {
+	VoiceMode string `json:"voice_mode,omitempty"`
+}
+
+type ChatSettings struct {
+	VoiceReplies bool   `json:"voice_replies,omitempty"`
+	Voice        string `json:"voice,omitempty"`
+	// Model is the chat model chosen for the chat, empty for the default.
+	Model string `json:"model,omitempty"`
+}
+
+type settingsFile struct {
+	Users map[int64]UserSettings `json:"users"`
+	Chats map[int64]ChatSettings `json:"chats"`
+}
+
+// Settings keeps user preferences and saves them to disk on every change.
+type Settings struct {
+	mu   sync.Mutex
+	path string
+	data settingsFile
+}
+
+func NewSettings(path string) (*Settings, error) {
+	s := &Settings{path: path}
+
+	if err := storage.LoadJSON(path, &s.data); err != nil {
+		return nil, err
+	}
+
+	if s.data.Users == nil {
+		s.data.Users = make(map[int64]UserSettings)
+	}
+
+	if s.data.Chats == nil {
+		s.data.Chats = make(map[int64]ChatSettings)
+	}
+
+	return s, nil
+}
+
+func (s *Settings) User(userID int64) UserSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.data.Users[userID]
+
+	if settings.VoiceMode == "" {
+		settings.VoiceMode = VoiceModeText
+	}
+
+	return settings
+}
+
+func (s *Settings) UpdateUser(userID int64, update func(*UserSettings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.data.Users[userID]
+	update(&settings)
+	s.data.Users[userID] = settings
+
+	return storage.SaveJSON(s.path, s.data)
+}
+
+func (s *Settings) Chat(chatID int64) ChatSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.Chats[chatID]
+}
+
+func (s *Settings) UpdateChat(chatID int64, update func(*ChatSettings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.data.Chats[chatID]
+	update(&settings)
+	s.data.Chats[chatID] = settings
+
+	return storage.SaveJSON(s.path, s.data)
+}
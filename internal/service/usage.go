@@ -0,0 +1,298 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gosberbot/internal/domain"
+	"gosberbot/internal/storage"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ResourceTokens = "token"
+	ResourceAudio  = "audio"
+
+	PeriodDay   = "daily"
+	PeriodMonth = "monthly"
+)
+
+// QuotaConfig limits what a single user may spend. Zero means no limit.
+type QuotaConfig struct {
+	DailyTokens         int `yaml:"daily_tokens"`
+	MonthlyTokens       int `yaml:"monthly_tokens"`
+	DailyAudioSeconds   int `yaml:"daily_audio_seconds"`
+	MonthlyAudioSeconds int `yaml:"monthly_audio_seconds"`
+}
+
+type UsageConfig struct {
+	File string `yaml:"file"`
+	// RetentionDays is how long daily records are kept for reports.
+	RetentionDays int         `yaml:"retention_days"`
+	Quota         QuotaConfig `yaml:"quota"`
+}
+
+func (c UsageConfig) validate() error {
+	var errs []error
+
+	if c.File == "" {
+		errs = append(errs, errors.New("usage.file is required"))
+	}
+
+	if c.RetentionDays < 31 {
+		errs = append(errs, errors.New("usage.retention_days must be at least 31 to cover a month"))
+	}
+
+	q := c.Quota
+	if q.DailyTokens < 0 || q.MonthlyTokens < 0 || q.DailyAudioSeconds < 0 || q.MonthlyAudioSeconds < 0 {
+		errs = append(errs, errors.New("usage.quota limits must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Spent is what a user used up in some period.
+type Spent struct {
+	Requests         int `json:"requests,omitempty"`
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	AudioSeconds     int `json:"audio_seconds,omitempty"`
+	// Models splits the tokens of chat completions by the model that
+	// answered.
+	Models map[string]int `json:"models,omitempty"`
+}
+
+func (s Spent) Tokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+func (s *Spent) add(o Spent) {
+	s.Requests += o.Requests
+	s.PromptTokens += o.PromptTokens
+	s.CompletionTokens += o.CompletionTokens
+	s.AudioSeconds += o.AudioSeconds
+
+	for model, tokens := range o.Models {
+		if s.Models == nil {
+			s.Models = make(map[string]int)
+		}
+
+		s.Models[model] += tokens
+	}
+}
+
+func (s Spent) String() string {
+	text := fmt.Sprintf("%d requests, %d tokens (%d prompt, %d completion), %d s of audio",
+		s.Requests, s.Tokens(), s.PromptTokens, s.CompletionTokens, s.AudioSeconds)
+
+	if len(s.Models) == 0 {
+		return text
+	}
+
+	models := make([]string, 0, len(s.Models))
+	for _, model := range slices.Sorted(maps.Keys(s.Models)) {
+		models = append(models, fmt.Sprintf("%s %d", model, s.Models[model]))
+	}
+
+	return text + "; tokens by model: " + strings.Join(models, ", ")
+}
+
+// completionSpent is the usage of a request answered by the model.
+func completionSpent(model string, usage domain.TokenUsage) Spent {
+	spent := Spent{Requests: 1, PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens}
+
+	if model != "" && usage.Total() > 0 {
+		spent.Models = map[string]int{model: usage.Total()}
+	}
+
+	return spent
+}
+
+// embeddingSpent is the usage of embedding texts, which is a part of a
+// request rather than one.
+func embeddingSpent(model string, usage domain.TokenUsage) Spent {
+	spent := completionSpent(model, usage)
+	spent.Requests = 0
+
+	return spent
+}
+
+// QuotaError is returned when a user has used up a quota. The service tells
+// the user instead of retrying the message.
+type QuotaError struct {
+	Resource string
+	Period   string
+	// RenewsIn is the time left until the period ends.
+	RenewsIn time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s quota exceeded", e.Period, e.Resource)
+}
+
+func (e *QuotaError) Notice() string {
+	return fmt.Sprintf("Your %s %s quota is used up, it renews in %s. Send /usage for details.", e.Period, e.Resource, durationText(e.RenewsIn))
+}
+
+type usageFile struct {
+	// Users maps user IDs to daily totals keyed by date.
+	Users map[int64]map[string]Spent `json:"users"`
+}
+
+// Usage keeps per-user daily totals of tokens and recognized audio and
+// enforces the quotas. The check happens before a request, so the request
+// that crosses a limit still goes through.
+type Usage struct {
+	cfg UsageConfig
+
+	mu   sync.Mutex
+	data usageFile
+	now  func() time.Time
+}
+
+func NewUsage(cfg UsageConfig) (*Usage, error) {
+	u := &Usage{cfg: cfg, now: time.Now}
+
+	if err := storage.LoadJSON(cfg.File, &u.data); err != nil {
+		return nil, err
+	}
+
+	if u.data.Users == nil {
+		u.data.Users = make(map[int64]map[string]Spent)
+	}
+
+	return u, nil
+}
+
+func (u *Usage) Quota() QuotaConfig {
+	return u.cfg.Quota
+}
+
+// Record adds spent to today's total of the user and drops expired days.
+func (u *Usage) Record(userID int64, spent Spent) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	day := now.Format(time.DateOnly)
+
+	days := u.data.Users[userID]
+	if days == nil {
+		days = make(map[string]Spent)
+		u.data.Users[userID] = days
+	}
+
+	total := days[day]
+	total.add(spent)
+	days[day] = total
+
+	u.prune(now)
+
+	return storage.SaveJSON(u.cfg.File, u.data)
+}
+
+// Totals returns what the user spent today and this month.
+func (u *Usage) Totals(userID int64) (day, month Spent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	today := now.Format(time.DateOnly)
+	prefix := now.Format("2006-01-")
+
+	for date, spent := range u.data.Users[userID] {
+		if strings.HasPrefix(date, prefix) {
+			month.add(spent)
+		}
+
+		if date == today {
+			day.add(spent)
+		}
+	}
+
+	return day, month
+}
+
+// Check fails with a QuotaError when the user has no budget left for the
+// resource.
+func (u *Usage) Check(userID int64, resource string) error {
+	day, month := u.Totals(userID)
+	q := u.cfg.Quota
+
+	dayUsed, monthUsed := day.Tokens(), month.Tokens()
+	dayLimit, monthLimit := q.DailyTokens, q.MonthlyTokens
+
+	if resource == ResourceAudio {
+		dayUsed, monthUsed = day.AudioSeconds, month.AudioSeconds
+		dayLimit, monthLimit = q.DailyAudioSeconds, q.MonthlyAudioSeconds
+	}
+
+	now := u.now()
+
+	if monthLimit > 0 && monthUsed >= monthLimit {
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return &QuotaError{Resource: resource, Period: PeriodMonth, RenewsIn: first.AddDate(0, 1, 0).Sub(now)}
+	}
+
+	if dayLimit > 0 && dayUsed >= dayLimit {
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return &QuotaError{Resource: resource, Period: PeriodDay, RenewsIn: midnight.AddDate(0, 0, 1).Sub(now)}
+	}
+
+	return nil
+}
+
+// Report returns the totals of every user for the month, given as "2006-01".
+func (u *Usage) Report(month string) map[int64]Spent {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	report := make(map[int64]Spent)
+	prefix := month + "-"
+
+	for userID, days := range u.data.Users {
+		var total Spent
+
+		for date, spent := range days {
+			if strings.HasPrefix(date, prefix) {
+				total.add(spent)
+			}
+		}
+
+		if total.Requests > 0 || total.Tokens() > 0 || total.AudioSeconds > 0 {
+			report[userID] = total
+		}
+	}
+
+	return report
+}
+
+// prune drops the days older than the retention.
+func (u *Usage) prune(now time.Time) {
+	oldest := now.AddDate(0, 0, -u.cfg.RetentionDays).Format(time.DateOnly)
+
+	for userID, days := range u.data.Users {
+		for date := range days {
+			if date < oldest {
+				delete(days, date)
+			}
+		}
+
+		if len(days) == 0 {
+			delete(u.data.Users, userID)
+		}
+	}
+}
+
+func durationText(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
+
+	d = d.Round(time.Minute)
+
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"errors"
+	"gosberbot/internal/domain"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestUsage returns a Usage whose clock reads *now.
+func newTestUsage(t *testing.T, quota QuotaConfig, now *time.Time) *Usage {
+	t.Helper()
+
+	u, err := NewUsage(UsageConfig{File: filepath.Join(t.TempDir(), "usage.json"), RetentionDays: 40, Quota: quota})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u.now = func() time.Time { return *now }
+
+	return u
+}
+
+func TestUsageCheck(t *testing.T) {
+	quota := QuotaConfig{DailyTokens: 100, MonthlyTokens: 250, DailyAudioSeconds: 60, MonthlyAudioSeconds: 600}
+	now := time.Date(2024, 1, 31, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		quota    QuotaConfig
+		today    Spent
+		earlier  Spent
+		resource string
+		period   string
+		renewsIn time.Duration
+	}{
+		{name: "nothing spent", quota: quota, resource: ResourceTokens},
+		{name: "below daily tokens", quota: quota, today: Spent{PromptTokens: 60, CompletionTokens: 39}, resource: ResourceTokens},
+		{name: "at daily tokens", quota: quota, today: Spent{PromptTokens: 60, CompletionTokens: 40}, resource: ResourceTokens, period: PeriodDay, renewsIn: 90 * time.Minute},
+		{name: "below monthly tokens", quota: quota, today: Spent{PromptTokens: 50}, earlier: Spent{PromptTokens: 199}, resource: ResourceTokens},
+		{name: "at monthly tokens", quota: quota, today: Spent{PromptTokens: 50}, earlier: Spent{PromptTokens: 200}, resource: ResourceTokens, period: PeriodMonth, renewsIn: 90 * time.Minute},
+		{name: "monthly before daily", quota: quota, today: Spent{PromptTokens: 100}, earlier: Spent{PromptTokens: 150}, resource: ResourceTokens, period: PeriodMonth, renewsIn: 90 * time.Minute},
+		{name: "tokens don't count as audio", quota: quota, today: Spent{PromptTokens: 1000}, resource: ResourceAudio},
+		{name: "at daily audio", quota: quota, today: Spent{AudioSeconds: 60}, resource: ResourceAudio, period: PeriodDay, renewsIn: 90 * time.Minute},
+		{name: "at monthly audio", quota: quota, earlier: Spent{AudioSeconds: 600}, resource: ResourceAudio, period: PeriodMonth, renewsIn: 90 * time.Minute},
+		{name: "no limits", today: Spent{PromptTokens: 1000, AudioSeconds: 1000}, resource: ResourceTokens},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := now.AddDate(0, 0, -10)
+			u := newTestUsage(t, test.quota, &clock)
+
+			if err := u.Record(testUser, test.earlier); err != nil {
+				t.Fatal(err)
+			}
+
+			clock = now
+
+			if err := u.Record(testUser, test.today); err != nil {
+				t.Fatal(err)
+			}
+
+			err := u.Check(testUser, test.resource)
+
+			if test.period == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v, want nil", err)
+				}
+
+				return
+			}
+
+			var quotaErr *QuotaError
+
+			if !errors.As(err, &quotaErr) {
+				t.Fatalf("Check() error = %v, want a QuotaError", err)
+			}
+
+			want := QuotaError{Resource: test.resource, Period: test.period, RenewsIn: test.renewsIn}
+
+			if *quotaErr != want {
+				t.Fatalf("Check() error = %+v, want %+v", *quotaErr, want)
+			}
+
+			// Other users have their own budget.
+			if err := u.Check(testStored, test.resource); err != nil {
+				t.Fatalf("Check() of another user error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestUsageRollover(t *testing.T) {
+	now := time.Date(2024, 1, 30, 23, 0, 0, 0, time.UTC)
+	u := newTestUsage(t, QuotaConfig{DailyTokens: 100, MonthlyTokens: 150}, &now)
+
+	check := func(period string) {
+		t.Helper()
+
+		var quotaErr *QuotaError
+
+		if err := u.Check(testUser, ResourceTokens); period == "" && err != nil {
+			t.Fatalf("%s: Check() error = %v, want nil", now, err)
+		} else if period != "" && (!errors.As(err, &quotaErr) || quotaErr.Period != period) {
+			t.Fatalf("%s: Check() error = %v, want the %s quota", now, err, period)
+		}
+	}
+
+	if err := u.Record(testUser, Spent{Requests: 1, PromptTokens: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	check(PeriodDay)
+
+	// The next day has a fresh daily budget.
+	now = now.Add(2 * time.Hour)
+	check("")
+
+	if day, month := u.Totals(testUser); day.Tokens() != 0 || month.Tokens() != 100 {
+		t.Fatalf("Totals() = %d, %d tokens, want 0 and 100", day.Tokens(), month.Tokens())
+	}
+
+	if err := u.Record(testUser, Spent{Requests: 1, PromptTokens: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	check(PeriodMonth)
+
+	// The next month has a fresh monthly budget.
+	now = time.Date(2024, 2, 1, 0, 0, 1, 0, time.UTC)
+	check("")
+
+	if day, month := u.Totals(testUser); day.Tokens() != 0 || month.Tokens() != 0 {
+		t.Fatalf("Totals() = %d, %d tokens, want 0 and 0", day.Tokens(), month.Tokens())
+	}
+}
+
+func TestUsageReport(t *testing.T) {
+	now := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	u := newTestUsage(t, QuotaConfig{}, &now)
+
+	tokenUsage := func(prompt, completion int) domain.TokenUsage {
+		return domain.TokenUsage{PromptTokens: prompt, CompletionTokens: completion}
+	}
+
+	records := []struct {
+		date   time.Time
+		userID int64
+		spent  Spent
+	}{
+		{date: now, userID: testUser, spent: completionSpent("GigaChat", tokenUsage(10, 5))},
+		{date: now, userID: testUser, spent: Spent{AudioSeconds: 30}},
+		{date: now, userID: testUser, spent: embeddingSpent("Embeddings", tokenUsage(7, 0))},
+		{date: now.AddDate(0, 0, 10), userID: testUser, spent: completionSpent("GigaChat-Pro", tokenUsage(20, 10))},
+		{date: now.AddDate(0, 0, 10), userID: testStored, spent: completionSpent("GigaChat", tokenUsage(1, 1))},
+		{date: now.AddDate(0, 1, 0), userID: testUser, spent: completionSpent("GigaChat", tokenUsage(100, 100))},
+		{date: now.AddDate(0, 1, 0), userID: testAdmin, spent: Spent{AudioSeconds: 5}},
+	}
+
+	for _, r := range records {
+		now = r.date
+
+		if err := u.Record(r.userID, r.spent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		month  string
+		report map[int64]Spent
+	}{
+		{
+			month: "2024-01",
+			report: map[int64]Spent{
+				testUser:   {Requests: 2, PromptTokens: 37, CompletionTokens: 15, AudioSeconds: 30, Models: map[string]int{"Embeddings": 7, "GigaChat": 15, "GigaChat-Pro": 30}},
+				testStored: {Requests: 1, PromptTokens: 1, CompletionTokens: 1, Models: map[string]int{"GigaChat": 2}},
+			},
+		},
+		{
+			month: "2024-02",
+			report: map[int64]Spent{
+				testUser:  {Requests: 1, PromptTokens: 100, CompletionTokens: 100, Models: map[string]int{"GigaChat": 200}},
+				testAdmin: {AudioSeconds: 5},
+			},
+		},
+		{month: "2023-12", report: map[int64]Spent{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.month, func(t *testing.T) {
+			if report := u.Report(test.month); !reflect.DeepEqual(report, test.report) {
+				t.Fatalf("Report(%s) = %+v, want %+v", test.month, report, test.report)
+			}
+		})
+	}
+
+	// The totals survive a restart, and days past the retention are dropped
+	// with the next record.
+	reloaded, err := NewUsage(u.cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded.now = func() time.Time { return now.AddDate(0, 0, 40) }
+
+	if err := reloaded.Record(testAdmin, Spent{Requests: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if report := reloaded.Report("2024-01"); len(report) != 0 {
+		t.Fatalf("Report(2024-01) after the retention = %+v, want none", report)
+	}
+
+	if report := reloaded.Report("2024-02"); !reflect.DeepEqual(report, tests[1].report) {
+		t.Fatalf("Report(2024-02) after a restart = %+v, want %+v", report, tests[1].report)
+	}
+}
@@ -0,0 +1,334 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var calculatorParameters = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"expression": {
+			"type": "string",
+			"description": "Arithmetic expression, e.g. (2 + 3) * 4 ^ 2 / sqrt(16). Supports + - * / % ^, parentheses, pi, e and the functions sqrt, abs, exp, ln, log10, log2, sin, cos, tan, floor, ceil, round, min, max"
+		}
+	},
+	"required": ["expression"]
+}`)
+
+var calculatorFuncs = map[string]func(args []float64) (float64, error){
+	"sqrt":  unary(math.Sqrt),
+	"abs":   unary(math.Abs),
+	"exp":   unary(math.Exp),
+	"ln":    unary(math.Log),
+	"log10": unary(math.Log10),
+	"log2":  unary(math.Log2),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"min":   binary(math.Min),
+	"max":   binary(math.Max),
+}
+
+// Calculator evaluates arithmetic expressions, which models get wrong when
+// they do it in their head.
+func Calculator() Tool {
+	return Tool{
+		Name:        "calculator",
+		Description: "Evaluates an arithmetic expression exactly. Use it for any calculation instead of computing the result yourself.",
+		Parameters:  calculatorParameters,
+		Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+			var req struct {
+				Expression string `json:"expression"`
+			}
+
+			if err := decode(args, &req); err != nil {
+				return nil, err
+			}
+
+			value, err := Evaluate(req.Expression)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]any{"expression": req.Expression, "result": value}, nil
+		},
+	}
+}
+
+// Evaluate computes an arithmetic expression.
+func Evaluate(expression string) (float64, error) {
+	p := &calcParser{input: expression}
+
+	value, err := p.expr()
+
+	if err == nil && p.peek() != 0 {
+		err = fmt.Errorf("unexpected %q at %d", p.peek(), p.pos+1)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("the result is not a finite number")
+	}
+
+	return value, nil
+}
+
+// calcParser is a recursive descent parser, lowest precedence first:
+//
+//	expr    = term {("+" | "-") term}
+//	term    = unary {("*" | "/" | "%") unary}
+//	unary   = ("-" | "+") unary | power
+//	power   = primary ["^" unary]
+//	primary = number | name | name "(" expr {"," expr} ")" | "(" expr ")"
+type calcParser struct {
+	input string
+	pos   int
+}
+
+// peek skips spaces and returns the next byte, 0 at the end.
+func (p *calcParser) peek() byte {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+
+	if p.pos == len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *calcParser) expr() (float64, error) {
+	x, err := p.term()
+
+	for err == nil {
+		op := p.peek()
+
+		if op != '+' && op != '-' {
+			break
+		}
+
+		p.pos++
+
+		var y float64
+		if y, err = p.term(); op == '+' {
+			x += y
+		} else {
+			x -= y
+		}
+	}
+
+	return x, err
+}
+
+func (p *calcParser) term() (float64, error) {
+	x, err := p.unary()
+
+	for err == nil {
+		op := p.peek()
+
+		if op != '*' && op != '/' && op != '%' || strings.HasPrefix(p.input[p.pos:], "**") {
+			break
+		}
+
+		p.pos++
+
+		var y float64
+		if y, err = p.unary(); err != nil {
+			break
+		}
+
+		if op != '*' && y == 0 {
+			return 0, errors.New("division by zero")
+		}
+
+		switch op {
+		case '*':
+			x *= y
+		case '/':
+			x /= y
+		case '%':
+			x = math.Mod(x, y)
+		}
+	}
+
+	return x, err
+}
+
+func (p *calcParser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		x, err := p.unary()
+		return -x, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+
+	return p.power()
+}
+
+func (p *calcParser) power() (float64, error) {
+	x, err := p.primary()
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case p.peek() == '^':
+		p.pos++
+	case strings.HasPrefix(p.input[p.pos:], "**"):
+		p.pos += 2
+	default:
+		return x, nil
+	}
+
+	y, err := p.unary()
+
+	return math.Pow(x, y), err
+}
+
+func (p *calcParser) primary() (float64, error) {
+	c := p.peek()
+
+	switch {
+	case c == '(':
+		p.pos++
+		x, err := p.expr()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if p.peek() != ')' {
+			return 0, errors.New("missing )")
+		}
+
+		p.pos++
+
+		return x, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+
+		for p.pos < len(p.input) && strings.IndexByte("0123456789.eE", p.input[p.pos]) >= 0 {
+			// An exponent sign belongs to the number.
+			if p.input[p.pos] == 'e' || p.input[p.pos] == 'E' {
+				if p.pos+1 < len(p.input) && (p.input[p.pos+1] == '-' || p.input[p.pos+1] == '+') {
+					p.pos++
+				}
+			}
+
+			p.pos++
+		}
+
+		x, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+
+		if err != nil {
+			return 0, fmt.Errorf("bad number %q", p.input[start:p.pos])
+		}
+
+		return x, nil
+	case unicode.IsLetter(rune(c)):
+		start := p.pos
+
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+
+		return p.name(strings.ToLower(p.input[start:p.pos]))
+	case c == 0:
+		return 0, errors.New("unexpected end of expression")
+	}
+
+	return 0, fmt.Errorf("unexpected %q at %d", c, p.pos+1)
+}
+
+// name evaluates a constant or a function call.
+func (p *calcParser) name(name string) (float64, error) {
+	if p.peek() != '(' {
+		switch name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+
+		return 0, fmt.Errorf("unknown name %s", name)
+	}
+
+	fn, ok := calculatorFuncs[name]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown function %s", name)
+	}
+
+	p.pos++
+
+	var args []float64
+
+	for {
+		x, err := p.expr()
+
+		if err != nil {
+			return 0, err
+		}
+
+		args = append(args, x)
+
+		if p.peek() != ',' {
+			break
+		}
+
+		p.pos++
+	}
+
+	if p.peek() != ')' {
+		return 0, errors.New("missing )")
+	}
+
+	p.pos++
+
+	x, err := fn(args)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return x, nil
+}
+
+func unary(fn func(float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, errors.New("expects one argument")
+		}
+
+		return fn(args[0]), nil
+	}
+}
+
+func binary(fn func(float64, float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 2 {
+			return 0, errors.New("expects two arguments")
+		}
+
+		return fn(args[0], args[1]), nil
+	}
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"10 - 4 - 3", 3},
+		{"24 / 4 / 3", 2},
+		{"7 % 4 + 1", 4},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 ** 3", 8},
+		{"2 * 3 ^ 2", 18},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"2 ^ -1", 0.5},
+		{"--3", 3},
+		{"-+-3", 3},
+		{"2 * -3", -6},
+		{"1 - -1", 2},
+		{"1.5e3 + 2E-1", 1500.2},
+		{".5 * 4", 2},
+		{"sqrt(16) + abs(-2)", 6},
+		{"max(1, min(5, 3)) * 2", 6},
+		{"ROUND(2.5)", 3},
+		{"floor(pi)", 3},
+		{"ln(e)", 1},
+		{"\t1 +\t1 ", 2},
+		{strings.Repeat("(", 1000) + "1 + 1" + strings.Repeat(")", 1000), 2},
+		{strings.Repeat("-", 1001) + "1", -1},
+	}
+
+	for _, test := range tests {
+		name := test.expression
+
+		if len(name) > 20 {
+			name = name[:20] + "..."
+		}
+
+		t.Run(name, func(t *testing.T) {
+			got, err := Evaluate(test.expression)
+
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Fatalf("Evaluate() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 / 0", "division by zero"},
+		{"5 % (2 - 2)", "division by zero"},
+		{"0 / 0", "division by zero"},
+		{"", "unexpected end of expression"},
+		{"2 +", "unexpected end of expression"},
+		{"(1 + 2", "missing )"},
+		{"max(1, 2", "missing )"},
+		{"1 + 2)", `unexpected ')' at 6`},
+		{"1 2", `unexpected '2' at 3`},
+		{"2 * )", `unexpected ')' at 5`},
+		{"1..2", `bad number "1..2"`},
+		{"1e", `bad number "1e"`},
+		{"x + 1", "unknown name x"},
+		{"foo(1)", "unknown function foo"},
+		{"sqrt(1, 2)", "sqrt: expects one argument"},
+		{"max(1)", "max: expects two arguments"},
+		{"sqrt(-1)", "not a finite number"},
+		{"10 ^ 400", "not a finite number"},
+		{"$5", `unexpected '$' at 1`},
+		{strings.Repeat("(", 1000) + "1", "missing )"},
+	}
+
+	for _, test := range tests {
+		name := test.expression
+
+		if len(name) > 20 {
+			name = name[:20] + "..."
+		}
+
+		t.Run(name, func(t *testing.T) {
+			got, err := Evaluate(test.expression)
+
+			if err == nil {
+				t.Fatalf("Evaluate() = %v, want an error", got)
+			}
+
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Evaluate() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gosberbot/internal/domain"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// builtins are the tools that can be turned on by name in the config.
+var builtins = map[string]func() Tool{
+	"calculator": Calculator,
+	"timezone":   TimeZone,
+}
+
+type Config struct {
+	// Enabled lists the built-in tools offered to the chat model.
+	Enabled []string `yaml:"enabled"`
+	// MaxCalls is how many tool calls one answer may make, the model is
+	// asked for plain text after that.
+	MaxCalls int           `yaml:"max_calls"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:  []string{"calculator", "timezone"},
+		MaxCalls: 5,
+		Timeout:  10 * time.Second,
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	for _, name := range c.Enabled {
+		if _, ok := builtins[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown tool %q", name))
+		}
+	}
+
+	if c.MaxCalls < 1 {
+		errs = append(errs, errors.New("max_calls must be positive"))
+	}
+
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("timeout must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Handler runs the tool with the arguments chosen by the model. The result
+// is sent back to the model as JSON.
+type Handler func(ctx context.Context, args json.RawMessage) (any, error)
+
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters json.RawMessage
+	Handler    Handler
+}
+
+// Registry holds the tools the chat model may call.
+type Registry struct {
+	cfg   Config
+	tools map[string]Tool
+	names []string
+	log   *slog.Logger
+}
+
+// NewRegistry returns a registry with the enabled built-in tools.
+func NewRegistry(cfg Config, log *slog.Logger) *Registry {
+	r := &Registry{cfg: cfg, tools: make(map[string]Tool), log: log}
+
+	for _, name := range cfg.Enabled {
+		if tool, ok := builtins[name]; ok {
+			r.Register(tool())
+		}
+	}
+
+	return r
+}
+
+// Register adds the tool. Registering a name twice is a programming error.
+func (r *Registry) Register(tool Tool) {
+	if _, ok := r.tools[tool.Name]; ok {
+		panic("tools: duplicate tool " + tool.Name)
+	}
+
+	r.tools[tool.Name] = tool
+	r.names = append(r.names, tool.Name)
+}
+
+func (r *Registry) MaxCalls() int {
+	return r.cfg.MaxCalls
+}
+
+// Functions describes the tools to the chat model in registration order.
+func (r *Registry) Functions() []domain.Function {
+	functions := make([]domain.Function, 0, len(r.names))
+
+	for _, name := range r.names {
+		tool := r.tools[name]
+		functions = append(functions, domain.Function{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters})
+	}
+
+	return functions
+}
+
+func (r *Registry) Names() []string {
+	return slices.Clone(r.names)
+}
+
+// Call runs the tool and returns its result as a JSON object. Failures are
+// returned as {"error": "..."} so the model can tell the user or try again.
+func (r *Registry) Call(ctx context.Context, call domain.FunctionCall) string {
+	tool, ok := r.tools[call.Name]
+
+	if !ok {
+		return errorResult(fmt.Errorf("unknown function %s", call.Name))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	res, err := tool.Handler(ctx, call.Arguments)
+
+	r.log.Debug("tool called", "tool", call.Name, "duration", time.Since(start), "err", err)
+
+	if err != nil {
+		return errorResult(err)
+	}
+
+	data, err := json.Marshal(res)
+
+	if err != nil {
+		return errorResult(fmt.Errorf("failed to marshal result: %w", err))
+	}
+
+	// Models expect an object, wrap plain values.
+	if len(data) == 0 || data[0] != '{' {
+		data, _ = json.Marshal(map[string]json.RawMessage{"result": data})
+	}
+
+	return string(data)
+}
+
+func errorResult(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// decode unmarshals the tool arguments, which some models send as a JSON
+// string holding the object.
+func decode(args json.RawMessage, v any) error {
+	var s string
+
+	if json.Unmarshal(args, &s) == nil {
+		args = json.RawMessage(s)
+	}
+
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("bad arguments: %w", err)
+	}
+
+	return nil
+}
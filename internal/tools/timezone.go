@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// The bot may run in a container without the system zone database.
+	_ "time/tzdata"
+)
+
+var timeZoneParameters = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"time": {
+			"type": "string",
+			"description": "Time to convert as YYYY-MM-DD HH:MM or HH:MM for today, empty for now"
+		},
+		"from": {
+			"type": "string",
+			"description": "IANA time zone of the given time, e.g. Europe/Moscow, or UTC"
+		},
+		"to": {
+			"type": "string",
+			"description": "IANA time zone to convert to, e.g. Asia/Tokyo"
+		}
+	},
+	"required": ["from", "to"]
+}`)
+
+// timeLayouts are the accepted forms of the time argument.
+var timeLayouts = []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+// TimeZone converts time between time zones and tells the current time in a
+// zone, which the model can't know.
+func TimeZone() Tool {
+	return Tool{
+		Name:        "timezone",
+		Description: "Converts a time from one time zone to another. Without a time it gives the current time in both zones.",
+		Parameters:  timeZoneParameters,
+		Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+			var req struct {
+				Time string `json:"time"`
+				From string `json:"from"`
+				To   string `json:"to"`
+			}
+
+			if err := decode(args, &req); err != nil {
+				return nil, err
+			}
+
+			from, err := time.LoadLocation(req.From)
+
+			if err != nil {
+				return nil, fmt.Errorf("unknown time zone %q", req.From)
+			}
+
+			to, err := time.LoadLocation(req.To)
+
+			if err != nil {
+				return nil, fmt.Errorf("unknown time zone %q", req.To)
+			}
+
+			t, err := parseTime(req.Time, time.Now().In(from))
+
+			if err != nil {
+				return nil, err
+			}
+
+			const layout = "2006-01-02 15:04 MST (-07:00)"
+
+			return map[string]string{
+				"from": t.Format(layout),
+				"to":   t.In(to).Format(layout),
+			}, nil
+		},
+	}
+}
+
+// parseTime reads the time in the zone of now. An empty string is now and a
+// bare HH:MM is that time today.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now, nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("can't read time %q, use YYYY-MM-DD HH:MM", s)
+}
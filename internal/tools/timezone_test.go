@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 3, 10, 22, 15, 30, 0, moscow)
+
+	tests := []struct {
+		name  string
+		input string
+		want  time.Time
+		err   bool
+	}{
+		{name: "now", input: "", want: now},
+		{name: "today", input: "09:30", want: time.Date(2024, 3, 10, 9, 30, 0, 0, moscow)},
+		{name: "date", input: "2024-01-15 12:00", want: time.Date(2024, 1, 15, 12, 0, 0, 0, moscow)},
+		{name: "date with T", input: "2024-01-15T12:00", want: time.Date(2024, 1, 15, 12, 0, 0, 0, moscow)},
+		{name: "seconds", input: "2024-01-15 12:00:45", want: time.Date(2024, 1, 15, 12, 0, 45, 0, moscow)},
+		{name: "own offset", input: "2024-01-15T12:00:00Z", want: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{name: "bad hour", input: "25:00", err: true},
+		{name: "words", input: "tomorrow noon", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTime(test.input, now)
+
+			if (err != nil) != test.err {
+				t.Fatalf("parseTime() error = %v, want error %v", err, test.err)
+			}
+
+			if !got.Equal(test.want) {
+				t.Fatalf("parseTime() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want map[string]string
+		err  string
+	}{
+		{
+			name: "convert",
+			args: `{"time":"2024-01-15 12:00","from":"Europe/Moscow","to":"Asia/Tokyo"}`,
+			want: map[string]string{"from": "2024-01-15 12:00 MSK (+03:00)", "to": "2024-01-15 18:00 JST (+09:00)"},
+		},
+		{
+			name: "summer time",
+			args: `{"time":"2024-07-01 20:30","from":"UTC","to":"America/New_York"}`,
+			want: map[string]string{"from": "2024-07-01 20:30 UTC (+00:00)", "to": "2024-07-01 16:30 EDT (-04:00)"},
+		},
+		{name: "unknown from", args: `{"from":"Mars/Olympus","to":"UTC"}`, err: `unknown time zone "Mars/Olympus"`},
+		{name: "unknown to", args: `{"from":"UTC","to":"Moscow"}`, err: `unknown time zone "Moscow"`},
+		{name: "bad time", args: `{"time":"noon","from":"UTC","to":"UTC"}`, err: `can't read time "noon"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := TimeZone().Handler(context.Background(), json.RawMessage(test.args))
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Handler() error = %v, want %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Handler() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Handler() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package vector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLineSize bounds one record in a collection file.
+const maxLineSize = 16 << 20
+
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Record is a piece of a source document with its embedding.
+type Record struct {
+	Source string    `json:"source"`
+	Chunk  int       `json:"chunk"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+	Added  time.Time `json:"added"`
+}
+
+type Match struct {
+	Record
+	// Score is the cosine similarity to the query, 1 is the same direction.
+	Score float32
+}
+
+type Source struct {
+	Name   string
+	Chunks int
+	Added  time.Time
+}
+
+// Store keeps collections of records on disk, one JSON lines file each, and
+// searches them by cosine similarity. A collection is read into memory on
+// first use; vectors are kept normalized so a dot product is the cosine.
+type Store struct {
+	dir string
+
+	mu          sync.RWMutex
+	collections map[string][]Record
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	return &Store{dir: dir, collections: make(map[string][]Record)}, nil
+}
+
+// Put stores the records of the source, replacing the ones it had.
+func (s *Store) Put(collection, source string, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.load(collection)
+
+	if err != nil {
+		return err
+	}
+
+	added := make([]Record, 0, len(records))
+
+	for _, r := range records {
+		r.Source = source
+		r.Vector = normalize(r.Vector)
+		added = append(added, r)
+	}
+
+	if !slices.ContainsFunc(current, func(r Record) bool { return r.Source == source }) {
+		if err := s.append(collection, added); err != nil {
+			return err
+		}
+
+		s.collections[collection] = append(current, added...)
+
+		return nil
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(current), func(r Record) bool { return r.Source == source })
+
+	return s.rewrite(collection, append(kept, added...))
+}
+
+// Delete removes the records of the source and returns how many there were.
+func (s *Store) Delete(collection, source string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.load(collection)
+
+	if err != nil {
+		return 0, err
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(current), func(r Record) bool { return r.Source == source })
+
+	if len(kept) == len(current) {
+		return 0, nil
+	}
+
+	return len(current) - len(kept), s.rewrite(collection, kept)
+}
+
+// Search returns up to k records closest to the query, best first.
+// Records of another dimension are skipped.
+func (s *Store) Search(collection string, query []float32, k int) ([]Match, error) {
+	records, err := s.records(collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query = normalize(query)
+	matches := make([]Match, 0, len(records))
+
+	for _, r := range records {
+		if len(r.Vector) != len(query) {
+			continue
+		}
+
+		var dot float32
+		for i, v := range r.Vector {
+			dot += v * query[i]
+		}
+
+		matches = append(matches, Match{Record: r, Score: dot})
+	}
+
+	slices.SortFunc(matches, func(a, b Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+
+		return 0
+	})
+
+	return matches[:min(k, len(matches))], nil
+}
+
+// Sources lists the documents of the collection by name.
+func (s *Store) Sources(collection string) ([]Source, error) {
+	records, err := s.records(collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []Source
+
+	for _, r := range records {
+		i := slices.IndexFunc(sources, func(src Source) bool { return src.Name == r.Source })
+
+		if i < 0 {
+			sources = append(sources, Source{Name: r.Source, Added: r.Added})
+			i = len(sources) - 1
+		}
+
+		sources[i].Chunks++
+	}
+
+	slices.SortFunc(sources, func(a, b Source) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return sources, nil
+}
+
+// records returns the loaded collection for reading.
+func (s *Store) records(collection string) ([]Record, error) {
+	s.mu.RLock()
+	records, ok := s.collections[collection]
+	s.mu.RUnlock()
+
+	if ok {
+		return records, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(collection)
+}
+
+// load reads the collection file once, the caller holds the write lock.
+func (s *Store) load(collection string) ([]Record, error) {
+	if records, ok := s.collections[collection]; ok {
+		return records, nil
+	}
+
+	path, err := s.path(collection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		s.collections[collection] = nil
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	defer f.Close()
+
+	var (
+		records []Record
+		torn    bool
+	)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		var r Record
+
+		// A torn last line after a crash is dropped.
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			torn = true
+			continue
+		}
+
+		records = append(records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// Records appended after the torn line would join it and be lost too.
+	if torn {
+		if err := s.rewrite(collection, records); err != nil {
+			return nil, err
+		}
+	}
+
+	s.collections[collection] = records
+
+	return records, nil
+}
+
+func (s *Store) append(collection string, records []Record) error {
+	path, err := s.path(collection)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	defer f.Close()
+
+	if err := writeRecords(f, records); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return f.Sync()
+}
+
+// rewrite replaces the collection file atomically.
+func (s *Store) rewrite(collection string, records []Record) error {
+	path, err := s.path(collection)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", tmp, err)
+	}
+
+	err = writeRecords(f, records)
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	f.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	s.collections[collection] = records
+
+	return nil
+}
+
+func (s *Store) path(collection string) (string, error) {
+	if !collectionName.MatchString(collection) {
+		return "", fmt.Errorf("bad collection name %q", collection)
+	}
+
+	return filepath.Join(s.dir, collection+".jsonl"), nil
+}
+
+func writeRecords(f *os.File, records []Record) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+
+	if sum == 0 {
+		return v
+	}
+
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+
+	for i, x := range v {
+		out[i] = x / norm
+	}
+
+	return out
+}
@@ -0,0 +1,212 @@
+package vector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTest(t *testing.T, dir string) *Store {
+	t.Helper()
+
+	s, err := Open(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func put(t *testing.T, s *Store, source string, texts ...string) {
+	t.Helper()
+
+	records := make([]Record, len(texts))
+
+	for i, text := range texts {
+		records[i] = Record{Chunk: i, Text: text, Vector: []float32{1, float32(i)}, Added: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	}
+
+	if err := s.Put("chat", source, records); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+}
+
+// texts lists the record texts of the collection by source.
+func texts(t *testing.T, s *Store) map[string][]string {
+	t.Helper()
+
+	records, err := s.records("chat")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for _, r := range records {
+		got[r.Source] = append(got[r.Source], r.Text)
+	}
+
+	return got
+}
+
+func TestStorePutDelete(t *testing.T) {
+	dir := t.TempDir()
+	s := openTest(t, dir)
+
+	put(t, s, "a.pdf", "a1", "a2")
+	put(t, s, "b.pdf", "b1")
+	put(t, s, "a.pdf", "new a1")
+
+	want := map[string][]string{"a.pdf": {"new a1"}, "b.pdf": {"b1"}}
+
+	if got := texts(t, s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records after replacing a.pdf = %v, want %v", got, want)
+	}
+
+	// The file holds the same records.
+	if got := texts(t, openTest(t, dir)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records after reopening = %v, want %v", got, want)
+	}
+
+	sources, err := s.Sources("chat")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if want := []Source{{Name: "a.pdf", Chunks: 1, Added: added}, {Name: "b.pdf", Chunks: 1, Added: added}}; !reflect.DeepEqual(sources, want) {
+		t.Fatalf("Sources() = %+v, want %+v", sources, want)
+	}
+
+	if n, err := s.Delete("chat", "a.pdf"); err != nil || n != 1 {
+		t.Fatalf("Delete() = %d, %v, want 1 record", n, err)
+	}
+
+	if n, err := s.Delete("chat", "a.pdf"); err != nil || n != 0 {
+		t.Fatalf("Delete() of a deleted source = %d, %v, want 0", n, err)
+	}
+
+	want = map[string][]string{"b.pdf": {"b1"}}
+
+	if got := texts(t, openTest(t, dir)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records after Delete() and reopening = %v, want %v", got, want)
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	s := openTest(t, t.TempDir())
+
+	records := []Record{
+		{Text: "east", Vector: []float32{10, 0}},
+		{Text: "north", Vector: []float32{0, 1}},
+		{Text: "north east", Vector: []float32{1, 1}},
+		{Text: "west", Vector: []float32{-3, 0}},
+		{Text: "three", Vector: []float32{1, 0, 0}},
+	}
+
+	if err := s.Put("chat", "compass", records); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query []float32
+		k     int
+		want  []string
+	}{
+		{name: "best first", query: []float32{1, 0.1}, k: 10, want: []string{"east", "north east", "north", "west"}},
+		{name: "top k", query: []float32{0, 5}, k: 2, want: []string{"north", "north east"}},
+		{name: "other dimension", query: []float32{0, 0, 1}, k: 10, want: []string{"three"}},
+		{name: "no dimension", query: []float32{1, 2, 3, 4}, k: 10, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := s.Search("chat", test.query, test.k)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, m := range matches {
+				got = append(got, m.Text)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Search() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// Vectors are normalized, so the same direction scores 1.
+	matches, err := s.Search("chat", []float32{2, 0}, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if score := matches[0].Score; score < 0.999 || score > 1.001 {
+		t.Fatalf("Score = %v, want 1", score)
+	}
+}
+
+func TestStoreTornLine(t *testing.T) {
+	dir := t.TempDir()
+
+	put(t, openTest(t, dir), "a.pdf", "a1", "a2")
+
+	// The process dies in the middle of appending a record.
+	f, err := os.OpenFile(filepath.Join(dir, "chat.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteString(`{"source":"b.pdf","chunk":0,"te`); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	s := openTest(t, dir)
+	want := map[string][]string{"a.pdf": {"a1", "a2"}}
+
+	if got := texts(t, s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records with a torn line = %v, want %v", got, want)
+	}
+
+	// A new source appended after the torn line survives a restart.
+	put(t, s, "b.pdf", "b1")
+	want = map[string][]string{"a.pdf": {"a1", "a2"}, "b.pdf": {"b1"}}
+
+	if got := texts(t, openTest(t, dir)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records appended after a torn line = %v, want %v", got, want)
+	}
+}
+
+func TestStoreCollectionName(t *testing.T) {
+	s := openTest(t, t.TempDir())
+
+	for _, name := range []string{"", "../chat", "chat.jsonl", "a/b"} {
+		if err := s.Put(name, "a.pdf", nil); err == nil {
+			t.Fatalf("Put() into %q error = nil", name)
+		}
+
+		if _, err := s.Search(name, []float32{1}, 1); err == nil {
+			t.Fatalf("Search() in %q error = nil", name)
+		}
+	}
+
+	// A collection never written is empty.
+	matches, err := s.Search("empty", []float32{1}, 5)
+
+	if err != nil || len(matches) != 0 {
+		t.Fatalf("Search() in an empty collection = %v, %v, want nothing", matches, err)
+	}
+}
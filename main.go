@@ -2,67 +2,186 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"gosberbot/internal/domain"
+	"gosberbot/internal/config"
+	"gosberbot/internal/health"
+	"gosberbot/internal/logging"
+	"gosberbot/internal/metrics"
 	"gosberbot/internal/provider/gigachat"
+	"gosberbot/internal/provider/oauth"
 	"gosberbot/internal/provider/salutespeech"
 	"gosberbot/internal/provider/telegram"
+	"gosberbot/internal/queue"
+	"gosberbot/internal/ratelimit"
 	"gosberbot/internal/service"
+	"gosberbot/internal/tools"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	log := logging.New(os.Stderr, logging.ParseLevel(cfg.Log.Level), cfg.Log.Format, cfg.Secrets()...)
+	slog.SetDefault(log)
+
+	log.Info("effective config", "config", cfg.Masked())
+
 	ctx, cancel := context.WithCancel(context.Background())
 
-	queue := make(chan domain.Message, 10)
+	jobs, err := queue.Open(cfg.Queue.Dir, cfg.Queue.MaxAttempts)
+	if err != nil {
+		log.Error("failed to open queue", "err", err)
+		return
+	}
+
+	defer func() {
+		if err := jobs.Close(); err != nil {
+			log.Error("failed to close queue", "err", err)
+		}
+	}()
 
-	bot := telegram.NewClient(os.Getenv("BOT_TOKEN"), queue)
+	access, err := service.NewAccess(cfg.Service.Access, cfg.Service.AdminIDs)
+	if err != nil {
+		log.Error("failed to load access lists", "err", err)
+		return
+	}
+
+	limiter := ratelimit.NewLimiter(cfg.RateLimit)
+
+	bot := telegram.NewClient(cfg.Telegram, jobs, limiter, access, log.With("component", "telegram"))
 	if bot == nil {
-		fmt.Printf("telegram bot error\n")
 		return
 	}
 
-	speech := salutespeech.NewClient(os.Getenv("SALUTESPEECH_AUTH_KEY"))
-	chat := gigachat.NewClient(os.Getenv("GIGACHAT_AUTH_KEY"))
+	speechTokens := oauth.NewTokenSource(cfg.OAuth.Url, cfg.SaluteSpeech.AuthKey, cfg.SaluteSpeech.Scope, log.With("component", "oauth"))
+	chatTokens := oauth.NewTokenSource(cfg.OAuth.Url, cfg.GigaChat.AuthKey, cfg.GigaChat.Scope, log.With("component", "oauth"))
 
-	if err := speech.GetToken(); err != nil {
-		fmt.Printf("salutespeech error: %v\n", err)
+	if _, err := speechTokens.Token(); err != nil {
+		log.Error("failed to get salutespeech token", "err", err)
 		return
 	}
 
-	if err := chat.GetToken(); err != nil {
-		fmt.Printf("gigachat error: %v\n", err)
+	if _, err := chatTokens.Token(); err != nil {
+		log.Error("failed to get gigachat token", "err", err)
 		return
 	}
 
+	speech := salutespeech.NewClient(cfg.SaluteSpeech, speechTokens, log.With("component", "salutespeech"))
+	chat := gigachat.NewClient(cfg.GigaChat, chatTokens, log.With("component", "gigachat"))
+
 	go func() {
 		bot.Start()
 	}()
 
-	fmt.Printf("Start service\n")
+	log.Info("service started")
 
-	srv := service.NewService(queue)
+	history := service.NewHistory(cfg.Service.HistoryTurns, cfg.Service.HistoryTokens)
+	pool := service.NewPool(cfg.Service.LightWorkers, cfg.Service.HeavyWorkers, cfg.Service.RetryDelay)
 
-	srv.Init(bot, speech, chat)
+	settings, err := service.NewSettings(cfg.Service.SettingsFile)
+	if err != nil {
+		log.Error("failed to load settings", "err", err)
+		return
+	}
+
+	usage, err := service.NewUsage(cfg.Service.Usage)
+	if err != nil {
+		log.Error("failed to load usage", "err", err)
+		return
+	}
+
+	knowledge, err := service.NewKnowledge(cfg.Service.Knowledge)
+	if err != nil {
+		log.Error("failed to open the document store", "err", err)
+		return
+	}
+
+	registry := tools.NewRegistry(cfg.Tools, log.With("component", "tools"))
+
+	srv := service.NewService(jobs, history, pool, settings, access, usage, registry, knowledge, log.With("component", "service"))
+
+	srv.Init(bot, speech, speech, chat)
+
+	loop := make(chan struct{})
 
 	go func() {
+		defer close(loop)
 		srv.Start(ctx)
 	}()
 
+	metrics.RegisterQueueDepth(jobs.Len)
+
+	live := health.NewChecker()
+	live.Add("service", srv.Alive)
+
+	ready := health.NewChecker()
+	ready.Add("salutespeech_token", tokenCheck(speechTokens))
+	ready.Add("gigachat_token", tokenCheck(chatTokens))
+	ready.Add("telegram", bot.Ready)
+	ready.Add("queue", func() error {
+		if n := jobs.Len(); n > cfg.Queue.MaxPending {
+			return fmt.Errorf("%d jobs pending, limit %d", n, cfg.Queue.MaxPending)
+		}
+
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", live)
+	mux.Handle("/readyz", ready)
+
+	httpServer := &http.Server{Addr: cfg.HTTP.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	if cfg.HTTP.Addr != "" {
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("http server error", "err", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(
 		quit,
 		syscall.SIGABRT, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt,
 	)
 
-	fmt.Printf("Caught signal %s. Shutting down...\n", <-quit)
+	log.Info("shutting down", "signal", (<-quit).String())
 
 	cancel()
 
+	// The loop must not hand the pool a job after Stop waited for it.
+	<-loop
+
 	srv.Stop()
 	bot.Stop()
 
-	close(queue)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to stop http server", "err", err)
+	}
+}
+
+// tokenCheck fails when the token can't be had. It never fetches one, the
+// requests refresh the token.
+func tokenCheck(tokens *oauth.TokenSource) health.Check {
+	return tokens.Valid
 }